@@ -0,0 +1,145 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/babykittenz/api-micro-util/models"
+)
+
+// Client calls other services that answer with the JSONResponse envelope (or RFC 7807 problem documents, for
+// errors). Use it with the generic helpers GetJSON, PostJSON, PutJSON, PatchJSON and DeleteJSON, which decode the
+// envelope's data into a typed value, or its error into an *APIError.
+type Client struct {
+	tools *Tools
+	// BaseURL is prefixed to every path that is not an absolute URL
+	BaseURL string
+	// Options are used for every request. Options.Headers are sent with every request, and Options.Client can be
+	// given a custom Transport, such as a TransportFunc in tests
+	Options RemoteOptions
+}
+
+// NewClient returns a Client for the service at baseURL.
+func (t *Tools) NewClient(baseURL string, opts ...RemoteOptions) *Client {
+	c := &Client{tools: t, BaseURL: baseURL}
+	if len(opts) > 0 {
+		c.Options = opts[0]
+	}
+	return c
+}
+
+// TransportFunc adapts a function to an http.RoundTripper, so a Client can be tested without a server.
+type TransportFunc func(r *http.Request) (*http.Response, error)
+
+// RoundTrip calls f.
+func (f TransportFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// APIError is returned when a service responds with an error envelope or problem document.
+type APIError struct {
+	StatusCode int
+	Message    string
+	// Errors holds the field level failures, if the request failed validation
+	Errors []models.FieldError
+}
+
+// Error returns the message from the service, or the status if it sent none.
+func (e *APIError) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	return fmt.Sprintf("service responded with %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Unwrap returns the field errors as models.ValidationErrors, so errors.As can be used to get at them.
+func (e *APIError) Unwrap() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return models.ValidationErrors(e.Errors)
+}
+
+// GetJSON gets path from the service and returns the data of the response.
+func GetJSON[T any](ctx context.Context, c *Client, path string) (T, error) {
+	return doJSON[T](ctx, c, http.MethodGet, path, nil)
+}
+
+// PostJSON posts body as JSON to path and returns the data of the response.
+func PostJSON[T any](ctx context.Context, c *Client, path string, body interface{}) (T, error) {
+	return doJSON[T](ctx, c, http.MethodPost, path, body)
+}
+
+// PutJSON puts body as JSON to path and returns the data of the response.
+func PutJSON[T any](ctx context.Context, c *Client, path string, body interface{}) (T, error) {
+	return doJSON[T](ctx, c, http.MethodPut, path, body)
+}
+
+// PatchJSON patches path with body as JSON and returns the data of the response.
+func PatchJSON[T any](ctx context.Context, c *Client, path string, body interface{}) (T, error) {
+	return doJSON[T](ctx, c, http.MethodPatch, path, body)
+}
+
+// DeleteJSON deletes path and returns the data of the response, if any.
+func DeleteJSON[T any](ctx context.Context, c *Client, path string) (T, error) {
+	return doJSON[T](ctx, c, http.MethodDelete, path, nil)
+}
+
+// envelope decodes a JSONResponse, or the members of a problem document that describe the error.
+type envelope struct {
+	Error   bool                `json:"error"`
+	Message string              `json:"message"`
+	Data    json.RawMessage     `json:"data"`
+	Errors  []models.FieldError `json:"errors"`
+	Title   string              `json:"title"`
+	Detail  string              `json:"detail"`
+}
+
+// doJSON sends the request and decodes the envelope of the response.
+func doJSON[T any](ctx context.Context, c *Client, method, path string, body interface{}) (T, error) {
+	var value T
+
+	res, err := c.tools.sendJSON(ctx, method, c.url(path), body, c.Options)
+	var remoteErr *RemoteError
+	if err != nil && !errors.As(err, &remoteErr) {
+		return value, err
+	}
+
+	var env envelope
+	if b := bytes.TrimSpace(res.Body); len(b) > 0 {
+		if decodeErr := json.Unmarshal(b, &env); decodeErr != nil && remoteErr == nil {
+			return value, fmt.Errorf("failed to decode response from %s: %w", path, decodeErr)
+		}
+	}
+
+	if remoteErr != nil || env.Error {
+		apiErr := &APIError{StatusCode: res.StatusCode, Message: env.Message, Errors: env.Errors}
+		if apiErr.Message == "" {
+			apiErr.Message = env.Detail
+		}
+		if apiErr.Message == "" {
+			apiErr.Message = env.Title
+		}
+		return value, apiErr
+	}
+
+	if len(env.Data) > 0 && string(env.Data) != "null" {
+		if err := json.Unmarshal(env.Data, &value); err != nil {
+			return value, fmt.Errorf("failed to decode data from %s: %w", path, err)
+		}
+	}
+	return value, nil
+}
+
+// url joins path to the base URL, unless it is an absolute URL already.
+func (c *Client) url(path string) string {
+	if c.BaseURL == "" || strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return path
+	}
+	return strings.TrimRight(c.BaseURL, "/") + "/" + strings.TrimLeft(path, "/")
+}
@@ -0,0 +1,83 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/babykittenz/api-micro-util/models"
+)
+
+// jsonResponse returns a response with a JSON body.
+func jsonResponse(status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestClient(t *testing.T) {
+	type trainee struct {
+		ID    string `json:"id"`
+		Phone string `json:"phone"`
+	}
+
+	var requests []string
+	var testTools Tools
+	client := testTools.NewClient("https://trainees.internal/v1/", RemoteOptions{
+		Headers: http.Header{"Authorization": []string{"Bearer service-token"}},
+		Client: &http.Client{Transport: TransportFunc(func(r *http.Request) (*http.Response, error) {
+			requests = append(requests, r.Method+" "+r.URL.String()+" "+r.Header.Get("Authorization"))
+
+			switch {
+			case r.Method == http.MethodGet && r.URL.Path == "/v1/trainees/2":
+				return jsonResponse(http.StatusOK, `{"error": false, "message": "found", "data": {"id": "2", "phone": "555-456-7890"}}`), nil
+			case r.Method == http.MethodPatch:
+				return jsonResponse(http.StatusUnprocessableEntity, `{"error": true, "message": "phone is not valid", "errors": [{"field": "phone", "code": "phone", "message": "phone is not valid"}]}`), nil
+			case r.Method == http.MethodPut:
+				return jsonResponse(http.StatusNotFound, `{"type": "about:blank", "title": "Not Found", "status": 404, "detail": "trainee 9 not found"}`), nil
+			case r.Method == http.MethodDelete:
+				return &http.Response{StatusCode: http.StatusNoContent, Body: http.NoBody}, nil
+			}
+			return jsonResponse(http.StatusOK, `{"error": true, "message": "something went wrong"}`), nil
+		})},
+	})
+	ctx := context.Background()
+
+	found, err := GetJSON[trainee](ctx, client, "/trainees/2")
+	if err != nil || found.ID != "2" || found.Phone != "555-456-7890" {
+		t.Errorf("expected the trainee from the envelope, recieved %+v %v", found, err)
+	}
+	if len(requests) != 1 || requests[0] != "GET https://trainees.internal/v1/trainees/2 Bearer service-token" {
+		t.Errorf("expected the base URL and default headers to be used, recieved %v", requests)
+	}
+
+	_, err = PatchJSON[trainee](ctx, client, "trainees/2", map[string]string{"phone": "x"})
+	var apiErr *APIError
+	var fields models.ValidationErrors
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnprocessableEntity || apiErr.Message != "phone is not valid" {
+		t.Errorf("expected an APIError from the error envelope, recieved %v", err)
+	}
+	if !errors.As(err, &fields) || len(fields) != 1 || fields[0].Field != "phone" {
+		t.Errorf("expected the field errors to be available, recieved %v", fields)
+	}
+
+	if _, err = PutJSON[trainee](ctx, client, "trainees/9", trainee{ID: "9"}); !errors.As(err, &apiErr) || apiErr.Message != "trainee 9 not found" {
+		t.Errorf("expected an APIError from the problem document, recieved %v", err)
+	}
+
+	if _, err = PostJSON[trainee](ctx, client, "trainees", trainee{}); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusOK {
+		t.Errorf("expected an error envelope sent with 200 to be an APIError, recieved %v", err)
+	}
+
+	if _, err = DeleteJSON[struct{}](ctx, client, "https://other.internal/trainees/2"); err != nil {
+		t.Errorf("expected an empty response to succeed, recieved %v", err)
+	}
+	if last := requests[len(requests)-1]; !strings.HasPrefix(last, "DELETE https://other.internal/trainees/2") {
+		t.Errorf("expected an absolute URL to be used as is, recieved %s", last)
+	}
+}
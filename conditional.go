@@ -0,0 +1,109 @@
+package toolkit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CacheValidators holds the values used to answer conditional requests. If ETag is empty it is derived from
+// Version, or from the JSON payload when Version is empty too. LastModified is optional, and is usually taken
+// from a repository's LastModified method.
+type CacheValidators struct {
+	ETag         string
+	Version      string
+	LastModified time.Time
+}
+
+// WriteJSONConditional writes data as JSON like WriteJSON, but first sets ETag and Last-Modified headers and
+// answers with 304 Not Modified when the request's If-None-Match or If-Modified-Since headers show the client
+// already has the current representation. It returns true if a 304 was sent.
+func (t *Tools) WriteJSONConditional(w http.ResponseWriter, r *http.Request, status int, data interface{}, validators CacheValidators, headers ...http.Header) (bool, error) {
+	out, err := json.Marshal(data)
+	if err != nil {
+		return false, err
+	}
+
+	etag := validators.ETag
+	switch {
+	case etag != "":
+		if !strings.HasPrefix(etag, `"`) && !strings.HasPrefix(etag, `W/"`) {
+			etag = `"` + etag + `"`
+		}
+	case validators.Version != "":
+		etag = makeETag([]byte(validators.Version), false)
+	default:
+		etag = makeETag(out, false)
+	}
+
+	if len(headers) > 0 {
+		for k, v := range headers[0] {
+			w.Header()[k] = v
+		}
+	}
+
+	w.Header().Set("ETag", etag)
+	if !validators.LastModified.IsZero() {
+		w.Header().Set("Last-Modified", validators.LastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if status == http.StatusOK && NotModified(r, etag, validators.LastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return true, nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(out)
+	return false, err
+}
+
+// NotModified reports whether a GET or HEAD request's conditional headers match the current ETag and
+// last modified time. If-None-Match takes precedence over If-Modified-Since, as required by RFC 9110.
+func NotModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || weakETagMatch(candidate, etag) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+		// HTTP dates only have second precision
+		return !lastModified.Truncate(time.Second).After(since)
+	}
+
+	return false
+}
+
+// weakETagMatch compares two entity tags using the weak comparison function.
+func weakETagMatch(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+// makeETag returns a quoted entity tag derived from the SHA-256 of b.
+func makeETag(b []byte, weak bool) string {
+	sum := sha256.Sum256(b)
+	tag := `"` + hex.EncodeToString(sum[:])[:32] + `"`
+	if weak {
+		return "W/" + tag
+	}
+	return tag
+}
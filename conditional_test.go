@@ -0,0 +1,92 @@
+package toolkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// conditionalTests is a test table for WriteJSONConditional, listing the conditional request headers and expected status.
+var conditionalTests = []struct {
+	name            string
+	ifNoneMatch     string
+	ifModifiedSince string
+	expectedStatus  int
+}{
+	{"no conditions", "", "", http.StatusOK},
+	{"matching etag", `"v1-etag"`, "", http.StatusNotModified},
+	{"matching weak etag", `W/"v1-etag"`, "", http.StatusNotModified},
+	{"matching one of many", `"other", "v1-etag"`, "", http.StatusNotModified},
+	{"wildcard", "*", "", http.StatusNotModified},
+	{"stale etag", `"v0-etag"`, "", http.StatusOK},
+	{"not modified since", "", "Mon, 02 Jan 2006 15:04:05 GMT", http.StatusNotModified},
+	{"modified since", "", "Sun, 01 Jan 2006 15:04:05 GMT", http.StatusOK},
+	{"etag wins over date", `"v0-etag"`, "Mon, 02 Jan 2006 15:04:05 GMT", http.StatusOK},
+}
+
+// TestTools_WriteJSONConditional verifies 304 handling for every entry in conditionalTests.
+func TestTools_WriteJSONConditional(t *testing.T) {
+	var testTool Tools
+	lastModified := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	for _, e := range conditionalTests {
+		req := httptest.NewRequest("GET", "/", nil)
+		if e.ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", e.ifNoneMatch)
+		}
+		if e.ifModifiedSince != "" {
+			req.Header.Set("If-Modified-Since", e.ifModifiedSince)
+		}
+		rr := httptest.NewRecorder()
+
+		notModified, err := testTool.WriteJSONConditional(rr, req, http.StatusOK, JSONResponse{Message: "companies"}, CacheValidators{ETag: "v1-etag", LastModified: lastModified})
+		if err != nil {
+			t.Errorf("%s: %s", e.name, err.Error())
+		}
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: wrong status code recieved: %d", e.name, rr.Code)
+		}
+
+		if notModified != (e.expectedStatus == http.StatusNotModified) {
+			t.Errorf("%s: wrong not modified result %v", e.name, notModified)
+		}
+
+		if notModified && rr.Body.Len() != 0 {
+			t.Errorf("%s: 304 response must not have a body", e.name)
+		}
+
+		if rr.Header().Get("ETag") != `"v1-etag"` || rr.Header().Get("Last-Modified") != "Mon, 02 Jan 2006 15:04:05 GMT" {
+			t.Errorf("%s: wrong validators %v", e.name, rr.Header())
+		}
+	}
+}
+
+// TestTools_WriteJSONConditionalPayloadETag verifies the ETag is derived from the payload when no version is given.
+func TestTools_WriteJSONConditionalPayloadETag(t *testing.T) {
+	var testTool Tools
+
+	rr := httptest.NewRecorder()
+	_, err := testTool.WriteJSONConditional(rr, httptest.NewRequest("GET", "/", nil), http.StatusOK, []string{"a", "b"}, CacheValidators{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag := rr.Header().Get("ETag")
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	_, _ = testTool.WriteJSONConditional(rr, req, http.StatusOK, []string{"a", "b"}, CacheValidators{})
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for same payload but got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	_, _ = testTool.WriteJSONConditional(rr, req, http.StatusOK, []string{"a", "c"}, CacheValidators{})
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200 for changed payload but got %d", rr.Code)
+	}
+}
@@ -47,11 +47,17 @@ func (r *AutomaticTextMessageDDBRepository) FindAllByLocationID(id string) ([]*m
 
 // Save stores a new AutomaticTextMessage record in the DynamoDB table and returns an error if the operation fails.
 func (r *AutomaticTextMessageDDBRepository) Save(automaticTextMessage *models.AutomaticTextMessage) error {
+	if err := automaticTextMessage.Validate(); err != nil {
+		return err
+	}
 	return nil
 }
 
 // Update updates an existing AutomaticTextMessage record in the DynamoDB table and returns an error if the operation fails.
 func (r *AutomaticTextMessageDDBRepository) Update(automaticTextMessage *models.AutomaticTextMessage) error {
+	if err := automaticTextMessage.Validate(); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -54,11 +54,17 @@ func (r *CheckinDDBRepository) FindAllByTraineeID(id string) ([]*models.Checkin,
 
 // Save saves the provided Checkin record into the DynamoDB table. Returns an error if the operation fails.
 func (r *CheckinDDBRepository) Save(checkin *models.Checkin) error {
+	if err := checkin.Validate(); err != nil {
+		return err
+	}
 	return nil
 }
 
 // Update updates an existing Checkin record in the DynamoDB table. Returns an error if the update operation fails.
 func (r *CheckinDDBRepository) Update(checkin *models.Checkin) error {
+	if err := checkin.Validate(); err != nil {
+		return err
+	}
 	return nil
 }
 
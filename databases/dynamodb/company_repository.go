@@ -1,7 +1,10 @@
 package dynamodb
 
 import (
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"context"
+	"fmt"
+	"time"
+
 	"github.com/babykittenz/api-micro-util/models"
 	"github.com/babykittenz/api-micro-util/repository"
 )
@@ -10,12 +13,12 @@ import (
 // It utilizes a DynamoDB client and a specific table to perform CRUD operations on company records.
 // The struct includes client for interaction with DynamoDB and tableName for specifying the target table.
 type CompanyDDBRepository struct {
-	client    *dynamodb.Client
+	client    TransactDynamoDBAPI
 	tableName string
 }
 
 // NewCompanyDDBRepository creates a new instance of a CompanyRepository using a DynamoDB client and a predefined table name.
-func NewCompanyDDBRepository(client *dynamodb.Client) repository.CompanyRepository {
+func NewCompanyDDBRepository(client TransactDynamoDBAPI) repository.CompanyRepository {
 	return &CompanyDDBRepository{
 		client:    client,
 		tableName: "companies",
@@ -34,15 +37,65 @@ func (r *CompanyDDBRepository) FindAll() ([]*models.Company, error) {
 
 // Save stores or inserts the given company record into the DynamoDB table. Returns an error if the operation fails.
 func (r *CompanyDDBRepository) Save(company *models.Company) error {
+	ctx := context.Background()
+
+	if err := company.Validate(); err != nil {
+		return err
+	}
+
+	// stamp a copy, so the caller's company only changes once it is written
+	now := time.Now().UTC()
+	stamped := *company
+	stamped.Updated = now
+	item, err := marshalItem(stamped.ID, &stamped)
+	if err != nil {
+		return err
+	}
+
+	if err := putModified(ctx, r.client, r.tableName, item, false, now); err != nil {
+		return fmt.Errorf("failed to save company in DynamoDB: %w", err)
+	}
+	company.Updated = now
 	return nil
 }
 
 // Update modifies an existing company record in the DynamoDB table and returns an error if the operation fails.
 func (r *CompanyDDBRepository) Update(company *models.Company) error {
+	ctx := context.Background()
+
+	if err := company.Validate(); err != nil {
+		return err
+	}
+
+	// stamp a copy, so the caller's company only changes once it is written
+	now := time.Now().UTC()
+	stamped := *company
+	stamped.Updated = now
+	item, err := marshalItem(stamped.ID, &stamped)
+	if err != nil {
+		return err
+	}
+
+	if err := putModified(ctx, r.client, r.tableName, item, true, now); err != nil {
+		return fmt.Errorf("failed to update company in DynamoDB: %w", err)
+	}
+	company.Updated = now
 	return nil
 }
 
 // Delete removes a company record from the DynamoDB table based on the provided unique identifier and returns an error if it fails.
 func (r *CompanyDDBRepository) Delete(id string) error {
+	ctx := context.Background()
+
+	// a missing company is not an error, and leaves the last modified time alone
+	err := deleteModified(ctx, r.client, r.tableName, id, true, time.Now())
+	if err != nil && !conditionFailed(err) {
+		return fmt.Errorf("failed to delete company from DynamoDB: %w", err)
+	}
 	return nil
 }
+
+// LastModified returns the most recent updated time of all Company records in the DynamoDB table.
+func (r *CompanyDDBRepository) LastModified() (time.Time, error) {
+	return lastModified(context.Background(), r.client, r.tableName)
+}
@@ -1,6 +1,8 @@
 package dynamodb
 
 import (
+	"time"
+
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/babykittenz/api-micro-util/models"
 	"github.com/babykittenz/api-micro-util/repository"
@@ -40,3 +42,8 @@ func (r *testCompanyDDBRepository) Update(company *models.Company) error {
 func (r *testCompanyDDBRepository) Delete(id string) error {
 	return nil
 }
+
+// LastModified returns the time the records were last modified. Returns a zero time if unknown.
+func (r *testCompanyDDBRepository) LastModified() (time.Time, error) {
+	return time.Time{}, nil
+}
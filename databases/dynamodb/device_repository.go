@@ -0,0 +1,178 @@
+package dynamodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	toolkit "github.com/babykittenz/api-micro-util"
+	"github.com/babykittenz/api-micro-util/models"
+	"github.com/babykittenz/api-micro-util/repository"
+)
+
+// DeviceLocationIndex is the name of the global secondary index on the devices table whose partition key is
+// location_id, used to list the devices of a location.
+const DeviceLocationIndex = "location_id-index"
+
+// DeviceDDBRepository is a repository implementation for managing kiosk devices in DynamoDB.
+// The client is any toolkit.DynamoDBAPI, so a *dynamodb.Client or a mock can be used.
+type DeviceDDBRepository struct {
+	client    toolkit.DynamoDBAPI
+	tableName string
+}
+
+// NewDeviceDDBRepository creates a new DeviceRepository using the given DynamoDB client and the "devices" table.
+func NewDeviceDDBRepository(client toolkit.DynamoDBAPI) repository.DeviceRepository {
+	return &DeviceDDBRepository{
+		client:    client,
+		tableName: "devices",
+	}
+}
+
+// FindByID retrieves a device record from DynamoDB based on the provided ID.
+func (r *DeviceDDBRepository) FindByID(id string) (*models.Device, error) {
+	ctx := context.Background()
+
+	result, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device from DynamoDB: %w", err)
+	}
+
+	// If no item found
+	if len(result.Item) == 0 {
+		return nil, fmt.Errorf("device with id %s not found", id)
+	}
+
+	var device models.Device
+	err = attributevalue.UnmarshalMap(result.Item, &device)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal device: %w", err)
+	}
+
+	return &device, nil
+}
+
+// FindAllByLocationID retrieves all devices registered to the given location through the DeviceLocationIndex.
+func (r *DeviceDDBRepository) FindAllByLocationID(id string) ([]*models.Device, error) {
+	devices := []*models.Device{}
+	err := queryAll(context.Background(), r.client, &dynamodb.QueryInput{
+		TableName:              aws.String(r.tableName),
+		IndexName:              aws.String(DeviceLocationIndex),
+		KeyConditionExpression: aws.String("location_id = :locationID"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":locationID": &types.AttributeValueMemberS{Value: id},
+		},
+	}, 0, &devices)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query devices from DynamoDB: %w", err)
+	}
+
+	return devices, nil
+}
+
+// Save persists a new device record to the DynamoDB table, failing if a device with the same ID exists.
+func (r *DeviceDDBRepository) Save(device *models.Device) error {
+	ctx := context.Background()
+
+	if device.ID == "" {
+		return fmt.Errorf("cannot save device with empty ID")
+	}
+
+	if err := device.Validate(); err != nil {
+		return err
+	}
+
+	item, err := attributevalue.MarshalMap(device)
+	if err != nil {
+		return fmt.Errorf("failed to marshal device: %w", err)
+	}
+
+	_, err = r.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(r.tableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(id)"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save device to DynamoDB: %w", err)
+	}
+
+	return nil
+}
+
+// Update replaces an existing device record, failing if the device does not exist.
+func (r *DeviceDDBRepository) Update(device *models.Device) error {
+	ctx := context.Background()
+
+	if err := device.Validate(); err != nil {
+		return err
+	}
+
+	item, err := attributevalue.MarshalMap(device)
+	if err != nil {
+		return fmt.Errorf("failed to marshal device for update: %w", err)
+	}
+
+	_, err = r.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(r.tableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_exists(id)"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update device in DynamoDB: %w", err)
+	}
+
+	return nil
+}
+
+// Delete removes a device record from the DynamoDB table.
+func (r *DeviceDDBRepository) Delete(id string) error {
+	ctx := context.Background()
+
+	_, err := r.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete device from DynamoDB: %w", err)
+	}
+
+	return nil
+}
+
+// Touch records when a device was last seen, without rewriting the rest of the record.
+func (r *DeviceDDBRepository) Touch(id string, lastSeen time.Time) error {
+	ctx := context.Background()
+
+	seen, err := attributevalue.Marshal(lastSeen)
+	if err != nil {
+		return fmt.Errorf("failed to marshal last seen time: %w", err)
+	}
+
+	_, err = r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+		UpdateExpression:    aws.String("SET last_seen = :lastSeen"),
+		ConditionExpression: aws.String("attribute_exists(id)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":lastSeen": seen,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update device last seen in DynamoDB: %w", err)
+	}
+
+	return nil
+}
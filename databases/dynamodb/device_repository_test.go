@@ -0,0 +1,41 @@
+package dynamodb
+
+import (
+	"testing"
+
+	"github.com/babykittenz/api-micro-util/models"
+)
+
+// TestDeviceDDBRepository verifies devices are listed by location through the index, and that saving an existing
+// device ID fails instead of replacing it.
+func TestDeviceDDBRepository(t *testing.T) {
+	client := newTableClient()
+	repo := NewDeviceDDBRepository(client)
+
+	for _, d := range []*models.Device{
+		{ID: "d1", Name: "Gate", LocationID: "loc-001", Scopes: []string{"checkin"}},
+		{ID: "d2", Name: "Lobby", LocationID: "loc-001", Scopes: []string{"checkin"}},
+		{ID: "d3", Name: "Scale", LocationID: "loc-002", Scopes: []string{"checkin"}},
+	} {
+		if err := repo.Save(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.Save(&models.Device{ID: "d1", Name: "Other", LocationID: "loc-002", Scopes: []string{"checkin"}}); err == nil {
+		t.Error("expected saving an existing device to fail")
+	}
+
+	devices, err := repo.FindAllByLocationID("loc-001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 2 {
+		t.Errorf("expected 2 devices at loc-001, recieved %d", len(devices))
+	}
+	if client.scans != 0 {
+		t.Errorf("expected the location index to be queried, recieved %d scans", client.scans)
+	}
+	if d, _ := repo.FindByID("d1"); d == nil || d.Name != "Gate" {
+		t.Errorf("expected the first device to be kept, recieved %+v", d)
+	}
+}
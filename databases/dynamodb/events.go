@@ -0,0 +1,45 @@
+package dynamodb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/babykittenz/api-micro-util/events"
+)
+
+// emitter publishes the domain events of a repository, if the repository was given a publisher.
+type emitter struct {
+	publisher events.Publisher
+}
+
+// newEmitter returns an emitter for the first of publishers, the optional last argument of the repository
+// constructors.
+func newEmitter(publishers []events.Publisher) emitter {
+	if len(publishers) == 0 {
+		return emitter{}
+	}
+	return emitter{publisher: publishers[0]}
+}
+
+// emit publishes an event of eventType about the record subject. The record has already been written, so an error
+// means only that the event was lost.
+func (e emitter) emit(ctx context.Context, eventType, subject, companyID string, data interface{}) error {
+	if e.publisher == nil {
+		return nil
+	}
+	event, err := events.New(eventType, subject, companyID, data)
+	if err != nil {
+		return err
+	}
+	if err := e.publisher.Publish(ctx, event); err != nil {
+		return fmt.Errorf("failed to publish %s event: %w", eventType, err)
+	}
+	return nil
+}
+
+// outbox returns the publisher if it is a Transactor, in which case writes are committed together with their
+// events.
+func (e emitter) outbox() (Transactor, bool) {
+	outbox, ok := e.publisher.(Transactor)
+	return outbox, ok
+}
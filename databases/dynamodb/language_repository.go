@@ -34,11 +34,17 @@ func (r *LanguageDDBRepository) FindAll() ([]*models.Language, error) {
 
 // Save persists a Language record to the DynamoDB table. Returns an error if the operation fails.
 func (r *LanguageDDBRepository) Save(language *models.Language) error {
+	if err := language.Validate(); err != nil {
+		return err
+	}
 	return nil
 }
 
 // Update updates an existing Language record in the DynamoDB table. Returns an error if the operation fails.
 func (r *LanguageDDBRepository) Update(language *models.Language) error {
+	if err := language.Validate(); err != nil {
+		return err
+	}
 	return nil
 }
 
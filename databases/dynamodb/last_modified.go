@@ -0,0 +1,147 @@
+package dynamodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	toolkit "github.com/babykittenz/api-micro-util"
+	"github.com/babykittenz/api-micro-util/streams"
+)
+
+// lastModifiedID is the id of the marker item holding the last modified time of its table. Every write updates it
+// in the same transaction, so LastModified reads one item however large the table grows. Reads must skip it:
+// scanAll and queryAll drop it from their results, FindByID methods refuse the id, and streams.Consumer skips its
+// records.
+const lastModifiedID = streams.LastModifiedID
+
+// TransactWriter is the part of the DynamoDB client that writes items in a transaction. *dynamodb.Client implements it.
+type TransactWriter interface {
+	TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+}
+
+// TransactDynamoDBAPI is a DynamoDB client that can also write transactions, as needed by the repositories keeping
+// a last modified marker. *dynamodb.Client implements it.
+type TransactDynamoDBAPI interface {
+	toolkit.DynamoDBAPI
+	TransactWriter
+}
+
+// lastModified returns the time in the last modified marker of tableName, or a zero time if nothing has been
+// written to the table yet.
+func lastModified(ctx context.Context, client toolkit.DynamoDBAPI, tableName string) (time.Time, error) {
+	result, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: lastModifiedID},
+		},
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get last modified time of %s from DynamoDB: %w", tableName, err)
+	}
+
+	var marker struct {
+		Updated time.Time `dynamodbav:"updated"`
+	}
+	if err := attributevalue.UnmarshalMap(result.Item, &marker); err != nil {
+		return time.Time{}, fmt.Errorf("failed to unmarshal last modified time of %s: %w", tableName, err)
+	}
+	return marker.Updated, nil
+}
+
+// writeModified commits write together with an update of the last modified marker of tableName to now.
+func writeModified(ctx context.Context, client TransactWriter, tableName string, write types.TransactWriteItem, now time.Time) error {
+	writes, err := modifiedWrites(tableName, write, now)
+	if err != nil {
+		return err
+	}
+	_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: writes})
+	return err
+}
+
+// modifiedWrites returns write followed by an update of the last modified marker of tableName to now, for a
+// transaction that may carry more writes, such as the events of an outbox.
+func modifiedWrites(tableName string, write types.TransactWriteItem, now time.Time) ([]types.TransactWriteItem, error) {
+	updated, err := attributevalue.Marshal(now.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal last modified time: %w", err)
+	}
+
+	return []types.TransactWriteItem{
+		write,
+		{Update: &types.Update{
+			TableName: aws.String(tableName),
+			Key: map[string]types.AttributeValue{
+				"id": &types.AttributeValueMemberS{Value: lastModifiedID},
+			},
+			UpdateExpression:          aws.String("SET updated = :updated"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{":updated": updated},
+		}},
+	}, nil
+}
+
+// putModified puts item into tableName and updates the table's last modified marker. When exists is true the put
+// only replaces an existing item.
+func putModified(ctx context.Context, client TransactWriter, tableName string, item map[string]types.AttributeValue, exists bool, now time.Time) error {
+	return writeModified(ctx, client, tableName, putWrite(tableName, item, exists), now)
+}
+
+// putWrite returns the put of putModified, for writeModified or modifiedWrites.
+func putWrite(tableName string, item map[string]types.AttributeValue, exists bool) types.TransactWriteItem {
+	put := &types.Put{TableName: aws.String(tableName), Item: item}
+	if exists {
+		put.ConditionExpression = aws.String("attribute_exists(id)")
+	}
+	return types.TransactWriteItem{Put: put}
+}
+
+// deleteModified deletes the item with id from tableName and updates the table's last modified marker. When exists
+// is true the delete only removes an existing item, and fails with a cancelled transaction, for which
+// conditionFailed reports true, without moving the marker if there is none.
+func deleteModified(ctx context.Context, client TransactWriter, tableName, id string, exists bool, now time.Time) error {
+	return writeModified(ctx, client, tableName, deleteWrite(tableName, id, exists), now)
+}
+
+// deleteWrite returns the delete of deleteModified, for writeModified or modifiedWrites.
+func deleteWrite(tableName, id string, exists bool) types.TransactWriteItem {
+	del := &types.Delete{
+		TableName: aws.String(tableName),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	}
+	if exists {
+		del.ConditionExpression = aws.String("attribute_exists(id)")
+	}
+	return types.TransactWriteItem{Delete: del}
+}
+
+// withoutMarker returns items without the last modified marker, reusing the slice.
+func withoutMarker(items []map[string]types.AttributeValue) []map[string]types.AttributeValue {
+	kept := items[:0]
+	for _, item := range items {
+		if id, ok := item["id"].(*types.AttributeValueMemberS); ok && id.Value == lastModifiedID {
+			continue
+		}
+		kept = append(kept, item)
+	}
+	return kept
+}
+
+// marshalItem marshals a model for writing. The models have no dynamodbav tag on their ID, so the key is added
+// under the table's id attribute, as TraineeDDBRepository.Save does.
+func marshalItem(id string, v interface{}) (map[string]types.AttributeValue, error) {
+	if id == "" {
+		return nil, fmt.Errorf("cannot save %T with empty ID", v)
+	}
+	item, err := attributevalue.MarshalMap(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %T: %w", v, err)
+	}
+	item["id"] = &types.AttributeValueMemberS{Value: id}
+	return item, nil
+}
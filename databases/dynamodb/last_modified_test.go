@@ -0,0 +1,191 @@
+package dynamodb
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/babykittenz/api-micro-util/events"
+	"github.com/babykittenz/api-micro-util/models"
+)
+
+// TestCompanyDDBRepository_LastModified verifies that writes persist the company and move the table's last modified
+// marker, and that rejected writes change nothing.
+func TestCompanyDDBRepository_LastModified(t *testing.T) {
+	client := newTableClient()
+	repo := NewCompanyDDBRepository(client)
+
+	modified, err := repo.LastModified()
+	if err != nil || !modified.IsZero() {
+		t.Errorf("expected no last modified time for an empty table, recieved %v %v", modified, err)
+	}
+
+	invalid := &models.Company{ID: "c1"}
+	if err := repo.Save(invalid); err == nil {
+		t.Error("expected a company without a name to be rejected")
+	}
+	if !invalid.Updated.IsZero() || len(client.tables["companies"]) != 0 {
+		t.Error("expected a rejected company to be left untouched and unsaved")
+	}
+
+	company := &models.Company{ID: "c1", Name: "Acme"}
+	if err := repo.Save(company); err != nil {
+		t.Fatal(err)
+	}
+	if company.Updated.IsZero() {
+		t.Error("expected Save to set Updated")
+	}
+	if _, ok := client.tables["companies"]["c1"]; !ok {
+		t.Error("expected the company to be saved")
+	}
+
+	modified, err = repo.LastModified()
+	if err != nil || !modified.Equal(company.Updated) {
+		t.Errorf("expected last modified %v, recieved %v %v", company.Updated, modified, err)
+	}
+
+	if err := repo.Update(&models.Company{ID: "missing", Name: "Nobody"}); err == nil {
+		t.Error("expected updating a missing company to fail")
+	}
+
+	time.Sleep(time.Millisecond)
+	if err := repo.Delete("c1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := client.tables["companies"]["c1"]; ok {
+		t.Error("expected the company to be deleted")
+	}
+
+	deleted, err := repo.LastModified()
+	if err != nil || !deleted.After(modified) {
+		t.Errorf("expected a delete to move the last modified time past %v, recieved %v %v", modified, deleted, err)
+	}
+
+	time.Sleep(time.Millisecond)
+	if err := repo.Delete("missing"); err != nil {
+		t.Errorf("expected deleting a missing company to succeed, recieved %v", err)
+	}
+	if after, _ := repo.LastModified(); !after.Equal(deleted) {
+		t.Errorf("expected deleting a missing company to keep the last modified time %v, recieved %v", deleted, after)
+	}
+}
+
+// TestScanAll_SkipsMarker verifies the list helpers never return a table's last modified marker.
+func TestScanAll_SkipsMarker(t *testing.T) {
+	client := newTableClient()
+	repo := NewCompanyDDBRepository(client)
+	if err := repo.Save(&models.Company{ID: "c1", Name: "Acme"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.tables["companies"]) != 2 {
+		t.Fatalf("expected the company and the marker, recieved %d items", len(client.tables["companies"]))
+	}
+
+	var scanned []models.Company
+	if err := scanAll(context.Background(), client, &dynamodb.ScanInput{TableName: aws.String("companies")}, &scanned); err != nil {
+		t.Fatal(err)
+	}
+	var queried []models.Company
+	err := queryAll(context.Background(), client, &dynamodb.QueryInput{
+		TableName:                 aws.String("companies"),
+		KeyConditionExpression:    aws.String("updated <= :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":now": &types.AttributeValueMemberS{Value: "9999"}},
+	}, 0, &queried)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scanned) != 1 || scanned[0].Name != "Acme" || len(queried) != 1 || queried[0].Name != "Acme" {
+		t.Errorf("expected only the company, recieved %+v and %+v", scanned, queried)
+	}
+}
+
+// TestLocationDDBRepository_Events verifies that location writes publish events for the location's company, and
+// that deleting a missing location publishes nothing.
+func TestLocationDDBRepository_Events(t *testing.T) {
+	client := newTableClient()
+	publisher := events.NewMemoryPublisher()
+	repo := NewLocationDDBRepository(client, publisher)
+
+	location := &models.Location{ID: "l1", CompanyID: "acme", RegionID: "r1", Name: "North Pit"}
+	if err := repo.Save(location); err != nil {
+		t.Fatal(err)
+	}
+	found, err := repo.FindByID("l1")
+	if err != nil || found == nil || found.CompanyID != "acme" || found.ID != "l1" {
+		t.Errorf("expected the saved location, recieved %+v %v", found, err)
+	}
+
+	if err := repo.Delete("missing"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete("l1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := client.tables["locations"]["l1"]; ok {
+		t.Error("expected the location to be deleted")
+	}
+
+	published := publisher.Events()
+	if len(published) != 2 || published[0].Type != events.LocationCreated || published[1].Type != events.LocationDeleted {
+		t.Fatalf("expected a created and a deleted event, recieved %+v", published)
+	}
+	if published[1].CompanyID != "acme" || published[1].Subject != "l1" {
+		t.Errorf("expected the deleted event to carry the location's company, recieved %+v", published[1])
+	}
+}
+
+// TestLocationDDBRepository_Outbox verifies location writes, the last modified marker and their events are
+// committed together or not at all.
+func TestLocationDDBRepository_Outbox(t *testing.T) {
+	client := newTableClient()
+	repo := NewLocationDDBRepository(client, NewOutboxDDBPublisher(client, "outbox"))
+
+	if err := repo.Save(&models.Location{ID: "l1", CompanyID: "acme", RegionID: "r1", Name: "North Pit"}); err != nil {
+		t.Fatal(err)
+	}
+	modified, _ := repo.LastModified()
+
+	client.failTable = "outbox"
+	if err := repo.Save(&models.Location{ID: "l2", CompanyID: "acme", RegionID: "r1", Name: "South Pit"}); err == nil {
+		t.Error("expected the save to fail with the outbox")
+	}
+	if err := repo.Delete("l1"); err == nil {
+		t.Error("expected the delete to fail with the outbox")
+	}
+	client.failTable = ""
+
+	if _, ok := client.tables["locations"]["l2"]; ok {
+		t.Error("expected the location not to be saved without its event")
+	}
+	if _, ok := client.tables["locations"]["l1"]; !ok {
+		t.Error("expected the location not to be deleted without its event")
+	}
+	if after, _ := repo.LastModified(); !after.Equal(modified) {
+		t.Errorf("expected the failed writes to leave the last modified time, recieved %s after %s", after, modified)
+	}
+
+	if err := repo.Delete("l1"); err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, item := range client.tables["outbox"] {
+		var o outboxItem
+		if err := attributevalue.UnmarshalMap(item, &o); err != nil {
+			t.Fatal(err)
+		}
+		if o.Subject != "l1" || o.CompanyID != "acme" {
+			t.Errorf("%s: expected an event for l1 of acme, recieved %+v", o.Type, o)
+		}
+		types = append(types, o.Type)
+	}
+	sort.Strings(types)
+	if !reflect.DeepEqual(types, []string{events.LocationCreated, events.LocationDeleted}) {
+		t.Errorf("expected only the created and deleted events, recieved %v", types)
+	}
+}
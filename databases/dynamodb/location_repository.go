@@ -1,7 +1,15 @@
 package dynamodb
 
 import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/babykittenz/api-micro-util/events"
 	"github.com/babykittenz/api-micro-util/models"
 	"github.com/babykittenz/api-micro-util/repository"
 )
@@ -10,23 +18,50 @@ import (
 // It utilizes a DynamoDB client and a specific table to perform CRUD operations on Location records.
 // The struct includes client for interaction with DynamoDB and tableName for specifying the target table.
 type LocationDDBRepository struct {
-	client    *dynamodb.Client
+	client    TransactDynamoDBAPI
 	tableName string
+	emitter
 }
 
 // NewLocationDDBRepository initializes a new LocationDDBRepository using a provided DynamoDB client.
 // It configures the repository to operate on the "locations" table.
-// Returns an implementation of the repository.LocationRepository interface.
-func NewLocationDDBRepository(client *dynamodb.Client) repository.LocationRepository {
+// Returns an implementation of the repository.LocationRepository interface. If a publisher is given, every write
+// publishes an events.LocationCreated, LocationUpdated or LocationDeleted event.
+func NewLocationDDBRepository(client TransactDynamoDBAPI, publisher ...events.Publisher) repository.LocationRepository {
 	return &LocationDDBRepository{
 		client:    client,
 		tableName: "locations",
+		emitter:   newEmitter(publisher),
 	}
 }
 
-// FindByID retrieves a Location record from the DynamoDB table using the specified ID. Returns the Location or an error.
+// FindByID retrieves a Location record from the DynamoDB table using the specified ID. Returns the Location, nil if
+// there is none, or an error.
 func (r *LocationDDBRepository) FindByID(id string) (*models.Location, error) {
-	return nil, nil
+	if id == lastModifiedID {
+		return nil, nil
+	}
+
+	result, err := r.client.GetItem(context.Background(), &dynamodb.GetItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get location from DynamoDB: %w", err)
+	}
+	if len(result.Item) == 0 {
+		return nil, nil
+	}
+
+	var location models.Location
+	if err := attributevalue.UnmarshalMap(result.Item, &location); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal location: %w", err)
+	}
+	location.ID = id
+	return &location, nil
 }
 
 // FindAll retrieves all Location records from the DynamoDB table. Returns a slice of Location pointers or an error.
@@ -46,15 +81,108 @@ func (r *LocationDDBRepository) FindAllByRegionID(id string) ([]*models.Location
 
 // Save stores or creates a new Location record in the DynamoDB table. Returns an error if the operation fails.
 func (r *LocationDDBRepository) Save(location *models.Location) error {
-	return nil
+	ctx := context.Background()
+
+	if err := location.Validate(); err != nil {
+		return err
+	}
+
+	// stamp a copy, so the caller's location only changes once it is written
+	now := time.Now().UTC()
+	stamped := *location
+	stamped.Updated = now
+	item, err := marshalItem(stamped.ID, &stamped)
+	if err != nil {
+		return err
+	}
+
+	err = r.write(ctx, putWrite(r.tableName, item, false), now, events.LocationCreated, &stamped)
+	if err != nil {
+		return fmt.Errorf("failed to save location in DynamoDB: %w", err)
+	}
+	location.Updated = now
+	return r.emitLocation(ctx, events.LocationCreated, location)
 }
 
 // Update modifies an existing Location record in the DynamoDB table. Returns an error if the operation fails.
 func (r *LocationDDBRepository) Update(location *models.Location) error {
-	return nil
+	ctx := context.Background()
+
+	if err := location.Validate(); err != nil {
+		return err
+	}
+
+	// stamp a copy, so the caller's location only changes once it is written
+	now := time.Now().UTC()
+	stamped := *location
+	stamped.Updated = now
+	item, err := marshalItem(stamped.ID, &stamped)
+	if err != nil {
+		return err
+	}
+
+	err = r.write(ctx, putWrite(r.tableName, item, true), now, events.LocationUpdated, &stamped)
+	if err != nil {
+		return fmt.Errorf("failed to update location in DynamoDB: %w", err)
+	}
+	location.Updated = now
+	return r.emitLocation(ctx, events.LocationUpdated, location)
 }
 
 // Delete removes a Location record from the DynamoDB table using the specified ID. Returns an error if the operation fails.
+// The location is read first, so the LocationDeleted event carries its company; deleting a location that does not
+// exist does nothing and publishes no event.
 func (r *LocationDDBRepository) Delete(id string) error {
-	return nil
+	ctx := context.Background()
+
+	location, err := r.FindByID(id)
+	if err != nil {
+		return err
+	}
+	if location == nil {
+		return nil
+	}
+
+	err = r.write(ctx, deleteWrite(r.tableName, id, true), time.Now(), events.LocationDeleted, location)
+	if conditionFailed(err) {
+		// deleted by someone else since it was read, who published the event
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete location from DynamoDB: %w", err)
+	}
+	return r.emitLocation(ctx, events.LocationDeleted, location)
+}
+
+// write commits write with the last modified marker. If events go to an outbox, an event of eventType with the
+// location is committed in the same transaction; otherwise emitLocation publishes it once the write succeeded.
+func (r *LocationDDBRepository) write(ctx context.Context, write types.TransactWriteItem, now time.Time, eventType string, location *models.Location) error {
+	outbox, ok := r.outbox()
+	if !ok {
+		return writeModified(ctx, r.client, r.tableName, write, now)
+	}
+
+	writes, err := modifiedWrites(r.tableName, write, now)
+	if err != nil {
+		return err
+	}
+	event, err := events.New(eventType, location.ID, location.CompanyID, location)
+	if err != nil {
+		return err
+	}
+	return outbox.Transact(ctx, writes, event)
+}
+
+// emitLocation publishes an event of eventType with the location after a write, unless write already committed it
+// to an outbox.
+func (r *LocationDDBRepository) emitLocation(ctx context.Context, eventType string, location *models.Location) error {
+	if _, ok := r.outbox(); ok {
+		return nil
+	}
+	return r.emit(ctx, eventType, location.ID, location.CompanyID, location)
+}
+
+// LastModified returns the most recent updated time of all Location records in the DynamoDB table.
+func (r *LocationDDBRepository) LastModified() (time.Time, error) {
+	return lastModified(context.Background(), r.client, r.tableName)
 }
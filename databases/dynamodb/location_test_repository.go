@@ -1,6 +1,8 @@
 package dynamodb
 
 import (
+	"time"
+
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/babykittenz/api-micro-util/models"
 	"github.com/babykittenz/api-micro-util/repository"
@@ -50,3 +52,8 @@ func (r *testLocationDDBRepository) Update(location *models.Location) error {
 func (r *testLocationDDBRepository) Delete(id string) error {
 	return nil
 }
+
+// LastModified returns the time the records were last modified. Returns a zero time if unknown.
+func (r *testLocationDDBRepository) LastModified() (time.Time, error) {
+	return time.Time{}, nil
+}
@@ -0,0 +1,52 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	toolkit "github.com/babykittenz/api-micro-util"
+	"github.com/babykittenz/api-micro-util/middleware"
+)
+
+// NonceDDBStore is a middleware.NonceStore that records used nonces in DynamoDB, so a single use link works once
+// across every Lambda instance. Each nonce is one item keyed by id, written only if it does not exist yet. Items get
+// an expires attribute, which can be used as the table's TTL attribute to clean up nonces of expired links.
+type NonceDDBStore struct {
+	client    toolkit.DynamoDBAPI
+	tableName string
+}
+
+// NewNonceDDBStore creates a nonce store using the given DynamoDB client and table.
+func NewNonceDDBStore(client toolkit.DynamoDBAPI, tableName string) middleware.NonceStore {
+	return &NonceDDBStore{
+		client:    client,
+		tableName: tableName,
+	}
+}
+
+// Use records nonce, and reports false if it was already recorded.
+func (s *NonceDDBStore) Use(ctx context.Context, nonce string, expires time.Time) (bool, error) {
+	_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.tableName),
+		Item: map[string]types.AttributeValue{
+			"id":      &types.AttributeValueMemberS{Value: "nonce:" + nonce},
+			"expires": &types.AttributeValueMemberN{Value: strconv.FormatInt(expires.Unix(), 10)},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(id)"),
+	})
+
+	var used *types.ConditionalCheckFailedException
+	if errors.As(err, &used) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to save nonce to DynamoDB: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,26 @@
+package dynamodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// TestNonceDDBStore verifies a nonce can only be used once, even through another store instance.
+func TestNonceDDBStore(t *testing.T) {
+	client := &bucketTableClient{items: make(map[string]map[string]types.AttributeValue)}
+	ctx := context.Background()
+	expires := time.Now().Add(time.Hour)
+
+	unused, err := NewNonceDDBStore(client, "signed_urls").Use(ctx, "abc123", expires)
+	if err != nil || !unused {
+		t.Fatalf("expected the first use to succeed: %v %v", unused, err)
+	}
+
+	unused, err = NewNonceDDBStore(client, "signed_urls").Use(ctx, "abc123", expires)
+	if err != nil || unused {
+		t.Errorf("expected the second use to be refused: %v %v", unused, err)
+	}
+}
@@ -0,0 +1,153 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/babykittenz/api-micro-util/events"
+)
+
+// Statuses of the events in an outbox table.
+const (
+	OutboxStatusPending   = "pending"
+	OutboxStatusPublished = "published"
+)
+
+// OutboxPendingIndex is the name of the global secondary index an OutboxRelay queries for pending events. Its
+// partition key is the string attribute "pending" and its sort key the number attribute "pending_at". Only pending
+// events carry them, so the index is sparse and holds just the events still to be relayed.
+const OutboxPendingIndex = "pending-index"
+
+// outboxItem is an event as it is stored in an outbox table. The data is kept as a JSON string, so it reads back
+// exactly as it was published. Times the relay compares are stored as Unix seconds.
+type outboxItem struct {
+	ID        string    `dynamodbav:"id"`
+	Type      string    `dynamodbav:"type"`
+	Source    string    `dynamodbav:"source,omitempty"`
+	Subject   string    `dynamodbav:"subject"`
+	CompanyID string    `dynamodbav:"company_id,omitempty"`
+	Time      time.Time `dynamodbav:"time"`
+	Data      string    `dynamodbav:"data,omitempty"`
+	Status    string    `dynamodbav:"status"`
+	// Pending and PendingAt, the event time in Unix nanoseconds, key the pending index until the event is published
+	Pending   string `dynamodbav:"pending,omitempty"`
+	PendingAt int64  `dynamodbav:"pending_at,omitempty"`
+	// LeaseUntil hides the event from relays until it passes. It starts at the time of the event
+	LeaseUntil time.Time `dynamodbav:"lease_until,unixtime"`
+	Attempts   int       `dynamodbav:"attempts"`
+	LastError  string    `dynamodbav:"last_error,omitempty"`
+}
+
+// newOutboxItem returns the pending outbox item for e.
+func newOutboxItem(e events.Event) outboxItem {
+	return outboxItem{
+		ID:         e.ID,
+		Type:       e.Type,
+		Source:     e.Source,
+		Subject:    e.Subject,
+		CompanyID:  e.CompanyID,
+		Time:       e.Time,
+		Data:       string(e.Data),
+		Status:     OutboxStatusPending,
+		Pending:    OutboxStatusPending,
+		PendingAt:  e.Time.UnixNano(),
+		LeaseUntil: e.Time,
+	}
+}
+
+// event returns the event stored in the item.
+func (i outboxItem) event() events.Event {
+	e := events.Event{
+		ID:        i.ID,
+		Type:      i.Type,
+		Source:    i.Source,
+		Subject:   i.Subject,
+		CompanyID: i.CompanyID,
+		Time:      i.Time,
+	}
+	if i.Data != "" {
+		e.Data = []byte(i.Data)
+	}
+	return e
+}
+
+// OutboxDDBPublisher is an events.Publisher that stores events in a DynamoDB outbox table with the status "pending",
+// for an OutboxRelay to send on to subscribers. Publishing only needs DynamoDB to be available, so events are not lost
+// when the downstream service is down. Each event is one item keyed by its ID, written only if it does not exist yet,
+// so publishing an event twice stores it once.
+//
+// Repositories given an OutboxDDBPublisher write their changes and events together with Transact, so an event is
+// stored if and only if its change is.
+type OutboxDDBPublisher struct {
+	client    TransactDynamoDBAPI
+	tableName string
+}
+
+// Transactor is a publisher that commits events in one transaction with the writes they describe, such as an
+// OutboxDDBPublisher. Repositories given a Transactor use Transact for every write instead of publishing after it,
+// so a publisher wrapping an OutboxDDBPublisher, e.g. to add logging, should implement Transactor by passing the
+// call on to keep that guarantee.
+type Transactor interface {
+	events.Publisher
+	Transact(ctx context.Context, writes []types.TransactWriteItem, events ...events.Event) error
+}
+
+// NewOutboxDDBPublisher creates an outbox publisher using the given DynamoDB client and table. The returned
+// publisher is a Transactor.
+func NewOutboxDDBPublisher(client TransactDynamoDBAPI, tableName string) events.Publisher {
+	return &OutboxDDBPublisher{
+		client:    client,
+		tableName: tableName,
+	}
+}
+
+// Publish stores each event in the outbox table.
+func (p *OutboxDDBPublisher) Publish(ctx context.Context, events ...events.Event) error {
+	for _, e := range events {
+		item, err := attributevalue.MarshalMap(newOutboxItem(e))
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s event: %w", e.Type, err)
+		}
+
+		_, err = p.client.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName:           aws.String(p.tableName),
+			Item:                item,
+			ConditionExpression: aws.String("attribute_not_exists(id)"),
+		})
+
+		var exists *types.ConditionalCheckFailedException
+		if err != nil && !errors.As(err, &exists) {
+			return fmt.Errorf("failed to save %s event to DynamoDB: %w", e.Type, err)
+		}
+	}
+	return nil
+}
+
+// Transact commits writes and the events in one TransactWriteItems call, so the events are stored if and only if
+// every write is made. A transaction holds at most 100 items, writes and events together.
+func (p *OutboxDDBPublisher) Transact(ctx context.Context, writes []types.TransactWriteItem, events ...events.Event) error {
+	items := append([]types.TransactWriteItem(nil), writes...)
+	for _, e := range events {
+		item, err := attributevalue.MarshalMap(newOutboxItem(e))
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s event: %w", e.Type, err)
+		}
+		items = append(items, types.TransactWriteItem{Put: &types.Put{
+			TableName:           aws.String(p.tableName),
+			Item:                item,
+			ConditionExpression: aws.String("attribute_not_exists(id)"),
+		}})
+	}
+
+	_, err := p.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if err != nil {
+		return fmt.Errorf("failed to write transaction to DynamoDB: %w", err)
+	}
+	return nil
+}
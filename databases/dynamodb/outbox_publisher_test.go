@@ -0,0 +1,43 @@
+package dynamodb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/babykittenz/api-micro-util/events"
+)
+
+// TestOutboxDDBPublisher verifies events are stored as pending items that read back unchanged, and only once.
+func TestOutboxDDBPublisher(t *testing.T) {
+	client := newTableClient()
+	publisher := NewOutboxDDBPublisher(client, "outbox")
+	ctx := context.Background()
+
+	e, err := events.New(events.LocationUpdated, "l1", "acme", map[string]string{"name": "North Pit"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := publisher.Publish(ctx, e); err != nil {
+		t.Fatal(err)
+	}
+	// a retry of the same event is not an error, and not stored again
+	if err := publisher.Publish(ctx, e); err != nil {
+		t.Errorf("expected publishing an event twice to succeed: %v", err)
+	}
+	if len(client.tables["outbox"]) != 1 {
+		t.Fatalf("expected 1 item, recieved %d", len(client.tables["outbox"]))
+	}
+
+	var item outboxItem
+	if err := attributevalue.UnmarshalMap(client.tables["outbox"][e.ID], &item); err != nil {
+		t.Fatal(err)
+	}
+	if item.Status != OutboxStatusPending || item.Pending != OutboxStatusPending || item.PendingAt != e.Time.UnixNano() {
+		t.Errorf("expected a pending event in the pending index, recieved %+v", item)
+	}
+	stored := item.event()
+	if stored.Type != e.Type || stored.Subject != e.Subject || stored.CompanyID != e.CompanyID || !stored.Time.Equal(e.Time) || string(stored.Data) != string(e.Data) {
+		t.Errorf("expected %+v, recieved %+v", e, stored)
+	}
+}
@@ -0,0 +1,226 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	toolkit "github.com/babykittenz/api-micro-util"
+	"github.com/babykittenz/api-micro-util/events"
+	"github.com/babykittenz/api-micro-util/streams"
+)
+
+// OutboxRelay drains an outbox table written by an OutboxDDBPublisher, sending each pending event to a publisher such
+// as an events.EventBridgePublisher. Delivery is at least once: an event is marked published only after the
+// publisher accepts it, so an event may be sent again if the relay stops in between. The event ID stays the same
+// every time, so subscribers can use it to ignore duplicates.
+//
+// Several relays may run at once; each event is leased to one relay while it is published. Pending events are found
+// through the OutboxPendingIndex, which the outbox table must have. Published events leave the index and are kept
+// with an expires attribute, which can be used as the table's TTL attribute to clean them up.
+type OutboxRelay struct {
+	client    toolkit.DynamoDBAPI
+	tableName string
+	publisher events.Publisher
+	// Lease is how long an event is hidden from other relays while it is published, and how long a failed event waits
+	// before it is retried. Defaults to one minute.
+	Lease time.Duration
+	// Retention is how long published events are kept. Defaults to seven days.
+	Retention time.Duration
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+	// pageSize is the number of pending events read from the index at a time
+	pageSize int32
+}
+
+// NewOutboxRelay returns a relay sending the events in the outbox table to publisher.
+func NewOutboxRelay(client toolkit.DynamoDBAPI, tableName string, publisher events.Publisher) *OutboxRelay {
+	return &OutboxRelay{
+		client:    client,
+		tableName: tableName,
+		publisher: publisher,
+		Lease:     time.Minute,
+		Retention: 7 * 24 * time.Hour,
+		Now:       time.Now,
+		pageSize:  100,
+	}
+}
+
+// Relay publishes up to limit pending events, oldest first, and returns how many were published. It is meant to be
+// run on a schedule. While an event about a record is leased, because it failed or another relay is publishing it,
+// later events about the same record are left for the next run, so subscribers see the events of a record in order.
+// The pending index is read a page at a time, oldest first, and only until limit events are published.
+func (r *OutboxRelay) Relay(ctx context.Context, limit int) (int, error) {
+	now := r.Now().UTC()
+
+	// leased events are read too, as they hold back the later events of their record
+	paginator := dynamodb.NewQueryPaginator(r.client, &dynamodb.QueryInput{
+		TableName:                aws.String(r.tableName),
+		IndexName:                aws.String(OutboxPendingIndex),
+		KeyConditionExpression:   aws.String("#pending = :pending"),
+		ExpressionAttributeNames: map[string]string{"#pending": "pending"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pending": &types.AttributeValueMemberS{Value: OutboxStatusPending},
+		},
+		ScanIndexForward: aws.Bool(true),
+		Limit:            aws.Int32(r.pageSize),
+	})
+
+	published := 0
+	// held outlives the page, as a leased event holds back later events of its record on the pages after it
+	held := make(map[string]bool)
+	var errs []error
+	for paginator.HasMorePages() && (limit <= 0 || published < limit) {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to find pending events: %w", err))
+			break
+		}
+		var pending []outboxItem
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pending); err != nil {
+			errs = append(errs, fmt.Errorf("failed to unmarshal pending events: %w", err))
+			break
+		}
+
+		for _, item := range pending {
+			if err := ctx.Err(); err != nil {
+				return published, err
+			}
+			if limit > 0 && published >= limit {
+				break
+			}
+			if held[item.Subject] {
+				continue
+			}
+			if item.LeaseUntil.After(now) {
+				held[item.Subject] = true
+				continue
+			}
+
+			ok, err := r.relay(ctx, item, now)
+			if err != nil {
+				held[item.Subject] = true
+				errs = append(errs, err)
+			}
+			if ok {
+				published++
+			}
+		}
+	}
+	return published, errors.Join(errs...)
+}
+
+// HandleRecord relays the event in a stream record of the outbox table, so the outbox can be drained as soon as it
+// is written by a Lambda subscribed to the table's stream:
+//
+//	consumer.HandleFunc("outbox", relay.HandleRecord)
+//
+// Only inserted events are relayed. An event is left for a scheduled Relay while an earlier event about the same
+// record is still pending, so the events of a record are sent in order. An event that fails is leased, and left for a
+// scheduled Relay to retry.
+func (r *OutboxRelay) HandleRecord(ctx context.Context, record streams.Record) error {
+	if record.EventName != streams.Insert || record.NewImage == nil {
+		return nil
+	}
+
+	var item outboxItem
+	if err := attributevalue.UnmarshalMap(record.NewImage, &item); err != nil {
+		return fmt.Errorf("failed to unmarshal outbox item: %w", err)
+	}
+	if item.Status != OutboxStatusPending {
+		return nil
+	}
+
+	held, err := r.heldBack(ctx, item)
+	if err != nil || held {
+		return err
+	}
+
+	_, err = r.relay(ctx, item, r.Now().UTC())
+	return err
+}
+
+// heldBack reports whether an event earlier than item about the same record is still pending, whether it is leased
+// or waiting to be relayed.
+func (r *OutboxRelay) heldBack(ctx context.Context, item outboxItem) (bool, error) {
+	var earlier []outboxItem
+	err := queryAll(ctx, r.client, &dynamodb.QueryInput{
+		TableName:                aws.String(r.tableName),
+		IndexName:                aws.String(OutboxPendingIndex),
+		KeyConditionExpression:   aws.String("#pending = :pending AND pending_at < :at"),
+		FilterExpression:         aws.String("subject = :subject"),
+		ExpressionAttributeNames: map[string]string{"#pending": "pending"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pending": &types.AttributeValueMemberS{Value: OutboxStatusPending},
+			":at":      &types.AttributeValueMemberN{Value: strconv.FormatInt(item.PendingAt, 10)},
+			":subject": &types.AttributeValueMemberS{Value: item.Subject},
+		},
+	}, 0, &earlier)
+	if err != nil {
+		return false, fmt.Errorf("failed to find earlier events about %s: %w", item.Subject, err)
+	}
+	return len(earlier) > 0, nil
+}
+
+// relay claims a pending event, publishes it and marks it published. It reports false without an error if another
+// relay claimed the event first.
+func (r *OutboxRelay) relay(ctx context.Context, item outboxItem, now time.Time) (bool, error) {
+	key := map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: item.ID}}
+
+	// claim the event by moving its lease on from the value read, so only one relay wins
+	_, err := r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                aws.String(r.tableName),
+		Key:                      key,
+		UpdateExpression:         aws.String("SET lease_until = :until, attempts = :attempts"),
+		ConditionExpression:      aws.String("#status = :pending AND lease_until = :lease"),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":until":    &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(r.Lease).Unix(), 10)},
+			":attempts": &types.AttributeValueMemberN{Value: strconv.Itoa(item.Attempts + 1)},
+			":pending":  &types.AttributeValueMemberS{Value: OutboxStatusPending},
+			":lease":    &types.AttributeValueMemberN{Value: strconv.FormatInt(item.LeaseUntil.Unix(), 10)},
+		},
+	})
+	var claimed *types.ConditionalCheckFailedException
+	if errors.As(err, &claimed) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to claim %s event %s: %w", item.Type, item.ID, err)
+	}
+
+	if err := r.publisher.Publish(ctx, item.event()); err != nil {
+		// the lease holds the event back until it is retried; the error is kept for inspection
+		_, updateErr := r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:        aws.String(r.tableName),
+			Key:              key,
+			UpdateExpression: aws.String("SET last_error = :error"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":error": &types.AttributeValueMemberS{Value: err.Error()},
+			},
+		})
+		return false, errors.Join(fmt.Errorf("failed to publish %s event %s: %w", item.Type, item.ID, err), updateErr)
+	}
+
+	_, err = r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                aws.String(r.tableName),
+		Key:                      key,
+		UpdateExpression:         aws.String("SET #status = :published, expires = :expires REMOVE #pending, pending_at"),
+		ExpressionAttributeNames: map[string]string{"#status": "status", "#pending": "pending"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":published": &types.AttributeValueMemberS{Value: OutboxStatusPublished},
+			":expires":   &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(r.Retention).Unix(), 10)},
+		},
+	})
+	if err != nil {
+		// the event was published, and will be again once its lease runs out
+		return true, fmt.Errorf("failed to mark %s event %s published: %w", item.Type, item.ID, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,367 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/babykittenz/api-micro-util/events"
+	"github.com/babykittenz/api-micro-util/models"
+	"github.com/babykittenz/api-micro-util/streams"
+)
+
+// TestTraineeDDBRepository_Outbox verifies trainee writes and their events are committed together or not at all.
+func TestTraineeDDBRepository_Outbox(t *testing.T) {
+	client := newTableClient()
+	repo := NewTraineeDDBRepository(client, "trainees", NewOutboxDDBPublisher(client, "outbox"))
+
+	trainee := &models.Trainee{ID: "t1", FirstName: "Jane", LastName: "Doe", VisitorType: "guest", CompanyID: "acme"}
+	if err := repo.Save(trainee); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Checkin("t1"); err != nil {
+		t.Fatal(err)
+	}
+
+	client.failTable = "outbox"
+	other := &models.Trainee{ID: "t2", FirstName: "John", LastName: "Doe", VisitorType: "guest", CompanyID: "acme"}
+	if err := repo.Save(other); err == nil {
+		t.Error("expected the save to fail with the outbox")
+	}
+	client.failTable = ""
+
+	if _, ok := client.tables["trainees"]["t2"]; ok {
+		t.Error("expected the trainee not to be saved without its event")
+	}
+
+	var types []string
+	for _, item := range client.tables["outbox"] {
+		var o outboxItem
+		if err := attributevalue.UnmarshalMap(item, &o); err != nil {
+			t.Fatal(err)
+		}
+		var data models.Trainee
+		if err := o.event().Decode(&data); err != nil || data.ID != "t1" {
+			t.Errorf("%s: expected the trainee in the event, recieved %+v %v", o.Type, data, err)
+		}
+		if o.Type == events.TraineeCheckedIn && !data.CheckedIn {
+			t.Errorf("%s: expected the trainee to be checked in", o.Type)
+		}
+		types = append(types, o.Type)
+	}
+	if len(types) != 2 {
+		t.Errorf("expected created and checked in events, recieved %v", types)
+	}
+}
+
+// TestTraineeDDBRepository_OutboxUpserts verifies updates of a missing trainee create it in outbox mode as they do
+// when events are published after the write.
+func TestTraineeDDBRepository_OutboxUpserts(t *testing.T) {
+	tests := []struct {
+		name   string
+		outbox bool
+	}{
+		{name: "publisher", outbox: false},
+		{name: "outbox", outbox: true},
+	}
+
+	for _, tt := range tests {
+		client := newTableClient()
+		publisher := events.NewMemoryPublisher()
+		repo := NewTraineeDDBRepository(client, "trainees", publisher)
+		if tt.outbox {
+			repo = NewTraineeDDBRepository(client, "trainees", NewOutboxDDBPublisher(client, "outbox"))
+		}
+
+		if err := repo.Checkin("missing"); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		trainee, err := decodeTrainee(client.tables["trainees"]["missing"])
+		if err != nil || trainee.ID != "missing" || !trainee.CheckedIn {
+			t.Errorf("%s: expected the check-in to create the trainee, recieved %+v %v", tt.name, trainee, err)
+		}
+
+		published := publisher.Events()
+		for _, item := range client.tables["outbox"] {
+			var o outboxItem
+			_ = attributevalue.UnmarshalMap(item, &o)
+			published = append(published, o.event())
+		}
+		var data models.Trainee
+		if len(published) != 1 || published[0].Decode(&data) != nil || data.ID != "missing" || !data.CheckedIn {
+			t.Errorf("%s: expected one checked in event with the new trainee, recieved %v %+v", tt.name, published, data)
+		}
+	}
+}
+
+// racingClient makes a write to the trainee between the first read of it and the transaction that follows.
+type racingClient struct {
+	*tableClient
+	reads int
+	race  func()
+}
+
+func (c *racingClient) GetItem(ctx context.Context, params *ddb.GetItemInput, optFns ...func(*ddb.Options)) (*ddb.GetItemOutput, error) {
+	out, err := c.tableClient.GetItem(ctx, params, optFns...)
+	if c.reads++; c.reads == 1 {
+		c.race()
+	}
+	return out, err
+}
+
+// TestTraineeDDBRepository_OutboxRace verifies an update in outbox mode is not committed with an event built from a
+// read that a concurrent write has made stale, and is retried with a fresh read.
+func TestTraineeDDBRepository_OutboxRace(t *testing.T) {
+	client := &racingClient{tableClient: newTableClient()}
+	repo := NewTraineeDDBRepository(client, "trainees", NewOutboxDDBPublisher(client, "outbox"))
+	other := NewTraineeDDBRepository(client.tableClient, "trainees")
+
+	if err := repo.Save(&models.Trainee{ID: "t1", FirstName: "Jane", LastName: "Doe", VisitorType: "guest"}); err != nil {
+		t.Fatal(err)
+	}
+	client.race = func() {
+		if err := other.CompleteTraining("t1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.Checkin("t1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if client.reads != 2 {
+		t.Errorf("expected the trainee to be read again after the race, recieved %d reads", client.reads)
+	}
+	for _, item := range client.tables["outbox"] {
+		var o outboxItem
+		_ = attributevalue.UnmarshalMap(item, &o)
+		var data models.Trainee
+		_ = o.event().Decode(&data)
+		if o.Type == events.TraineeCheckedIn && (!data.CheckedIn || data.LastTraining == "") {
+			t.Errorf("expected the event to include the concurrent write, recieved %+v", data)
+		}
+	}
+}
+
+// wrappedOutbox is a publisher wrapping an outbox, passing Transact on as a Transactor.
+type wrappedOutbox struct {
+	Transactor
+	published int
+}
+
+func (w *wrappedOutbox) Publish(ctx context.Context, evs ...events.Event) error {
+	w.published += len(evs)
+	return w.Transactor.Publish(ctx, evs...)
+}
+
+// TestTraineeDDBRepository_Transactor verifies a publisher wrapping an outbox still commits writes with their events.
+func TestTraineeDDBRepository_Transactor(t *testing.T) {
+	client := newTableClient()
+	outbox := &wrappedOutbox{Transactor: NewOutboxDDBPublisher(client, "outbox").(Transactor)}
+	repo := NewTraineeDDBRepository(client, "trainees", outbox)
+
+	client.failTable = "outbox"
+	if err := repo.Save(&models.Trainee{ID: "t1", FirstName: "Jane", LastName: "Doe", VisitorType: "guest"}); err == nil {
+		t.Error("expected the save to fail with the outbox")
+	}
+	if _, ok := client.tables["trainees"]["t1"]; ok || outbox.published != 0 {
+		t.Errorf("expected the write to go through the transaction, recieved %d events published after it", outbox.published)
+	}
+}
+
+// TestOutboxRelay verifies events are published in order, retried after a failure and marked published.
+func TestOutboxRelay(t *testing.T) {
+	client := newTableClient()
+	outbox := NewOutboxDDBPublisher(client, "outbox")
+	ctx := context.Background()
+
+	start := time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)
+	var queued []events.Event
+	for i, subject := range []string{"t1", "t2", "t1"} {
+		e, _ := events.New(events.TraineeCheckedIn, subject, "acme", nil)
+		e.Time = start.Add(time.Duration(i) * time.Second)
+		queued = append(queued, e)
+	}
+	if err := outbox.Publish(ctx, queued[2], queued[0], queued[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	var published []string
+	failures := 1
+	publisher := events.PublisherFunc(func(ctx context.Context, evs ...events.Event) error {
+		if evs[0].Subject == "t1" && failures > 0 {
+			failures--
+			return errors.New("event bus is down")
+		}
+		for _, e := range evs {
+			published = append(published, e.ID)
+		}
+		return nil
+	})
+
+	now := start.Add(time.Minute)
+	relay := NewOutboxRelay(client, "outbox", publisher)
+	relay.Now = func() time.Time { return now }
+
+	// t1 fails, so its second event waits behind the first
+	n, err := relay.Relay(ctx, 10)
+	if err == nil || n != 1 || !reflect.DeepEqual(published, []string{queued[1].ID}) {
+		t.Errorf("expected only t2 to be published, recieved %d %v %v", n, published, err)
+	}
+
+	// the failed event is leased, so it is not retried straight away
+	if n, err := relay.Relay(ctx, 10); n != 0 || err != nil {
+		t.Errorf("expected nothing to be published during the lease, recieved %d %v", n, err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if n, err := relay.Relay(ctx, 10); n != 2 || err != nil {
+		t.Errorf("expected both t1 events to be published, recieved %d %v", n, err)
+	}
+	if !reflect.DeepEqual(published, []string{queued[1].ID, queued[0].ID, queued[2].ID}) {
+		t.Errorf("expected events in order, recieved %v", published)
+	}
+
+	var item outboxItem
+	_ = attributevalue.UnmarshalMap(client.tables["outbox"][queued[0].ID], &item)
+	if item.Status != OutboxStatusPublished || item.Attempts != 2 || item.LastError == "" {
+		t.Errorf("expected a published event after 2 attempts, recieved %+v", item)
+	}
+	if item.Pending != "" || item.PendingAt != 0 {
+		t.Errorf("expected a published event to leave the pending index, recieved %+v", item)
+	}
+	if client.scans != 0 {
+		t.Errorf("expected the pending index to be queried, recieved %d scans", client.scans)
+	}
+}
+
+// TestOutboxRelay_HandleRecord verifies the events inserted in the outbox stream are published once.
+// TestOutboxRelay_Pages verifies Relay reads the pending index only until limit events are published, and that an
+// event leased on one page holds back the later events of its record on the next.
+func TestOutboxRelay_Pages(t *testing.T) {
+	client := newTableClient()
+	ctx := context.Background()
+
+	start := time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)
+	var queued []events.Event
+	for i, subject := range []string{"t1", "t2", "t3", "t1", "t4"} {
+		e, _ := events.New(events.TraineeCheckedIn, subject, "acme", nil)
+		e.Time = start.Add(time.Duration(i) * time.Second)
+		queued = append(queued, e)
+	}
+	if err := NewOutboxDDBPublisher(client, "outbox").Publish(ctx, queued...); err != nil {
+		t.Fatal(err)
+	}
+	// the first t1 event is being published by another relay
+	client.tables["outbox"][queued[0].ID]["lease_until"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(start.Add(2*time.Hour).Unix(), 10)}
+
+	var published []string
+	relay := NewOutboxRelay(client, "outbox", events.PublisherFunc(func(ctx context.Context, evs ...events.Event) error {
+		for _, e := range evs {
+			published = append(published, e.ID)
+		}
+		return nil
+	}))
+	relay.Now = func() time.Time { return start.Add(time.Hour) }
+	relay.pageSize = 2
+
+	if n, err := relay.Relay(ctx, 1); n != 1 || err != nil || client.queries != 1 {
+		t.Errorf("expected 1 event published from the first page, recieved %d from %d pages: %v", n, client.queries, err)
+	}
+
+	// the pages are now the leased t1 event and t3, then the later t1 event and t4
+	client.queries = 0
+	if n, err := relay.Relay(ctx, 0); n != 2 || err != nil || client.queries != 2 {
+		t.Errorf("expected 2 events published from 2 pages, recieved %d from %d: %v", n, client.queries, err)
+	}
+	expected := []string{queued[1].ID, queued[2].ID, queued[4].ID}
+	if !reflect.DeepEqual(published, expected) {
+		t.Errorf("expected %v published, recieved %v", expected, published)
+	}
+	if _, ok := client.tables["outbox"][queued[3].ID]["pending"]; !ok {
+		t.Error("expected the later t1 event to stay pending behind the leased one")
+	}
+}
+
+func TestOutboxRelay_HandleRecord(t *testing.T) {
+	client := newTableClient()
+	var published int
+	relay := NewOutboxRelay(client, "outbox", events.PublisherFunc(func(ctx context.Context, evs ...events.Event) error {
+		published += len(evs)
+		return nil
+	}))
+
+	e, _ := events.New(events.LocationUpdated, "l1", "acme", nil)
+	if err := NewOutboxDDBPublisher(client, "outbox").Publish(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+	record := streams.Record{EventName: streams.Insert, Table: "outbox", NewImage: client.tables["outbox"][e.ID]}
+
+	consumer := streams.NewConsumer()
+	consumer.HandleFunc("outbox", relay.HandleRecord)
+	// the same record delivered twice is only published once
+	if _, err := consumer.Process(context.Background(), []streams.Record{record, record}); err != nil {
+		t.Fatal(err)
+	}
+	if published != 1 {
+		t.Errorf("expected 1 event published, recieved %d", published)
+	}
+}
+
+// TestOutboxRelay_HandleRecordOrder verifies a stream record is left for Relay while an earlier event about the same
+// record is pending, leased or not, but not for earlier events about other records.
+func TestOutboxRelay_HandleRecordOrder(t *testing.T) {
+	client := newTableClient()
+	outbox := NewOutboxDDBPublisher(client, "outbox")
+	ctx := context.Background()
+
+	start := time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)
+	var queued []events.Event
+	for i, subject := range []string{"t1", "t2", "t1"} {
+		e, _ := events.New(events.TraineeCheckedIn, subject, "acme", nil)
+		e.Time = start.Add(time.Duration(i) * time.Second)
+		queued = append(queued, e)
+	}
+	if err := outbox.Publish(ctx, queued...); err != nil {
+		t.Fatal(err)
+	}
+	// the first t1 event is leased by a relay that is still publishing it
+	lease := NewOutboxRelay(client, "outbox", events.PublisherFunc(func(ctx context.Context, evs ...events.Event) error {
+		return errors.New("event bus is down")
+	}))
+	lease.Now = func() time.Time { return start.Add(time.Minute) }
+	_, _ = lease.relay(ctx, newOutboxItem(queued[0]), lease.Now())
+
+	var published []string
+	relay := NewOutboxRelay(client, "outbox", events.PublisherFunc(func(ctx context.Context, evs ...events.Event) error {
+		for _, e := range evs {
+			published = append(published, e.ID)
+		}
+		return nil
+	}))
+	relay.Now = lease.Now
+
+	consumer := streams.NewConsumer()
+	consumer.HandleFunc("outbox", relay.HandleRecord)
+	var records []streams.Record
+	for _, e := range queued[1:] {
+		records = append(records, streams.Record{EventID: e.ID, EventName: streams.Insert, Table: "outbox", NewImage: client.tables["outbox"][e.ID]})
+	}
+	if _, err := consumer.Process(ctx, records); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(published, []string{queued[1].ID}) {
+		t.Errorf("expected only t2 to be published, recieved %v", published)
+	}
+
+	var item outboxItem
+	_ = attributevalue.UnmarshalMap(client.tables["outbox"][queued[2].ID], &item)
+	if item.Status != OutboxStatusPending || item.Attempts != 0 {
+		t.Errorf("expected the later t1 event to be left pending, recieved %+v", item)
+	}
+}
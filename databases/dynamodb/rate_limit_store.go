@@ -0,0 +1,107 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	toolkit "github.com/babykittenz/api-micro-util"
+	"github.com/babykittenz/api-micro-util/middleware"
+)
+
+// rateLimitAttempts is the number of times a bucket update is retried when another writer got there first.
+const rateLimitAttempts = 5
+
+// RateLimitDDBStore is a middleware.RateLimitStore that keeps token buckets in DynamoDB, so limits hold across
+// every Lambda instance. Each bucket is one item keyed by id, updated with optimistic locking on a version counter,
+// as two writes can share the same updated time. Items get an expires attribute, which can be used as the table's TTL attribute to clean up old buckets.
+type RateLimitDDBStore struct {
+	client    toolkit.DynamoDBAPI
+	tableName string
+}
+
+// NewRateLimitDDBStore creates a rate limit store using the given DynamoDB client and table.
+func NewRateLimitDDBStore(client toolkit.DynamoDBAPI, tableName string) middleware.RateLimitStore {
+	return &RateLimitDDBStore{
+		client:    client,
+		tableName: tableName,
+	}
+}
+
+// Take takes a token from the bucket for key. If other writers keep changing the bucket it gives up with a denial
+// and middleware.ErrRateLimitContended, which RateLimit answers with a 429.
+func (s *RateLimitDDBStore) Take(ctx context.Context, key string, limit middleware.Limit, now time.Time) (middleware.RateLimitResult, error) {
+	for attempt := 0; attempt < rateLimitAttempts; attempt++ {
+		result, err := s.take(ctx, key, limit, now)
+		var conflict *types.ConditionalCheckFailedException
+		if errors.As(err, &conflict) {
+			continue
+		}
+		return result, err
+	}
+	return middleware.ContendedResult(limit), fmt.Errorf("%w: %s", middleware.ErrRateLimitContended, key)
+}
+
+// take reads the bucket, applies middleware.TakeToken and writes it back if nobody else changed it meanwhile.
+func (s *RateLimitDDBStore) take(ctx context.Context, key string, limit middleware.Limit, now time.Time) (middleware.RateLimitResult, error) {
+	out, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.tableName),
+		Key:            map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: key}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return middleware.RateLimitResult{}, fmt.Errorf("failed to get rate limit bucket from DynamoDB: %w", err)
+	}
+
+	var state middleware.BucketState
+	var version int64
+	if len(out.Item) > 0 {
+		if n, ok := out.Item["version"].(*types.AttributeValueMemberN); ok {
+			version, _ = strconv.ParseInt(n.Value, 10, 64)
+		}
+		if n, ok := out.Item["tokens"].(*types.AttributeValueMemberN); ok {
+			state.Tokens, _ = strconv.ParseFloat(n.Value, 64)
+		}
+		if n, ok := out.Item["updated"].(*types.AttributeValueMemberN); ok {
+			ms, _ := strconv.ParseInt(n.Value, 10, 64)
+			state.Updated = time.UnixMilli(ms)
+		}
+	}
+
+	state, result := middleware.TakeToken(state, limit, now)
+
+	input := &dynamodb.PutItemInput{
+		TableName: aws.String(s.tableName),
+		Item: map[string]types.AttributeValue{
+			"id":      &types.AttributeValueMemberS{Value: key},
+			"tokens":  &types.AttributeValueMemberN{Value: strconv.FormatFloat(state.Tokens, 'f', -1, 64)},
+			"updated": &types.AttributeValueMemberN{Value: strconv.FormatInt(state.Updated.UnixMilli(), 10)},
+			"expires": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(result.Reset+time.Minute).Unix(), 10)},
+			"version": &types.AttributeValueMemberN{Value: strconv.FormatInt(version+1, 10)},
+		},
+	}
+	switch {
+	case len(out.Item) == 0:
+		input.ConditionExpression = aws.String("attribute_not_exists(id)")
+	case version == 0:
+		// a bucket written before buckets were versioned
+		input.ConditionExpression = aws.String("attribute_exists(id) AND attribute_not_exists(version)")
+	default:
+		input.ConditionExpression = aws.String("version = :previous")
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":previous": &types.AttributeValueMemberN{Value: strconv.FormatInt(version, 10)},
+		}
+	}
+
+	_, err = s.client.PutItem(ctx, input)
+	if err != nil {
+		return middleware.RateLimitResult{}, fmt.Errorf("failed to save rate limit bucket to DynamoDB: %w", err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,161 @@
+package dynamodb
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	toolkit "github.com/babykittenz/api-micro-util"
+	"github.com/babykittenz/api-micro-util/middleware"
+)
+
+// bucketTableClient is a minimal in-memory DynamoDB table supporting the conditional writes the rate limit store uses.
+type bucketTableClient struct {
+	mu        sync.Mutex
+	items     map[string]map[string]types.AttributeValue
+	conflicts int
+}
+
+// GetItem returns the stored item for the id key.
+func (c *bucketTableClient) GetItem(ctx context.Context, params *ddb.GetItemInput, optFns ...func(*ddb.Options)) (*ddb.GetItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &ddb.GetItemOutput{Item: c.items[params.Key["id"].(*types.AttributeValueMemberS).Value]}, nil
+}
+
+// PutItem stores the item, checking the conditions used by RateLimitDDBStore. The first conflicts writes fail.
+func (c *bucketTableClient) PutItem(ctx context.Context, params *ddb.PutItemInput, optFns ...func(*ddb.Options)) (*ddb.PutItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conflicts > 0 {
+		c.conflicts--
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+
+	id := params.Item["id"].(*types.AttributeValueMemberS).Value
+	existing, ok := c.items[id]
+	switch *params.ConditionExpression {
+	case "attribute_not_exists(id)":
+		if ok {
+			return nil, &types.ConditionalCheckFailedException{}
+		}
+	case "attribute_exists(id) AND attribute_not_exists(version)":
+		if _, versioned := existing["version"]; !ok || versioned {
+			return nil, &types.ConditionalCheckFailedException{}
+		}
+	case "version = :previous":
+		version, versioned := existing["version"].(*types.AttributeValueMemberN)
+		if !versioned || version.Value != params.ExpressionAttributeValues[":previous"].(*types.AttributeValueMemberN).Value {
+			return nil, &types.ConditionalCheckFailedException{}
+		}
+	}
+	c.items[id] = params.Item
+	return &ddb.PutItemOutput{}, nil
+}
+
+// Scan is not used by the rate limit store.
+func (c *bucketTableClient) Scan(ctx context.Context, params *ddb.ScanInput, optFns ...func(*ddb.Options)) (*ddb.ScanOutput, error) {
+	return &ddb.ScanOutput{}, nil
+}
+
+// DeleteItem is not used by the rate limit store.
+func (c *bucketTableClient) DeleteItem(ctx context.Context, params *ddb.DeleteItemInput, optFns ...func(*ddb.Options)) (*ddb.DeleteItemOutput, error) {
+	return &ddb.DeleteItemOutput{}, nil
+}
+
+// UpdateItem is not used by the rate limit store.
+func (c *bucketTableClient) UpdateItem(ctx context.Context, params *ddb.UpdateItemInput, optFns ...func(*ddb.Options)) (*ddb.UpdateItemOutput, error) {
+	return &ddb.UpdateItemOutput{}, nil
+}
+
+// Query is not used by the rate limit store.
+func (c *bucketTableClient) Query(ctx context.Context, params *ddb.QueryInput, optFns ...func(*ddb.Options)) (*ddb.QueryOutput, error) {
+	return &ddb.QueryOutput{}, nil
+}
+
+// TestRateLimitDDBStore verifies buckets are shared through the table and conflicting writes are retried.
+func TestRateLimitDDBStore(t *testing.T) {
+	client := &bucketTableClient{items: make(map[string]map[string]types.AttributeValue)}
+	store := NewRateLimitDDBStore(client, "rate_limits")
+	limit := middleware.Limit{Rate: 1, Per: time.Minute, Burst: 2}
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		result, err := store.Take(ctx, "ip:203.0.113.5", limit, now)
+		if err != nil || !result.Allowed {
+			t.Fatalf("request %d should be allowed: %+v %v", i, result, err)
+		}
+	}
+
+	// a second store instance, like another Lambda, sees the same bucket
+	client.conflicts = 2
+	result, err := NewRateLimitDDBStore(client, "rate_limits").Take(ctx, "ip:203.0.113.5", limit, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Allowed || result.RetryAfter != time.Minute {
+		t.Errorf("expected denial with 1m retry, got %+v", result)
+	}
+
+	result, err = store.Take(ctx, "ip:203.0.113.5", limit, now.Add(time.Minute))
+	if err != nil || !result.Allowed {
+		t.Errorf("expected a token after refill: %+v %v", result, err)
+	}
+}
+
+// slowBucketClient delays every read, so concurrent takes read the same bucket and conflict when writing it back.
+type slowBucketClient struct {
+	*bucketTableClient
+}
+
+func (c slowBucketClient) GetItem(ctx context.Context, params *ddb.GetItemInput, optFns ...func(*ddb.Options)) (*ddb.GetItemOutput, error) {
+	out, err := c.bucketTableClient.GetItem(ctx, params, optFns...)
+	time.Sleep(2 * time.Millisecond)
+	return out, err
+}
+
+// TestRateLimitDDBStore_Concurrent verifies a concurrent burst on one key gets no more than the burst through the
+// middleware, with every other request denied rather than let through when the bucket is contended.
+func TestRateLimitDDBStore_Concurrent(t *testing.T) {
+	client := slowBucketClient{&bucketTableClient{items: make(map[string]map[string]types.AttributeValue)}}
+	store := NewRateLimitDDBStore(client, "rate_limits")
+	var tools toolkit.Tools
+	limit := middleware.Limit{Rate: 1, Per: time.Minute, Burst: 3}
+	h := middleware.RateLimit(&tools, store, limit, middleware.KeyByIP(0))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	const requests = 30
+	codes := make(chan int, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest("GET", "/trainees/phone/5554567890", nil))
+			codes <- rr.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	allowed := 0
+	for code := range codes {
+		switch code {
+		case http.StatusOK:
+			allowed++
+		case http.StatusTooManyRequests:
+		default:
+			t.Errorf("wrong status code recieved: %d", code)
+		}
+	}
+	if allowed == 0 || allowed > limit.Burst {
+		t.Errorf("expected between 1 and %d requests allowed, recieved %d", limit.Burst, allowed)
+	}
+}
@@ -1,7 +1,10 @@
 package dynamodb
 
 import (
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"context"
+	"fmt"
+	"time"
+
 	"github.com/babykittenz/api-micro-util/models"
 	"github.com/babykittenz/api-micro-util/repository"
 )
@@ -10,14 +13,14 @@ import (
 // It utilizes a DynamoDB client and a specific table to perform CRUD operations on Region records.
 // The struct includes client for interaction with DynamoDB and tableName for specifying the target table.
 type RegionDDBRepository struct {
-	client    *dynamodb.Client
+	client    TransactDynamoDBAPI
 	tableName string
 }
 
 // NewRegionDDBRepository creates a new RegionDDBRepository using the provided DynamoDB client.
 // It initializes the repository with a "regions" table name for DynamoDB operations.
 // Returns an implementation of the RegionRepository interface.
-func NewRegionDDBRepository(client *dynamodb.Client) repository.RegionRepository {
+func NewRegionDDBRepository(client TransactDynamoDBAPI) repository.RegionRepository {
 	return &RegionDDBRepository{
 		client:    client,
 		tableName: "regions",
@@ -44,15 +47,65 @@ func (r *RegionDDBRepository) FindAllByCompanyID(id string) ([]*models.Region, e
 // Save stores or inserts a Region record into the DynamoDB table.
 // It returns an error if the operation fails.
 func (r *RegionDDBRepository) Save(region *models.Region) error {
+	ctx := context.Background()
+
+	if err := region.Validate(); err != nil {
+		return err
+	}
+
+	// stamp a copy, so the caller's region only changes once it is written
+	now := time.Now().UTC()
+	stamped := *region
+	stamped.Updated = now
+	item, err := marshalItem(stamped.ID, &stamped)
+	if err != nil {
+		return err
+	}
+
+	if err := putModified(ctx, r.client, r.tableName, item, false, now); err != nil {
+		return fmt.Errorf("failed to save region in DynamoDB: %w", err)
+	}
+	region.Updated = now
 	return nil
 }
 
 // Update modifies an existing Region record in the DynamoDB table and returns an error if the operation fails.
 func (r *RegionDDBRepository) Update(region *models.Region) error {
+	ctx := context.Background()
+
+	if err := region.Validate(); err != nil {
+		return err
+	}
+
+	// stamp a copy, so the caller's region only changes once it is written
+	now := time.Now().UTC()
+	stamped := *region
+	stamped.Updated = now
+	item, err := marshalItem(stamped.ID, &stamped)
+	if err != nil {
+		return err
+	}
+
+	if err := putModified(ctx, r.client, r.tableName, item, true, now); err != nil {
+		return fmt.Errorf("failed to update region in DynamoDB: %w", err)
+	}
+	region.Updated = now
 	return nil
 }
 
 // Delete removes a Region record identified by the provided ID from the DynamoDB table and returns an error if it fails.
 func (r *RegionDDBRepository) Delete(id string) error {
+	ctx := context.Background()
+
+	// a missing region is not an error, and leaves the last modified time alone
+	err := deleteModified(ctx, r.client, r.tableName, id, true, time.Now())
+	if err != nil && !conditionFailed(err) {
+		return fmt.Errorf("failed to delete region from DynamoDB: %w", err)
+	}
 	return nil
 }
+
+// LastModified returns the most recent updated time of all Region records in the DynamoDB table.
+func (r *RegionDDBRepository) LastModified() (time.Time, error) {
+	return lastModified(context.Background(), r.client, r.tableName)
+}
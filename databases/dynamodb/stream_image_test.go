@@ -0,0 +1,56 @@
+package dynamodb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/babykittenz/api-micro-util/models"
+	"github.com/babykittenz/api-micro-util/streams"
+)
+
+// TestTraineeStreamImages verifies that stream consumers see a check-in in the images of the items the trainee
+// repository writes, where Save puts the field names and Checkin sets checked_in.
+func TestTraineeStreamImages(t *testing.T) {
+	client := newTableClient()
+	repo := NewTraineeDDBRepository(client, "trainees")
+
+	if err := repo.Save(&models.Trainee{ID: "t1", FirstName: "Jane", LastName: "Doe", Email: "jane@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	old := copyItem(client.tables["trainees"]["t1"])
+	if err := repo.Checkin("t1"); err != nil {
+		t.Fatal(err)
+	}
+	checkedIn := copyItem(client.tables["trainees"]["t1"])
+
+	consumer := streams.NewConsumer()
+	var changes []streams.Change[models.Trainee]
+	streams.Handle(consumer, "trainees", func(ctx context.Context, c streams.Change[models.Trainee]) error {
+		changes = append(changes, c)
+		return nil
+	})
+	_, err := consumer.Process(context.Background(), []streams.Record{
+		{EventID: "1", EventName: streams.Insert, Table: "trainees", NewImage: old},
+		{EventID: "2", EventName: streams.Modify, Table: "trainees", OldImage: old, NewImage: checkedIn},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 2 || changes[0].New.CheckedIn || changes[0].New.FirstName != "Jane" {
+		t.Fatalf("expected the saved trainee, recieved %+v", changes)
+	}
+	if changes[1].Old.CheckedIn || !changes[1].New.CheckedIn {
+		t.Errorf("expected the modify record to show the check-in, recieved old %v and new %v", changes[1].Old.CheckedIn, changes[1].New.CheckedIn)
+	}
+}
+
+// copyItem returns a shallow copy of item, as a stream image is a snapshot of the item.
+func copyItem(item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	c := make(map[string]types.AttributeValue, len(item))
+	for k, v := range item {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,313 @@
+package dynamodb
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// tableClient keeps items of several tables by id. It understands the expressions the repositories use: SET and
+// REMOVE updates, and conditions and filters made of comparisons and attribute_exists checks joined by AND.
+type tableClient struct {
+	mu     sync.Mutex
+	tables map[string]map[string]map[string]types.AttributeValue
+	// failTable cancels every transaction that writes to it
+	failTable string
+	// scans counts the Scan calls, so tests can check an index is queried instead
+	scans int
+	// queries counts the Query calls, one per page
+	queries int
+	// indexSortKeys holds the sort key of each index queried without a sort key condition
+	indexSortKeys map[string]string
+}
+
+// newTableClient returns a client without any items.
+func newTableClient() *tableClient {
+	return &tableClient{
+		tables:        make(map[string]map[string]map[string]types.AttributeValue),
+		indexSortKeys: map[string]string{OutboxPendingIndex: "pending_at"},
+	}
+}
+
+// table returns the items of name, creating the table if needed.
+func (c *tableClient) table(name *string) map[string]map[string]types.AttributeValue {
+	if c.tables[*name] == nil {
+		c.tables[*name] = make(map[string]map[string]types.AttributeValue)
+	}
+	return c.tables[*name]
+}
+
+// GetItem returns the stored item for the id key.
+func (c *tableClient) GetItem(ctx context.Context, params *ddb.GetItemInput, optFns ...func(*ddb.Options)) (*ddb.GetItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &ddb.GetItemOutput{Item: c.table(params.TableName)[keyID(params.Key)]}, nil
+}
+
+// PutItem stores the item if the condition holds.
+func (c *tableClient) PutItem(ctx context.Context, params *ddb.PutItemInput, optFns ...func(*ddb.Options)) (*ddb.PutItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	table := c.table(params.TableName)
+	id := keyID(params.Item)
+	if !holds(table[id], params.ConditionExpression, nil, params.ExpressionAttributeValues) {
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+	table[id] = params.Item
+	return &ddb.PutItemOutput{}, nil
+}
+
+// UpdateItem applies the SET expression if the condition holds, and returns the updated item.
+func (c *tableClient) UpdateItem(ctx context.Context, params *ddb.UpdateItemInput, optFns ...func(*ddb.Options)) (*ddb.UpdateItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	table := c.table(params.TableName)
+	id := keyID(params.Key)
+	if !holds(table[id], params.ConditionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues) {
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+	table[id] = update(table[id], params.Key, *params.UpdateExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	return &ddb.UpdateItemOutput{Attributes: table[id]}, nil
+}
+
+// DeleteItem removes the item and returns it.
+func (c *tableClient) DeleteItem(ctx context.Context, params *ddb.DeleteItemInput, optFns ...func(*ddb.Options)) (*ddb.DeleteItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	table := c.table(params.TableName)
+	id := keyID(params.Key)
+	old := table[id]
+	delete(table, id)
+	return &ddb.DeleteItemOutput{Attributes: old}, nil
+}
+
+// Scan returns every item matching the filter, in a single page.
+func (c *tableClient) Scan(ctx context.Context, params *ddb.ScanInput, optFns ...func(*ddb.Options)) (*ddb.ScanOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.scans++
+
+	var items []map[string]types.AttributeValue
+	for _, item := range c.table(params.TableName) {
+		if holds(item, params.FilterExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues) {
+			items = append(items, item)
+		}
+	}
+	return &ddb.ScanOutput{Items: items}, nil
+}
+
+// Query returns the items matching the key condition and the filter in a single page of at most Limit items. The
+// attribute of the second key condition clause, if there is one, is taken as the sort key of the index.
+func (c *tableClient) Query(ctx context.Context, params *ddb.QueryInput, optFns ...func(*ddb.Options)) (*ddb.QueryOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.queries++
+
+	var items []map[string]types.AttributeValue
+	for _, item := range c.table(params.TableName) {
+		if holds(item, params.KeyConditionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues) {
+			items = append(items, item)
+		}
+	}
+
+	// like DynamoDB, items are read in sort key order, with the id breaking ties so pages do not overlap
+	sortKey := c.indexSortKeys[aws.ToString(params.IndexName)]
+	if clauses := strings.Split(*params.KeyConditionExpression, " AND "); len(clauses) > 1 {
+		sortKey = attributeName(strings.Fields(clauses[1])[0], params.ExpressionAttributeNames)
+	}
+	forward := params.ScanIndexForward == nil || *params.ScanIndexForward
+	less := func(a, b map[string]types.AttributeValue) bool {
+		if sortKey != "" {
+			if n := compare(a[sortKey], b[sortKey]); n != 0 {
+				return (n < 0) == forward
+			}
+		}
+		return keyID(a) < keyID(b)
+	}
+	sort.Slice(items, func(i, j int) bool { return less(items[i], items[j]) })
+
+	// a page starts after its start key, and Limit caps the items read before the filter, as in DynamoDB
+	if start := params.ExclusiveStartKey; start != nil {
+		i := sort.Search(len(items), func(i int) bool { return less(start, items[i]) })
+		items = items[i:]
+	}
+	var last map[string]types.AttributeValue
+	if params.Limit != nil && len(items) > int(*params.Limit) {
+		items = items[:*params.Limit]
+		last = map[string]types.AttributeValue{"id": items[len(items)-1]["id"]}
+		if v, ok := items[len(items)-1][sortKey]; ok {
+			last[sortKey] = v
+		}
+	}
+
+	filtered := items[:0:0]
+	for _, item := range items {
+		if holds(item, params.FilterExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues) {
+			filtered = append(filtered, item)
+		}
+	}
+	return &ddb.QueryOutput{Items: filtered, LastEvaluatedKey: last}, nil
+}
+
+// TransactWriteItems checks every condition before making any write, and cancels the whole transaction if one fails.
+func (c *tableClient) TransactWriteItems(ctx context.Context, params *ddb.TransactWriteItemsInput, optFns ...func(*ddb.Options)) (*ddb.TransactWriteItemsOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// like DynamoDB, a cancelled transaction gives a reason for each of its items
+	reasons := make([]types.CancellationReason, len(params.TransactItems))
+	cancelled := false
+	for i, w := range params.TransactItems {
+		var table string
+		var ok bool
+		switch {
+		case w.Put != nil:
+			table = *w.Put.TableName
+			ok = holds(c.table(w.Put.TableName)[keyID(w.Put.Item)], w.Put.ConditionExpression, w.Put.ExpressionAttributeNames, w.Put.ExpressionAttributeValues)
+		case w.Update != nil:
+			table = *w.Update.TableName
+			ok = holds(c.table(w.Update.TableName)[keyID(w.Update.Key)], w.Update.ConditionExpression, w.Update.ExpressionAttributeNames, w.Update.ExpressionAttributeValues)
+		case w.Delete != nil:
+			table = *w.Delete.TableName
+			ok = holds(c.table(w.Delete.TableName)[keyID(w.Delete.Key)], w.Delete.ConditionExpression, w.Delete.ExpressionAttributeNames, w.Delete.ExpressionAttributeValues)
+		}
+		switch {
+		case table == c.failTable:
+			reasons[i].Code = aws.String("ValidationError")
+			cancelled = true
+		case !ok:
+			reasons[i].Code = aws.String("ConditionalCheckFailed")
+			cancelled = true
+		default:
+			reasons[i].Code = aws.String("None")
+		}
+	}
+	if cancelled {
+		return nil, &types.TransactionCanceledException{CancellationReasons: reasons}
+	}
+
+	for _, w := range params.TransactItems {
+		switch {
+		case w.Put != nil:
+			c.table(w.Put.TableName)[keyID(w.Put.Item)] = w.Put.Item
+		case w.Update != nil:
+			table := c.table(w.Update.TableName)
+			id := keyID(w.Update.Key)
+			table[id] = update(table[id], w.Update.Key, *w.Update.UpdateExpression, w.Update.ExpressionAttributeNames, w.Update.ExpressionAttributeValues)
+		case w.Delete != nil:
+			delete(c.table(w.Delete.TableName), keyID(w.Delete.Key))
+		}
+	}
+	return &ddb.TransactWriteItemsOutput{}, nil
+}
+
+// keyID returns the id attribute of a key or item.
+func keyID(item map[string]types.AttributeValue) string {
+	return item["id"].(*types.AttributeValueMemberS).Value
+}
+
+// update applies a "SET a = :a, b = :b REMOVE c, d" expression to a copy of item, creating it from key if it does not
+// exist.
+func update(item, key map[string]types.AttributeValue, expr string, names map[string]string, values map[string]types.AttributeValue) map[string]types.AttributeValue {
+	updated := make(map[string]types.AttributeValue, len(item)+len(key))
+	for k, v := range key {
+		updated[k] = v
+	}
+	for k, v := range item {
+		updated[k] = v
+	}
+	set, remove, _ := strings.Cut(strings.TrimPrefix(expr, "SET "), " REMOVE ")
+	for _, assignment := range strings.Split(set, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(assignment), " = ")
+		updated[attributeName(name, names)] = values[value]
+	}
+	if remove != "" {
+		for _, name := range strings.Split(remove, ",") {
+			delete(updated, attributeName(strings.TrimSpace(name), names))
+		}
+	}
+	return updated
+}
+
+// holds evaluates a condition of clauses joined by AND against item, which is nil if it does not exist.
+func holds(item map[string]types.AttributeValue, cond *string, names map[string]string, values map[string]types.AttributeValue) bool {
+	if cond == nil {
+		return true
+	}
+	for _, clause := range strings.Split(*cond, " AND ") {
+		clause = strings.TrimSpace(clause)
+		if name, ok := strings.CutPrefix(clause, "attribute_not_exists("); ok {
+			if _, exists := item[attributeName(strings.TrimSuffix(name, ")"), names)]; exists {
+				return false
+			}
+			continue
+		}
+		if name, ok := strings.CutPrefix(clause, "attribute_exists("); ok {
+			if _, exists := item[attributeName(strings.TrimSuffix(name, ")"), names)]; !exists {
+				return false
+			}
+			continue
+		}
+
+		fields := strings.Fields(clause)
+		if len(fields) != 3 || item == nil {
+			return false
+		}
+		n := compare(item[attributeName(fields[0], names)], values[fields[2]])
+		switch fields[1] {
+		case "=":
+			if n != 0 {
+				return false
+			}
+		case "<=":
+			if n > 0 {
+				return false
+			}
+		case "<":
+			if n >= 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// compare orders two string or number values, treating a missing value as less than any other.
+func compare(a, b types.AttributeValue) int {
+	switch a := a.(type) {
+	case *types.AttributeValueMemberS:
+		if b, ok := b.(*types.AttributeValueMemberS); ok {
+			return strings.Compare(a.Value, b.Value)
+		}
+	case *types.AttributeValueMemberN:
+		if b, ok := b.(*types.AttributeValueMemberN); ok {
+			x, _ := strconv.ParseFloat(a.Value, 64)
+			y, _ := strconv.ParseFloat(b.Value, 64)
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	return -1
+}
+
+// attributeName resolves an expression attribute name such as #status.
+func attributeName(name string, names map[string]string) string {
+	if resolved, ok := names[name]; ok {
+		return resolved
+	}
+	return name
+}
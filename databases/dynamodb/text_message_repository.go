@@ -39,11 +39,17 @@ func (r *TextMessageDDBRepository) FindAllByLocationID(id string) ([]*models.Tex
 
 // Save stores the given TextMessage in the DynamoDB table and returns an error if the operation fails.
 func (r *TextMessageDDBRepository) Save(textMessage *models.TextMessage) error {
+	if err := textMessage.Validate(); err != nil {
+		return err
+	}
 	return nil
 }
 
 // Update modifies an existing TextMessage record in the DynamoDB table and returns an error if the operation fails.
 func (r *TextMessageDDBRepository) Update(textMessage *models.TextMessage) error {
+	if err := textMessage.Validate(); err != nil {
+		return err
+	}
 	return nil
 }
 
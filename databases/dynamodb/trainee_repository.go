@@ -2,11 +2,16 @@ package dynamodb
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	toolkit "github.com/babykittenz/api-micro-util"
+	"github.com/babykittenz/api-micro-util/events"
 	"github.com/babykittenz/api-micro-util/models"
 	"github.com/babykittenz/api-micro-util/repository"
 	"log"
@@ -17,15 +22,21 @@ import (
 // It utilizes a DynamoDB client and a specific table to perform CRUD operations on trainee records.
 // The struct includes client for interaction with DynamoDB and tableName for specifying the target table.
 type TraineeDDBRepository struct {
-	client    *dynamodb.Client
+	client    toolkit.DynamoDBAPI
 	tableName string
+	emitter
 }
 
 // NewTraineeDDBRepository creates a new instance of a TraineeRepository using a DynamoDB client and a predefined table name.
-func NewTraineeDDBRepository(client *dynamodb.Client, tableName string) repository.TraineeRepository {
+// If a publisher is given, every write publishes an event such as events.TraineeCreated or events.TraineeCheckedIn
+// with the trainee as its data. Events are published after the write, so a publishing error means the trainee was
+// written but the event was lost. Given a Transactor such as an OutboxDDBPublisher, each write and its event are
+// instead committed in one transaction, so neither is made without the other.
+func NewTraineeDDBRepository(client toolkit.DynamoDBAPI, tableName string, publisher ...events.Publisher) repository.TraineeRepository {
 	return &TraineeDDBRepository{
 		client:    client,
 		tableName: tableName,
+		emitter:   newEmitter(publisher),
 	}
 }
 
@@ -384,6 +395,11 @@ func (r *TraineeDDBRepository) Save(trainee *models.Trainee) error {
 		return fmt.Errorf("cannot save trainee with empty ID")
 	}
 
+	// Validate the trainee before writing it
+	if err := trainee.Validate(); err != nil {
+		return err
+	}
+
 	// Log the trainee data being saved
 	log.Printf("Saving trainee: ID=%s, Name=%s %s", trainee.ID, trainee.FirstName, trainee.LastName)
 
@@ -398,6 +414,7 @@ func (r *TraineeDDBRepository) Save(trainee *models.Trainee) error {
 		log.Printf("WARNING: ID field missing after marshaling, explicitly adding it")
 		item["id"] = &types.AttributeValueMemberS{Value: trainee.ID}
 	}
+	item[traineeVersion] = newVersion()
 
 	// Log the marshaled data
 	log.Printf("Marshaled item keys: %v", getMapKeys(item))
@@ -411,6 +428,12 @@ func (r *TraineeDDBRepository) Save(trainee *models.Trainee) error {
 		Item:      item,
 	}
 
+	// Write the trainee together with its event, if events go to an outbox
+	if outbox, ok := r.outbox(); ok {
+		put := types.TransactWriteItem{Put: &types.Put{TableName: input.TableName, Item: input.Item}}
+		return r.transact(ctx, outbox, put, events.TraineeCreated, trainee)
+	}
+
 	// Execute the PutItem operation
 	result, err := r.client.PutItem(ctx, input)
 	if err != nil {
@@ -421,9 +444,137 @@ func (r *TraineeDDBRepository) Save(trainee *models.Trainee) error {
 
 	// Log success
 	log.Printf("Successfully saved trainee ID=%s to DynamoDB, result=%v", trainee.ID, result)
+	return r.emit(ctx, events.TraineeCreated, trainee.ID, trainee.CompanyID, trainee)
+}
+
+// emitTrainee publishes an event of eventType with the trainee in item, as returned by a write.
+func (r *TraineeDDBRepository) emitTrainee(ctx context.Context, eventType string, item map[string]types.AttributeValue) error {
+	if r.publisher == nil {
+		return nil
+	}
+	trainee, err := decodeTrainee(item)
+	if err != nil {
+		return err
+	}
+	return r.emit(ctx, eventType, trainee.ID, trainee.CompanyID, trainee)
+}
+
+// transact commits write and an event of eventType with the trainee to the outbox in one transaction.
+func (r *TraineeDDBRepository) transact(ctx context.Context, outbox Transactor, write types.TransactWriteItem, eventType string, trainee *models.Trainee) error {
+	event, err := events.New(eventType, trainee.ID, trainee.CompanyID, trainee)
+	if err != nil {
+		return err
+	}
+	if err := outbox.Transact(ctx, []types.TransactWriteItem{write}, event); err != nil {
+		return fmt.Errorf("failed to write trainee with %s event: %w", eventType, err)
+	}
 	return nil
 }
 
+// transactUpdate applies the update to a trainee and commits it with an event of eventType. A transaction cannot
+// return the updated item, so the trainee is read first and apply makes the same change to it for the event. Like
+// UpdateItem, the update creates a trainee that does not exist. The write is conditional on the trainee not having
+// changed since it was read, and is tried again with a fresh read if it has, so the event always matches the item.
+func (r *TraineeDDBRepository) transactUpdate(ctx context.Context, outbox Transactor, input *dynamodb.UpdateItemInput, eventType string, apply func(*models.Trainee)) error {
+	var err error
+	for attempt := 0; attempt < transactAttempts; attempt++ {
+		if err = r.transactUpdateOnce(ctx, outbox, input, eventType, apply); !conditionFailed(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// transactUpdateOnce reads the trainee and commits the update if the trainee has not changed since.
+func (r *TraineeDDBRepository) transactUpdateOnce(ctx context.Context, outbox Transactor, input *dynamodb.UpdateItemInput, eventType string, apply func(*models.Trainee)) error {
+	result, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{TableName: input.TableName, Key: input.Key, ConsistentRead: aws.Bool(true)})
+	if err != nil {
+		return fmt.Errorf("failed to get trainee from DynamoDB: %w", err)
+	}
+
+	trainee := &models.Trainee{ID: input.Key["id"].(*types.AttributeValueMemberS).Value}
+	if result.Item != nil {
+		if trainee, err = decodeTrainee(result.Item); err != nil {
+			return err
+		}
+	}
+	apply(trainee)
+
+	condition, values := unchangedCondition(result.Item, input.ExpressionAttributeValues)
+	update := types.TransactWriteItem{Update: &types.Update{
+		TableName:                 input.TableName,
+		Key:                       input.Key,
+		UpdateExpression:          input.UpdateExpression,
+		ExpressionAttributeValues: values,
+		ConditionExpression:       aws.String(condition),
+	}}
+	return r.transact(ctx, outbox, update, eventType, trainee)
+}
+
+// traineeVersion is the attribute holding a random token that every write of a trainee replaces, so a write based on
+// an earlier read can be made conditional on the trainee not having changed since.
+const traineeVersion = "version"
+
+// transactAttempts is how many times an update in outbox mode is tried while the trainee keeps changing under it.
+const transactAttempts = 3
+
+// newVersion returns a new token for the version attribute of a trainee.
+func newVersion() types.AttributeValue {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return &types.AttributeValueMemberS{Value: hex.EncodeToString(b)}
+}
+
+// unchangedCondition returns a condition that holds only while the trainee is still as snapshot, the item read
+// before the write, which is nil if the trainee did not exist. The condition's values are added to a copy of values.
+func unchangedCondition(snapshot, values map[string]types.AttributeValue) (string, map[string]types.AttributeValue) {
+	merged := make(map[string]types.AttributeValue, len(values)+1)
+	for k, v := range values {
+		merged[k] = v
+	}
+
+	if snapshot == nil {
+		return "attribute_not_exists(id)", merged
+	}
+	version, ok := snapshot[traineeVersion]
+	if !ok {
+		// written before trainees were versioned; any write since has added a version
+		return "attribute_exists(id) AND attribute_not_exists(" + traineeVersion + ")", merged
+	}
+	merged[":snapshot"] = version
+	return traineeVersion + " = :snapshot", merged
+}
+
+// conditionFailed reports whether err is a transaction cancelled because one of its conditions failed.
+func conditionFailed(err error) bool {
+	var cancelled *types.TransactionCanceledException
+	if !errors.As(err, &cancelled) {
+		return false
+	}
+	for _, reason := range cancelled.CancellationReasons {
+		if aws.ToString(reason.Code) == "ConditionalCheckFailed" {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeTrainee unmarshals a trainee item. Save writes the field names, while the update expressions set the JSON
+// names (checked_in, last_training), so the item is read with both and the JSON names win.
+func decodeTrainee(item map[string]types.AttributeValue) (*models.Trainee, error) {
+	var trainee models.Trainee
+	if err := attributevalue.UnmarshalMap(item, &trainee); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal trainee: %w", err)
+	}
+	err := attributevalue.UnmarshalMapWithOptions(item, &trainee, func(o *attributevalue.DecoderOptions) {
+		o.TagKey = "json"
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal trainee: %w", err)
+	}
+	return &trainee, nil
+}
+
 // Helper function to get map keys for logging
 func getMapKeys(m map[string]types.AttributeValue) []string {
 	keys := make([]string, 0, len(m))
@@ -437,6 +588,11 @@ func getMapKeys(m map[string]types.AttributeValue) []string {
 func (r *TraineeDDBRepository) Update(trainee *models.Trainee) error {
 	ctx := context.Background()
 
+	// Validate the trainee before writing it
+	if err := trainee.Validate(); err != nil {
+		return err
+	}
+
 	// Check if the trainee exists before updating
 	existingTrainee, err := r.FindByID(trainee.ID)
 	if err != nil {
@@ -452,6 +608,7 @@ func (r *TraineeDDBRepository) Update(trainee *models.Trainee) error {
 	if err != nil {
 		return fmt.Errorf("failed to marshal trainee for update: %w", err)
 	}
+	item[traineeVersion] = newVersion()
 
 	// Create the PutItem input (PutItem for a full update of the item)
 	input := &dynamodb.PutItemInput{
@@ -459,34 +616,68 @@ func (r *TraineeDDBRepository) Update(trainee *models.Trainee) error {
 		Item:      item,
 	}
 
+	// Write the trainee together with its event, if events go to an outbox
+	if outbox, ok := r.outbox(); ok {
+		put := types.TransactWriteItem{Put: &types.Put{TableName: input.TableName, Item: input.Item}}
+		return r.transact(ctx, outbox, put, events.TraineeUpdated, trainee)
+	}
+
 	// Execute the PutItem operation
 	_, err = r.client.PutItem(ctx, input)
 	if err != nil {
 		return fmt.Errorf("failed to update trainee in DynamoDB: %w", err)
 	}
 
-	return nil
+	return r.emit(ctx, events.TraineeUpdated, trainee.ID, trainee.CompanyID, trainee)
 }
 
 // Delete removes a trainee record from the DynamoDB table based on the provided ID and returns an error if the operation fails.
 func (r *TraineeDDBRepository) Delete(id string) error {
 	ctx := context.Background()
 
-	// Create the DeleteItem input
+	// Create the DeleteItem input, returning the deleted trainee for the event
 	input := &dynamodb.DeleteItemInput{
 		TableName: aws.String(r.tableName),
 		Key: map[string]types.AttributeValue{
 			"id": &types.AttributeValueMemberS{Value: id},
 		},
+		ReturnValues: types.ReturnValueAllOld,
+	}
+
+	// Delete the trainee together with its event, if events go to an outbox. The trainee is read first for the event
+	if outbox, ok := r.outbox(); ok {
+		result, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{TableName: input.TableName, Key: input.Key, ConsistentRead: aws.Bool(true)})
+		if err != nil {
+			return fmt.Errorf("failed to get trainee from DynamoDB: %w", err)
+		}
+		if result.Item == nil {
+			return nil
+		}
+		trainee, err := decodeTrainee(result.Item)
+		if err != nil {
+			return err
+		}
+		condition, values := unchangedCondition(result.Item, nil)
+		del := types.TransactWriteItem{Delete: &types.Delete{
+			TableName:                 input.TableName,
+			Key:                       input.Key,
+			ConditionExpression:       aws.String(condition),
+			ExpressionAttributeValues: values,
+		}}
+		return r.transact(ctx, outbox, del, events.TraineeDeleted, trainee)
 	}
 
 	// Execute the DeleteItem operation
-	_, err := r.client.DeleteItem(ctx, input)
+	result, err := r.client.DeleteItem(ctx, input)
 	if err != nil {
 		return fmt.Errorf("failed to delete trainee from DynamoDB: %w", err)
 	}
 
-	return nil
+	// Nothing was deleted, so there is nothing to tell anyone about
+	if len(result.Attributes) == 0 {
+		return nil
+	}
+	return r.emitTrainee(ctx, events.TraineeDeleted, result.Attributes)
 }
 
 // DeleteByEmail removes a trainee record from the DynamoDB table based on the provided email and returns an error if the operation fails.
@@ -507,13 +698,19 @@ func (r *TraineeDDBRepository) DeleteByEmail(email string) error {
 		},
 	}
 
+	// Delete the trainee together with its event, if events go to an outbox
+	if outbox, ok := r.outbox(); ok {
+		del := types.TransactWriteItem{Delete: &types.Delete{TableName: input.TableName, Key: input.Key}}
+		return r.transact(ctx, outbox, del, events.TraineeDeleted, trainee)
+	}
+
 	// Execute the DeleteItem operation
 	_, err = r.client.DeleteItem(ctx, input)
 	if err != nil {
 		return fmt.Errorf("failed to delete trainee from DynamoDB: %w", err)
 	}
 
-	return nil
+	return r.emit(ctx, events.TraineeDeleted, trainee.ID, trainee.CompanyID, trainee)
 }
 
 // CompleteTraining updates a trainee's record to mark training as complete.
@@ -529,19 +726,26 @@ func (r *TraineeDDBRepository) CompleteTraining(id string) error {
 		Key: map[string]types.AttributeValue{
 			"id": &types.AttributeValueMemberS{Value: id},
 		},
-		UpdateExpression: aws.String("SET last_training = :lastTraining"),
+		ReturnValues:     types.ReturnValueAllNew,
+		UpdateExpression: aws.String("SET last_training = :lastTraining, version = :version"),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
 			":lastTraining": &types.AttributeValueMemberS{Value: currentTime},
+			":version":      newVersion(),
 		},
 	}
 
+	// Update the trainee together with its event, if events go to an outbox
+	if outbox, ok := r.outbox(); ok {
+		return r.transactUpdate(ctx, outbox, input, events.TrainingCompleted, func(t *models.Trainee) { t.LastTraining = currentTime })
+	}
+
 	// Execute the UpdateItem operation
-	_, err := r.client.UpdateItem(ctx, input)
+	result, err := r.client.UpdateItem(ctx, input)
 	if err != nil {
 		return fmt.Errorf("failed to update trainee training completion in DynamoDB: %w", err)
 	}
 
-	return nil
+	return r.emitTrainee(ctx, events.TrainingCompleted, result.Attributes)
 }
 
 // Checkin updates a trainee's record to mark them as checked in.
@@ -554,19 +758,26 @@ func (r *TraineeDDBRepository) Checkin(id string) error {
 		Key: map[string]types.AttributeValue{
 			"id": &types.AttributeValueMemberS{Value: id},
 		},
-		UpdateExpression: aws.String("SET checked_in = :checkedIn"),
+		ReturnValues:     types.ReturnValueAllNew,
+		UpdateExpression: aws.String("SET checked_in = :checkedIn, version = :version"),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
 			":checkedIn": &types.AttributeValueMemberBOOL{Value: true},
+			":version":   newVersion(),
 		},
 	}
 
+	// Update the trainee together with its event, if events go to an outbox
+	if outbox, ok := r.outbox(); ok {
+		return r.transactUpdate(ctx, outbox, input, events.TraineeCheckedIn, func(t *models.Trainee) { t.CheckedIn = true })
+	}
+
 	// Execute the UpdateItem operation
-	_, err := r.client.UpdateItem(ctx, input)
+	result, err := r.client.UpdateItem(ctx, input)
 	if err != nil {
 		return fmt.Errorf("failed to checkin trainee in DynamoDB: %w", err)
 	}
 
-	return nil
+	return r.emitTrainee(ctx, events.TraineeCheckedIn, result.Attributes)
 }
 
 // Checkout updates a trainee's record to mark them as checked out.
@@ -579,19 +790,26 @@ func (r *TraineeDDBRepository) Checkout(id string) error {
 		Key: map[string]types.AttributeValue{
 			"id": &types.AttributeValueMemberS{Value: id},
 		},
-		UpdateExpression: aws.String("SET checked_in = :checkedIn"),
+		ReturnValues:     types.ReturnValueAllNew,
+		UpdateExpression: aws.String("SET checked_in = :checkedIn, version = :version"),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
 			":checkedIn": &types.AttributeValueMemberBOOL{Value: false},
+			":version":   newVersion(),
 		},
 	}
 
+	// Update the trainee together with its event, if events go to an outbox
+	if outbox, ok := r.outbox(); ok {
+		return r.transactUpdate(ctx, outbox, input, events.TraineeCheckedOut, func(t *models.Trainee) { t.CheckedIn = false })
+	}
+
 	// Execute the UpdateItem operation
-	_, err := r.client.UpdateItem(ctx, input)
+	result, err := r.client.UpdateItem(ctx, input)
 	if err != nil {
 		return fmt.Errorf("failed to checkout trainee in DynamoDB: %w", err)
 	}
 
-	return nil
+	return r.emitTrainee(ctx, events.TraineeCheckedOut, result.Attributes)
 }
 
 // FindAll retrieves all trainee records from the DynamoDB table and returns a slice of Trainee objects or an error.
@@ -1,11 +1,14 @@
 package dynamodb
 
 import (
+	"log"
+	"strings"
+	"testing"
+
 	toolkit "github.com/babykittenz/api-micro-util"
+	"github.com/babykittenz/api-micro-util/events"
 	"github.com/babykittenz/api-micro-util/models"
 	"github.com/stretchr/testify/assert"
-	"log"
-	"testing"
 )
 
 func TestTraineeDDBRepository(t *testing.T) {
@@ -63,3 +66,68 @@ func TestTraineeDDBRepository(t *testing.T) {
 	assert.Nil(t, trainee)
 
 }
+
+// TestTraineeDDBRepository_Events verifies each write publishes an event with the trainee as it was written.
+func TestTraineeDDBRepository_Events(t *testing.T) {
+	client := newTableClient()
+	publisher := events.NewMemoryPublisher()
+	repo := NewTraineeDDBRepository(client, "trainees", publisher)
+
+	trainee := &models.Trainee{ID: "t1", FirstName: "Jane", LastName: "Doe", VisitorType: "guest", CompanyID: "acme"}
+	if err := repo.Save(trainee); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Checkin("t1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Checkout("t1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.CompleteTraining("t1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete("t1"); err != nil {
+		t.Fatal(err)
+	}
+	// deleting a trainee that does not exist publishes nothing
+	if err := repo.Delete("t1"); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		eventType string
+		checkedIn bool
+	}{
+		{events.TraineeCreated, false},
+		{events.TraineeCheckedIn, true},
+		{events.TraineeCheckedOut, false},
+		{events.TrainingCompleted, false},
+		{events.TraineeDeleted, false},
+	}
+
+	published := publisher.Events()
+	if len(published) != len(tests) {
+		t.Fatalf("expected %d events, recieved %d", len(tests), len(published))
+	}
+	for i, e := range tests {
+		got := published[i]
+		if got.Type != e.eventType || got.Subject != "t1" {
+			t.Errorf("%s: wrong event recieved %s about %s", e.eventType, got.Type, got.Subject)
+		}
+
+		var data models.Trainee
+		if err := got.Decode(&data); err != nil {
+			t.Errorf("%s: %s", e.eventType, err)
+			continue
+		}
+		if data.FirstName != "Jane" || data.CompanyID != "acme" {
+			t.Errorf("%s: expected the whole trainee, recieved %+v", e.eventType, data)
+		}
+		if data.CheckedIn != e.checkedIn {
+			t.Errorf("%s: expected checked in %v, recieved %v", e.eventType, e.checkedIn, data.CheckedIn)
+		}
+	}
+	if published[3].Data == nil || !strings.Contains(string(published[3].Data), "last_training") {
+		t.Errorf("expected the training completed event to carry the trainee, recieved %s", published[3].Data)
+	}
+}
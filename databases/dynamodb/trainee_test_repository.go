@@ -383,6 +383,11 @@ func (r *testTraineeDDBRepository) Save(trainee *models.Trainee) error {
 		return errors.New("cannot save nil trainee")
 	}
 
+	// Validate the trainee before writing it
+	if err := trainee.Validate(); err != nil {
+		return err
+	}
+
 	ctx := context.Background()
 
 	// Marshal the trainee struct to DynamoDB attribute values
@@ -54,11 +54,17 @@ func (r *TrainingDDBRepository) FindAllByTraineeID(id string) ([]*models.Trainin
 
 // Save inserts a new training record into the DynamoDB table or overwrites an existing one with the same ID.
 func (r *TrainingDDBRepository) Save(training *models.Training) error {
+	if err := training.Validate(); err != nil {
+		return err
+	}
 	return nil
 }
 
 // Update modifies an existing training record in the DynamoDB table with the provided training data.
 func (r *TrainingDDBRepository) Update(training *models.Training) error {
+	if err := training.Validate(); err != nil {
+		return err
+	}
 	return nil
 }
 
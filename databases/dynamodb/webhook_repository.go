@@ -0,0 +1,376 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	toolkit "github.com/babykittenz/api-micro-util"
+	"github.com/babykittenz/api-micro-util/models"
+	"github.com/babykittenz/api-micro-util/repository"
+)
+
+// WebhookEndpointDDBRepository is a repository implementation for managing webhook endpoints in DynamoDB.
+type WebhookEndpointDDBRepository struct {
+	client    toolkit.DynamoDBAPI
+	tableName string
+}
+
+// NewWebhookEndpointDDBRepository creates a new WebhookEndpointRepository using the given DynamoDB client and the
+// "webhook_endpoints" table.
+func NewWebhookEndpointDDBRepository(client toolkit.DynamoDBAPI) repository.WebhookEndpointRepository {
+	return &WebhookEndpointDDBRepository{
+		client:    client,
+		tableName: "webhook_endpoints",
+	}
+}
+
+// FindByID retrieves a webhook endpoint from DynamoDB based on the provided ID.
+func (r *WebhookEndpointDDBRepository) FindByID(id string) (*models.WebhookEndpoint, error) {
+	ctx := context.Background()
+
+	result, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook endpoint from DynamoDB: %w", err)
+	}
+
+	if len(result.Item) == 0 {
+		return nil, fmt.Errorf("webhook endpoint with id %s not found", id)
+	}
+
+	var endpoint models.WebhookEndpoint
+	err = attributevalue.UnmarshalMap(result.Item, &endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal webhook endpoint: %w", err)
+	}
+
+	return &endpoint, nil
+}
+
+// FindAllByCompanyID retrieves all webhook endpoints of the given company.
+func (r *WebhookEndpointDDBRepository) FindAllByCompanyID(id string) ([]*models.WebhookEndpoint, error) {
+	endpoints := []*models.WebhookEndpoint{}
+	err := scanAll(context.Background(), r.client, &dynamodb.ScanInput{
+		TableName:        aws.String(r.tableName),
+		FilterExpression: aws.String("company_id = :companyID"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":companyID": &types.AttributeValueMemberS{Value: id},
+		},
+	}, &endpoints)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan webhook endpoints: %w", err)
+	}
+
+	return endpoints, nil
+}
+
+// Save persists a webhook endpoint to the DynamoDB table. Returns an error if the operation fails.
+func (r *WebhookEndpointDDBRepository) Save(endpoint *models.WebhookEndpoint) error {
+	if endpoint.ID == "" {
+		return fmt.Errorf("cannot save webhook endpoint with empty ID")
+	}
+	if err := endpoint.Validate(); err != nil {
+		return err
+	}
+
+	return putItem(r.client, r.tableName, endpoint, "", "webhook endpoint")
+}
+
+// Update replaces an existing webhook endpoint, failing if it does not exist.
+func (r *WebhookEndpointDDBRepository) Update(endpoint *models.WebhookEndpoint) error {
+	if err := endpoint.Validate(); err != nil {
+		return err
+	}
+
+	return putItem(r.client, r.tableName, endpoint, "attribute_exists(id)", "webhook endpoint")
+}
+
+// Delete removes a webhook endpoint from the DynamoDB table.
+func (r *WebhookEndpointDDBRepository) Delete(id string) error {
+	_, err := r.client.DeleteItem(context.Background(), &dynamodb.DeleteItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook endpoint from DynamoDB: %w", err)
+	}
+
+	return nil
+}
+
+// Indexes of the webhook tables, which must be created with them.
+const (
+	// WebhookDueIndex is a global secondary index on "webhook_deliveries" with the partition key "status" (S) and
+	// the sort key "next_attempt" (N), which FindDue queries for pending deliveries in order.
+	WebhookDueIndex = "status-next_attempt-index"
+	// WebhookEndpointIndex is a global secondary index on both "webhook_deliveries" and "webhook_attempts" with
+	// the partition key "endpoint_id" (S), which the per endpoint lookups query.
+	WebhookEndpointIndex = "endpoint_id-index"
+)
+
+// WebhookRetention is how long succeeded and dead deliveries, and every attempt, are kept. They are written with an
+// "expires_at" attribute in Unix seconds, which should be enabled as the time to live attribute of both tables.
+var WebhookRetention = 30 * 24 * time.Hour
+
+// WebhookDeliveryDDBRepository is the webhook delivery queue in DynamoDB. Deliveries are kept in the
+// "webhook_deliveries" table and the log of attempts in the "webhook_attempts" table, and are found through the
+// WebhookDueIndex and WebhookEndpointIndex indexes. Next attempts are stored as Unix seconds so due deliveries can
+// be found with a numeric comparison.
+type WebhookDeliveryDDBRepository struct {
+	client        toolkit.DynamoDBAPI
+	tableName     string
+	attemptsTable string
+}
+
+// NewWebhookDeliveryDDBRepository creates a new WebhookDeliveryRepository using the given DynamoDB client and the
+// "webhook_deliveries" and "webhook_attempts" tables.
+func NewWebhookDeliveryDDBRepository(client toolkit.DynamoDBAPI) repository.WebhookDeliveryRepository {
+	return &WebhookDeliveryDDBRepository{
+		client:        client,
+		tableName:     "webhook_deliveries",
+		attemptsTable: "webhook_attempts",
+	}
+}
+
+// FindByID retrieves a webhook delivery from DynamoDB based on the provided ID.
+func (r *WebhookDeliveryDDBRepository) FindByID(id string) (*models.WebhookDelivery, error) {
+	ctx := context.Background()
+
+	result, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook delivery from DynamoDB: %w", err)
+	}
+
+	if len(result.Item) == 0 {
+		return nil, fmt.Errorf("webhook delivery with id %s not found", id)
+	}
+
+	var delivery models.WebhookDelivery
+	err = attributevalue.UnmarshalMap(result.Item, &delivery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal webhook delivery: %w", err)
+	}
+
+	return &delivery, nil
+}
+
+// FindDue retrieves up to limit pending deliveries whose next attempt is due by now, oldest first. The index is
+// eventually consistent, so a delivery may be returned that another worker has just claimed; Claim refuses it.
+func (r *WebhookDeliveryDDBRepository) FindDue(now time.Time, limit int) ([]*models.WebhookDelivery, error) {
+	due := []*models.WebhookDelivery{}
+	err := queryAll(context.Background(), r.client, &dynamodb.QueryInput{
+		TableName:                aws.String(r.tableName),
+		IndexName:                aws.String(WebhookDueIndex),
+		KeyConditionExpression:   aws.String("#status = :pending AND next_attempt <= :now"),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pending": &types.AttributeValueMemberS{Value: models.WebhookStatusPending},
+			":now":     &types.AttributeValueMemberN{Value: fmt.Sprint(now.Unix())},
+		},
+	}, limit, &due)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query due webhook deliveries: %w", err)
+	}
+
+	return due, nil
+}
+
+// FindAllByEndpointID retrieves the deliveries for an endpoint with the given status, or every status if status is
+// empty, newest first.
+func (r *WebhookDeliveryDDBRepository) FindAllByEndpointID(id string, status string) ([]*models.WebhookDelivery, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.tableName),
+		IndexName:              aws.String(WebhookEndpointIndex),
+		KeyConditionExpression: aws.String("endpoint_id = :endpointID"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":endpointID": &types.AttributeValueMemberS{Value: id},
+		},
+	}
+	if status != "" {
+		input.FilterExpression = aws.String("#status = :status")
+		input.ExpressionAttributeNames = map[string]string{"#status": "status"}
+		input.ExpressionAttributeValues[":status"] = &types.AttributeValueMemberS{Value: status}
+	}
+
+	deliveries := []*models.WebhookDelivery{}
+	if err := queryAll(context.Background(), r.client, input, 0, &deliveries); err != nil {
+		return nil, fmt.Errorf("failed to query webhook deliveries: %w", err)
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].Created.After(deliveries[j].Created) })
+	return deliveries, nil
+}
+
+// Save persists a new webhook delivery to the DynamoDB table.
+func (r *WebhookDeliveryDDBRepository) Save(delivery *models.WebhookDelivery) error {
+	if delivery.ID == "" {
+		return fmt.Errorf("cannot save webhook delivery with empty ID")
+	}
+	if err := delivery.Validate(); err != nil {
+		return err
+	}
+
+	return putItem(r.client, r.tableName, delivery, "", "webhook delivery")
+}
+
+// Update replaces an existing webhook delivery, failing if it does not exist. A delivery that has succeeded or is
+// dead expires WebhookRetention after the update; one put back in the queue no longer expires.
+func (r *WebhookDeliveryDDBRepository) Update(delivery *models.WebhookDelivery) error {
+	if err := delivery.Validate(); err != nil {
+		return err
+	}
+
+	var expires time.Time
+	if delivery.Status != models.WebhookStatusPending {
+		expires = delivery.Updated.Add(WebhookRetention)
+	}
+	return putExpiringItem(r.client, r.tableName, delivery, "attribute_exists(id)", "webhook delivery", expires)
+}
+
+// Claim moves the next attempt of a pending delivery to until with a conditional update, so only the worker that
+// read the current next attempt wins.
+func (r *WebhookDeliveryDDBRepository) Claim(delivery *models.WebhookDelivery, until time.Time) (bool, error) {
+	_, err := r.client.UpdateItem(context.Background(), &dynamodb.UpdateItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: delivery.ID},
+		},
+		UpdateExpression:         aws.String("SET next_attempt = :until"),
+		ConditionExpression:      aws.String("#status = :pending AND next_attempt = :previous"),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":until":    &types.AttributeValueMemberN{Value: fmt.Sprint(until.Unix())},
+			":pending":  &types.AttributeValueMemberS{Value: models.WebhookStatusPending},
+			":previous": &types.AttributeValueMemberN{Value: fmt.Sprint(delivery.NextAttempt.Unix())},
+		},
+	})
+
+	var taken *types.ConditionalCheckFailedException
+	if errors.As(err, &taken) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to claim webhook delivery in DynamoDB: %w", err)
+	}
+
+	delivery.NextAttempt = until
+	return true, nil
+}
+
+// SaveAttempt adds an attempt to the delivery log, which expires WebhookRetention after the attempt.
+func (r *WebhookDeliveryDDBRepository) SaveAttempt(attempt *models.WebhookAttempt) error {
+	return putExpiringItem(r.client, r.attemptsTable, attempt, "", "webhook attempt", attempt.Created.Add(WebhookRetention))
+}
+
+// FindAttemptsByEndpointID retrieves the latest limit attempts for an endpoint, newest first. A limit of zero returns
+// every attempt that has not expired.
+func (r *WebhookDeliveryDDBRepository) FindAttemptsByEndpointID(id string, limit int) ([]*models.WebhookAttempt, error) {
+	attempts := []*models.WebhookAttempt{}
+	err := queryAll(context.Background(), r.client, &dynamodb.QueryInput{
+		TableName:              aws.String(r.attemptsTable),
+		IndexName:              aws.String(WebhookEndpointIndex),
+		KeyConditionExpression: aws.String("endpoint_id = :endpointID"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":endpointID": &types.AttributeValueMemberS{Value: id},
+		},
+	}, 0, &attempts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook attempts: %w", err)
+	}
+
+	sort.Slice(attempts, func(i, j int) bool { return attempts[i].Created.After(attempts[j].Created) })
+	if limit > 0 && len(attempts) > limit {
+		attempts = attempts[:limit]
+	}
+	return attempts, nil
+}
+
+// scanAll scans every page of input and unmarshals the items into out, a pointer to a slice. A table's last
+// modified marker is left out.
+func scanAll(ctx context.Context, client toolkit.DynamoDBAPI, input *dynamodb.ScanInput, out interface{}) error {
+	var items []map[string]types.AttributeValue
+
+	paginator := dynamodb.NewScanPaginator(client, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		items = append(items, withoutMarker(page.Items)...)
+	}
+
+	return attributevalue.UnmarshalListOfMaps(items, out)
+}
+
+// queryAll queries pages of input until limit items are read, or every page if limit is zero, and unmarshals the
+// items into out, a pointer to a slice. A table's last modified marker is left out.
+func queryAll(ctx context.Context, client toolkit.DynamoDBAPI, input *dynamodb.QueryInput, limit int, out interface{}) error {
+	var items []map[string]types.AttributeValue
+	if limit > 0 {
+		input.Limit = aws.Int32(int32(limit))
+	}
+
+	paginator := dynamodb.NewQueryPaginator(client, input)
+	for paginator.HasMorePages() && (limit <= 0 || len(items) < limit) {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		items = append(items, withoutMarker(page.Items)...)
+	}
+	if limit > 0 && len(items) > limit {
+		items = items[:limit]
+	}
+
+	return attributevalue.UnmarshalListOfMaps(items, out)
+}
+
+// putItem marshals v and writes it to tableName, with an optional condition. Name describes v in errors.
+func putItem(client toolkit.DynamoDBAPI, tableName string, v interface{}, condition, name string) error {
+	return putExpiringItem(client, tableName, v, condition, name, time.Time{})
+}
+
+// putExpiringItem is putItem for an item that DynamoDB deletes after expires, unless it is zero.
+func putExpiringItem(client toolkit.DynamoDBAPI, tableName string, v interface{}, condition, name string, expires time.Time) error {
+	item, err := attributevalue.MarshalMap(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", name, err)
+	}
+	if !expires.IsZero() {
+		item["expires_at"] = &types.AttributeValueMemberN{Value: fmt.Sprint(expires.Unix())}
+	}
+
+	input := &dynamodb.PutItemInput{
+		TableName: aws.String(tableName),
+		Item:      item,
+	}
+	if condition != "" {
+		input.ConditionExpression = aws.String(condition)
+	}
+
+	_, err = client.PutItem(context.Background(), input)
+	if err != nil {
+		return fmt.Errorf("failed to save %s to DynamoDB: %w", name, err)
+	}
+
+	return nil
+}
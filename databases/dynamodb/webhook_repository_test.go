@@ -0,0 +1,92 @@
+package dynamodb
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/babykittenz/api-micro-util/models"
+)
+
+// TestWebhookDeliveryNextAttempt verifies next attempts are stored as Unix seconds, as FindDue and Claim compare them.
+func TestWebhookDeliveryNextAttempt(t *testing.T) {
+	next := time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)
+	item, err := attributevalue.MarshalMap(&models.WebhookDelivery{ID: "d-1", Status: models.WebhookStatusPending, NextAttempt: next})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, ok := item["next_attempt"].(*types.AttributeValueMemberN)
+	if !ok || n.Value != "1735718400" {
+		t.Fatalf("expected next_attempt to be stored as a number, got %#v", item["next_attempt"])
+	}
+
+	var delivery models.WebhookDelivery
+	if err := attributevalue.UnmarshalMap(item, &delivery); err != nil || !delivery.NextAttempt.Equal(next) {
+		t.Errorf("expected the next attempt to round trip, got %v %v", delivery.NextAttempt, err)
+	}
+}
+
+// TestWebhookDeliveryDDBRepository tests that deliveries and attempts are found through the indexes, without a scan,
+// and that finished ones are written with an expiry.
+func TestWebhookDeliveryDDBRepository(t *testing.T) {
+	client := newTableClient()
+	repo := NewWebhookDeliveryDDBRepository(client)
+	now := time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)
+
+	for i, next := range []time.Duration{2 * time.Minute, -time.Minute, -2 * time.Minute, -3 * time.Minute} {
+		endpointID := "e-1"
+		if i == 3 {
+			endpointID = "e-2"
+		}
+		delivery := &models.WebhookDelivery{ID: fmt.Sprint("d-", i), EndpointID: endpointID, Status: models.WebhookStatusPending, NextAttempt: now.Add(next), Created: now.Add(time.Duration(i) * time.Second)}
+		if err := repo.Save(delivery); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	due, err := repo.FindDue(now, 2)
+	if err != nil || len(due) != 2 || due[0].ID != "d-3" || due[1].ID != "d-2" {
+		t.Errorf("expected the 2 oldest due deliveries, recieved %v %v", due, err)
+	}
+
+	finished, _ := repo.FindByID("d-1")
+	finished.Status, finished.Updated = models.WebhookStatusSucceeded, now
+	if err := repo.Update(finished); err != nil {
+		t.Fatal(err)
+	}
+	expires, ok := client.tables["webhook_deliveries"]["d-1"]["expires_at"].(*types.AttributeValueMemberN)
+	if !ok || expires.Value != fmt.Sprint(now.Add(WebhookRetention).Unix()) {
+		t.Errorf("expected a finished delivery to expire, recieved %#v", client.tables["webhook_deliveries"]["d-1"]["expires_at"])
+	}
+	if _, ok := client.tables["webhook_deliveries"]["d-2"]["expires_at"]; ok {
+		t.Error("expected a pending delivery not to expire")
+	}
+
+	deliveries, err := repo.FindAllByEndpointID("e-1", "")
+	if err != nil || len(deliveries) != 3 || deliveries[0].ID != "d-2" {
+		t.Errorf("expected the endpoint's 3 deliveries newest first, recieved %v %v", deliveries, err)
+	}
+	if succeeded, _ := repo.FindAllByEndpointID("e-1", models.WebhookStatusSucceeded); len(succeeded) != 1 || succeeded[0].ID != "d-1" {
+		t.Errorf("expected the succeeded delivery, recieved %v", succeeded)
+	}
+
+	for i := 1; i <= 3; i++ {
+		if err := repo.SaveAttempt(&models.WebhookAttempt{ID: fmt.Sprint("a-", i), DeliveryID: "d-1", EndpointID: "e-1", Attempt: i, Created: now.Add(time.Duration(i) * time.Minute)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := client.tables["webhook_attempts"]["a-1"]["expires_at"]; !ok {
+		t.Error("expected attempts to expire")
+	}
+	attempts, err := repo.FindAttemptsByEndpointID("e-1", 2)
+	if err != nil || len(attempts) != 2 || attempts[0].Attempt != 3 {
+		t.Errorf("expected the 2 latest attempts, recieved %v %v", attempts, err)
+	}
+
+	if client.scans != 0 {
+		t.Errorf("expected the indexes to be queried, recieved %d scans", client.scans)
+	}
+}
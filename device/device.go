@@ -0,0 +1,239 @@
+// Package device issues and verifies long lived credentials for check-in kiosks. Each device is bound to a
+// single location and limited to the kiosk scopes, so a kiosk never needs admin credentials.
+package device
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	toolkit "github.com/babykittenz/api-micro-util"
+	"github.com/babykittenz/api-micro-util/models"
+	"github.com/babykittenz/api-micro-util/repository"
+)
+
+// Scopes a device can be granted.
+const (
+	ScopeTraineeLookup    = "trainee:lookup"
+	ScopeTraineeRegister  = "trainee:register"
+	ScopeTrainingComplete = "training:complete"
+	ScopeCheckin          = "checkin"
+)
+
+// KioskScopes are the scopes given to a device when none are specified.
+var KioskScopes = []string{ScopeTraineeLookup, ScopeTraineeRegister, ScopeTrainingComplete, ScopeCheckin}
+
+// tokenPrefix marks device tokens, so they are easy to recognise in logs and secret scanners.
+const tokenPrefix = "dvc_"
+
+// Errors returned when a device token cannot be verified.
+var (
+	ErrInvalidToken = errors.New("device token is invalid")
+	ErrRevoked      = errors.New("device has been revoked")
+)
+
+// ErrDeviceExists is returned by Issue for an ID that is already registered. Use Rotate to give an existing device
+// a new token; a revoked device stays revoked.
+var ErrDeviceExists = errors.New("device already exists")
+
+// Registry issues, verifies and revokes device credentials, and keeps track of when devices were last seen.
+type Registry struct {
+	repo  repository.DeviceRepository
+	tools *toolkit.Tools
+	// TouchInterval is the minimum time between last seen updates for a device, to limit writes. Defaults to a minute.
+	TouchInterval time.Duration
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+
+	mu      sync.Mutex
+	touched map[string]time.Time
+}
+
+// NewRegistry returns a registry storing devices in repo.
+func NewRegistry(repo repository.DeviceRepository, tools *toolkit.Tools) *Registry {
+	return &Registry{
+		repo:          repo,
+		tools:         tools,
+		TouchInterval: time.Minute,
+		Now:           time.Now,
+		touched:       make(map[string]time.Time),
+	}
+}
+
+// Issue registers a new device and returns its token. The token is only available now; just its hash is stored.
+// The device must have a name and location, and gets KioskScopes if it has no scopes. An ID given by the caller must
+// not be registered yet, so issuing never replaces or un-revokes an existing device.
+func (r *Registry) Issue(d *models.Device) (string, error) {
+	if d.ID == "" {
+		id, err := r.tools.RandomToken(15)
+		if err != nil {
+			return "", err
+		}
+		d.ID = id
+	} else if existing, err := r.repo.FindByID(d.ID); err == nil && existing != nil {
+		return "", ErrDeviceExists
+	}
+	if len(d.Scopes) == 0 {
+		d.Scopes = append([]string(nil), KioskScopes...)
+	}
+	d.Created = r.Now().UTC()
+	d.Revoked = false
+	d.RevokedAt = time.Time{}
+
+	token, hash, err := r.newToken(d.ID)
+	if err != nil {
+		return "", err
+	}
+	d.TokenHash = hash
+
+	if err := r.repo.Save(d); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Rotate replaces the token of a device, invalidating the old one, and returns the new token.
+func (r *Registry) Rotate(id string) (string, error) {
+	d, err := r.repo.FindByID(id)
+	if err != nil {
+		return "", err
+	}
+	if d == nil {
+		return "", fmt.Errorf("device with id %s not found", id)
+	}
+	if d.Revoked {
+		return "", ErrRevoked
+	}
+
+	token, hash, err := r.newToken(d.ID)
+	if err != nil {
+		return "", err
+	}
+	d.TokenHash = hash
+	if err := r.repo.Update(d); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Revoke permanently disables a device. Revoked devices stay in the registry so they can be audited.
+func (r *Registry) Revoke(id string) error {
+	d, err := r.repo.FindByID(id)
+	if err != nil {
+		return err
+	}
+	if d == nil {
+		return fmt.Errorf("device with id %s not found", id)
+	}
+
+	d.Revoked = true
+	d.RevokedAt = r.Now().UTC()
+	return r.repo.Update(d)
+}
+
+// List returns the devices registered to a location.
+func (r *Registry) List(locationID string) ([]*models.Device, error) {
+	return r.repo.FindAllByLocationID(locationID)
+}
+
+// Verify checks a device token and returns the device it belongs to. The device's last seen time is updated
+// at most once per TouchInterval; a failure to update it is logged, and does not fail a valid token.
+func (r *Registry) Verify(token string) (*models.Device, error) {
+	id, _, ok := splitToken(token)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	d, err := r.repo.FindByID(id)
+	if err != nil || d == nil {
+		return nil, ErrInvalidToken
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(d.TokenHash)) != 1 {
+		return nil, ErrInvalidToken
+	}
+	if d.Revoked {
+		return nil, ErrRevoked
+	}
+
+	now := r.Now().UTC()
+	if r.shouldTouch(d.ID, now) {
+		if err := r.repo.Touch(d.ID, now); err != nil {
+			log.Printf("unable to record activity of device %s: %v", d.ID, err)
+			r.untouch(d.ID)
+		} else {
+			d.LastSeen = now
+		}
+	}
+
+	return d, nil
+}
+
+// shouldTouch reports whether the last seen time of device id is due to be written, and records that it is.
+func (r *Registry) shouldTouch(id string, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.touched == nil {
+		r.touched = make(map[string]time.Time)
+	}
+	if last, ok := r.touched[id]; ok && now.Sub(last) < r.TouchInterval {
+		return false
+	}
+	r.touched[id] = now
+	return true
+}
+
+// untouch forgets the last seen update of device id, so the next request tries it again.
+func (r *Registry) untouch(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.touched, id)
+}
+
+// newToken generates a token for device id and returns it along with the hash to store. The secret is base64url,
+// which never contains the "." separating it from the ID.
+func (r *Registry) newToken(id string) (string, string, error) {
+	secret, err := r.tools.RandomToken(30)
+	if err != nil {
+		return "", "", err
+	}
+	token := tokenPrefix + id + "." + secret
+	return token, hashToken(token), nil
+}
+
+// hashToken returns the hex encoded SHA-256 of a token.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// splitToken splits a device token into the device ID and secret at the last ".", as the ID given to Issue may
+// contain dots while the secret never does.
+func splitToken(token string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(token, tokenPrefix)
+	if !ok {
+		return "", "", false
+	}
+	i := strings.LastIndex(rest, ".")
+	if i <= 0 || i == len(rest)-1 {
+		return "", "", false
+	}
+	return rest[:i], rest[i+1:], true
+}
+
+// HasScope reports whether the device was granted scope.
+func HasScope(d *models.Device, scope string) bool {
+	for _, s := range d.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
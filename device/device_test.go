@@ -0,0 +1,228 @@
+package device
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	toolkit "github.com/babykittenz/api-micro-util"
+	"github.com/babykittenz/api-micro-util/middleware"
+	"github.com/babykittenz/api-micro-util/models"
+	"github.com/babykittenz/api-micro-util/repository"
+)
+
+// TestRegistry tests issuing, verifying, rotating and revoking a device token.
+func TestRegistry(t *testing.T) {
+	var tools toolkit.Tools
+	repo := NewMemoryRepository()
+	registry := NewRegistry(repo, &tools)
+
+	now := time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)
+	registry.Now = func() time.Time { return now }
+
+	token, err := registry.Issue(&models.Device{Name: "Front gate kiosk", LocationID: "loc-001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := registry.Verify(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.LocationID != "loc-001" || len(d.Scopes) != len(KioskScopes) || !d.LastSeen.Equal(now) {
+		t.Errorf("wrong device returned: %+v", d)
+	}
+
+	// last seen is only written once per interval
+	now = now.Add(10 * time.Second)
+	_, _ = registry.Verify(token)
+	stored, _ := repo.FindByID(d.ID)
+	if !stored.LastSeen.Equal(now.Add(-10 * time.Second)) {
+		t.Errorf("last seen should not have been updated yet: %v", stored.LastSeen)
+	}
+	now = now.Add(time.Minute)
+	_, _ = registry.Verify(token)
+	stored, _ = repo.FindByID(d.ID)
+	if !stored.LastSeen.Equal(now) {
+		t.Errorf("last seen should have been updated: %v", stored.LastSeen)
+	}
+
+	if _, err := registry.Verify(token + "x"); err != ErrInvalidToken {
+		t.Errorf("tampered token: expected ErrInvalidToken but got %v", err)
+	}
+
+	rotated, err := registry.Rotate(d.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.Verify(token); err != ErrInvalidToken {
+		t.Errorf("old token after rotation: expected ErrInvalidToken but got %v", err)
+	}
+
+	if err := registry.Revoke(d.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.Verify(rotated); err != ErrRevoked {
+		t.Errorf("revoked device: expected ErrRevoked but got %v", err)
+	}
+
+	devices, _ := registry.List("loc-001")
+	if len(devices) != 1 || !devices[0].Revoked {
+		t.Errorf("revoked device should still be listed: %v", devices)
+	}
+}
+
+// TestMiddleware tests that devices can only use their scopes at their own location.
+func TestMiddleware(t *testing.T) {
+	var tools toolkit.Tools
+	registry := NewRegistry(NewMemoryRepository(), &tools)
+
+	token, err := registry.Issue(&models.Device{Name: "Scale house", LocationID: "loc-001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	limited, err := registry.Issue(&models.Device{Name: "Lobby", LocationID: "loc-001", Scopes: []string{ScopeTraineeLookup}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	locationFromQuery := func(r *http.Request) string { return r.URL.Query().Get("location_id") }
+	h := middleware.Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := FromContext(r.Context()); !ok {
+			t.Error("device missing from context")
+		}
+	}), Authenticate(&tools, registry), Require(&tools, ScopeCheckin, locationFromQuery))
+
+	var tests = []struct {
+		name           string
+		header         string
+		token          string
+		location       string
+		expectedStatus int
+	}{
+		{"authorization header", "Authorization", "Device " + token, "loc-001", http.StatusOK},
+		{"device token header", TokenHeader, token, "loc-001", http.StatusOK},
+		{"other location", TokenHeader, token, "loc-002", http.StatusForbidden},
+		{"missing scope", TokenHeader, limited, "loc-001", http.StatusForbidden},
+		{"no token", "", "", "loc-001", http.StatusUnauthorized},
+		{"bad token", TokenHeader, "dvc_nope.nope", "loc-001", http.StatusUnauthorized},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("POST", "/checkin?location_id="+e.location, nil)
+		if e.header != "" {
+			req.Header.Set(e.header, e.token)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: wrong status code recieved: %d", e.name, rr.Code)
+		}
+	}
+}
+
+// failingTouchRepository is a device repository whose last seen updates fail.
+type failingTouchRepository struct {
+	repository.DeviceRepository
+	touches int
+}
+
+// Touch counts the attempt and fails.
+func (r *failingTouchRepository) Touch(id string, lastSeen time.Time) error {
+	r.touches++
+	return errors.New("throttled")
+}
+
+// TestRegistry_Tokens tests that device IDs may contain dots, that secrets use the whole base64url alphabet, and
+// that a failed last seen update does not reject a valid token.
+func TestRegistry_Tokens(t *testing.T) {
+	var tools toolkit.Tools
+	repo := &failingTouchRepository{DeviceRepository: NewMemoryRepository()}
+	registry := NewRegistry(repo, &tools)
+
+	token, err := registry.Issue(&models.Device{ID: "gate.north.1", Name: "North gate", LocationID: "loc-001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		d, err := registry.Verify(token)
+		if err != nil {
+			t.Fatalf("expected a valid token despite the failed touch, recieved %v", err)
+		}
+		if d.ID != "gate.north.1" {
+			t.Errorf("wrong device returned: %s", d.ID)
+		}
+	}
+	if repo.touches != 2 {
+		t.Errorf("expected a failed touch to be retried on the next request, recieved %d touches", repo.touches)
+	}
+
+	// odd characters of the base64url alphabet, which a biased generator never produces
+	seen := make(map[rune]bool)
+	for i := 0; i < 50; i++ {
+		token, err := registry.Issue(&models.Device{Name: "Kiosk", LocationID: "loc-001"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, secret, _ := splitToken(token)
+		for _, c := range secret {
+			seen[c] = true
+		}
+	}
+	for _, c := range "bdfhBDFH13579" {
+		if !seen[c] {
+			t.Errorf("secrets never contain %q, so they are not uniformly random", c)
+		}
+	}
+	if seen['.'] || strings.ContainsAny(token, "+/=") {
+		t.Error("secrets must be unpadded base64url")
+	}
+}
+
+// missingRepository is a device repository that, like LocationDDBRepository, finds nothing without an error.
+type missingRepository struct {
+	repository.DeviceRepository
+}
+
+// FindByID finds no device.
+func (r *missingRepository) FindByID(id string) (*models.Device, error) {
+	return nil, nil
+}
+
+// TestRegistry_Existing tests that an unknown device is an invalid token for a repository returning no device and
+// no error, and that issuing an existing ID neither replaces nor un-revokes the device.
+func TestRegistry_Existing(t *testing.T) {
+	var tools toolkit.Tools
+	repo := NewMemoryRepository()
+	registry := NewRegistry(repo, &tools)
+
+	token, err := registry.Issue(&models.Device{ID: "gate", Name: "Gate", LocationID: "loc-001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewRegistry(&missingRepository{repo}, &tools).Verify(token); err != ErrInvalidToken {
+		t.Errorf("unknown device: expected ErrInvalidToken but got %v", err)
+	}
+	if _, err := NewRegistry(&missingRepository{repo}, &tools).Rotate("gate"); err == nil {
+		t.Error("expected rotating an unknown device to fail")
+	}
+
+	if err := registry.Revoke("gate"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.Issue(&models.Device{ID: "gate", Name: "Gate", LocationID: "loc-002"}); err != ErrDeviceExists {
+		t.Errorf("existing ID: expected ErrDeviceExists but got %v", err)
+	}
+	stored, _ := repo.FindByID("gate")
+	if !stored.Revoked || stored.LocationID != "loc-001" {
+		t.Errorf("expected the revoked device to be left alone: %+v", stored)
+	}
+	if _, err := registry.Verify(token); err != ErrRevoked {
+		t.Errorf("revoked device: expected ErrRevoked but got %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package device
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/babykittenz/api-micro-util/models"
+	"github.com/babykittenz/api-micro-util/repository"
+)
+
+// memoryRepository is an in-memory repository.DeviceRepository for tests and local development.
+type memoryRepository struct {
+	mu      sync.RWMutex
+	devices map[string]models.Device
+}
+
+// NewMemoryRepository returns an empty in-memory DeviceRepository.
+func NewMemoryRepository() repository.DeviceRepository {
+	return &memoryRepository{devices: make(map[string]models.Device)}
+}
+
+// FindByID returns a copy of the device with the given ID.
+func (m *memoryRepository) FindByID(id string) (*models.Device, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	d, ok := m.devices[id]
+	if !ok {
+		return nil, fmt.Errorf("device with id %s not found", id)
+	}
+	return &d, nil
+}
+
+// FindAllByLocationID returns copies of all devices for a location.
+func (m *memoryRepository) FindAllByLocationID(id string) ([]*models.Device, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	devices := []*models.Device{}
+	for _, d := range m.devices {
+		if d.LocationID == id {
+			d := d
+			devices = append(devices, &d)
+		}
+	}
+	return devices, nil
+}
+
+// Save stores a copy of a new device, failing if the ID is taken.
+func (m *memoryRepository) Save(d *models.Device) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.devices[d.ID]; ok {
+		return fmt.Errorf("device with id %s already exists", d.ID)
+	}
+	m.devices[d.ID] = *d
+	return nil
+}
+
+// Update replaces an existing device.
+func (m *memoryRepository) Update(d *models.Device) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.devices[d.ID]; !ok {
+		return fmt.Errorf("device with id %s not found", d.ID)
+	}
+	m.devices[d.ID] = *d
+	return nil
+}
+
+// Delete removes a device.
+func (m *memoryRepository) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.devices, id)
+	return nil
+}
+
+// Touch records when a device was last seen.
+func (m *memoryRepository) Touch(id string, lastSeen time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, ok := m.devices[id]
+	if !ok {
+		return fmt.Errorf("device with id %s not found", id)
+	}
+	d.LastSeen = lastSeen
+	m.devices[id] = d
+	return nil
+}
@@ -0,0 +1,155 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/babykittenz/api-micro-util/storage"
+)
+
+// DownloadOptions controls how ServeFile presents a file to the client.
+type DownloadOptions struct {
+	// Name is the file name shown to the user. It defaults to the last element of the key
+	Name string
+	// Inline asks the browser to display the file, such as a video in a kiosk, rather than save it
+	Inline bool
+	// ContentType overrides the type recorded by the FileStore
+	ContentType string
+	// CacheControl, if set, is sent as the Cache-Control header, e.g. "private, max-age=3600"
+	CacheControl string
+}
+
+// ServeFile writes the file stored under key in t.FileStore to w. Range requests are supported for every store
+// that can seek or read ranges, so videos can be streamed and seeked, and conditional requests are answered
+// with 304 Not Modified using the file's ETag and modification time. Stores that read ranges, such as S3, are
+// asked for the file's details with Stat, and only the bytes the response needs are read. A missing file, or
+// one that cannot be read, is answered with ErrorJSON.
+func (t *Tools) ServeFile(w http.ResponseWriter, r *http.Request, key string, opts DownloadOptions) {
+	store := t.fileStore()
+
+	var rc io.ReadCloser
+	var info storage.ObjectInfo
+	var err error
+	if rg, ok := store.(storage.RangeGetter); ok {
+		info, err = store.Stat(r.Context(), key)
+		if err == nil {
+			rc = storage.NewSeeker(r.Context(), rg, key, info.Size, nil)
+		}
+	} else {
+		rc, info, err = store.Get(r.Context(), key)
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		_ = t.ErrorJSON(w, errors.New("file not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		_ = t.ErrorJSON(w, errors.New("the file could not be read"), http.StatusInternalServerError)
+		return
+	}
+	defer rc.Close()
+
+	name := opts.Name
+	if name == "" {
+		name = path.Base(key)
+	}
+	disposition := "attachment"
+	if opts.Inline {
+		disposition = "inline"
+	}
+	contentType := opts.ContentType
+	if contentType == "" {
+		contentType = info.ContentType
+	}
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(name))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	h := w.Header()
+	h.Set("Content-Disposition", ContentDisposition(disposition, name))
+	h.Set("Content-Type", contentType)
+	h.Set("X-Content-Type-Options", "nosniff")
+	if opts.CacheControl != "" {
+		h.Set("Cache-Control", opts.CacheControl)
+	}
+	if info.ETag != "" {
+		h.Set("ETag", info.ETag)
+	}
+
+	// content that can seek, or be read in ranges, gets range and conditional request support
+	if content, ok := rc.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, name, info.ModTime, content)
+		return
+	}
+
+	if NotModified(r, info.ETag, info.ModTime) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if info.Size > 0 {
+		h.Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+	if !info.ModTime.IsZero() {
+		h.Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, _ = io.Copy(w, rc)
+}
+
+// ContentDisposition returns a Content-Disposition header value of the given disposition type ("inline" or
+// "attachment") for a file name. Names that are not plain ASCII are sent as an RFC 5987 encoded filename*
+// parameter, with an ASCII filename fallback for older clients, as RFC 6266 recommends.
+func ContentDisposition(disposition, name string) string {
+	if name == "" {
+		return disposition
+	}
+
+	var fallback strings.Builder
+	plain := true
+	for _, c := range name {
+		switch {
+		case c == '"' || c == '\\':
+			fallback.WriteByte('\\')
+			fallback.WriteRune(c)
+		case c < 0x20 || c == 0x7f:
+			// control characters could end the header, so they are never sent
+			fallback.WriteByte('_')
+			plain = false
+		case c > 0x7f:
+			fallback.WriteByte('_')
+			plain = false
+		default:
+			fallback.WriteRune(c)
+		}
+	}
+
+	value := fmt.Sprintf("%s; filename=\"%s\"", disposition, fallback.String())
+	if plain {
+		return value
+	}
+	return value + "; filename*=UTF-8''" + encodeRFC5987(name)
+}
+
+// encodeRFC5987 percent-encodes every byte of s that is not an RFC 5987 attr-char.
+func encodeRFC5987(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
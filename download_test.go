@@ -0,0 +1,125 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/babykittenz/api-micro-util/storage"
+)
+
+// rangeStore is a FileStore whose Get cannot seek, like S3, but which can read ranges.
+type rangeStore struct {
+	*storage.MemoryStore
+	gets, ranges int
+}
+
+func (s *rangeStore) Get(ctx context.Context, key string) (io.ReadCloser, storage.ObjectInfo, error) {
+	s.gets++
+	rc, info, err := s.MemoryStore.Get(ctx, key)
+	if err != nil {
+		return nil, info, err
+	}
+	return io.NopCloser(rc), info, nil
+}
+
+func (s *rangeStore) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	s.ranges++
+	rc, info, err := s.MemoryStore.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	b, _ := io.ReadAll(rc)
+	if length <= 0 {
+		length = info.Size - offset
+	}
+	return io.NopCloser(bytes.NewReader(b[offset : offset+length])), nil
+}
+
+var contentDispositionTests = []struct {
+	name        string
+	disposition string
+	fileName    string
+	expected    string
+}{
+	{name: "plain", disposition: "attachment", fileName: "puppy.jpg", expected: `attachment; filename="puppy.jpg"`},
+	{name: "quotes escaped", disposition: "inline", fileName: `say "hi".mp4`, expected: `inline; filename="say \"hi\".mp4"`},
+	{name: "unicode", disposition: "attachment", fileName: "Café menu €.pdf", expected: `attachment; filename="Caf_ menu _.pdf"; filename*=UTF-8''Caf%C3%A9%20menu%20%E2%82%AC.pdf`},
+	{name: "header injection", disposition: "attachment", fileName: "a\r\nSet-Cookie: x.txt", expected: `attachment; filename="a__Set-Cookie: x.txt"; filename*=UTF-8''a%0D%0ASet-Cookie%3A%20x.txt`},
+	{name: "no name", disposition: "inline", expected: "inline"},
+}
+
+func TestContentDisposition(t *testing.T) {
+	for _, e := range contentDispositionTests {
+		if got := ContentDisposition(e.disposition, e.fileName); got != e.expected {
+			t.Errorf("%s: expected %s, recieved %s", e.name, e.expected, got)
+		}
+	}
+}
+
+func TestTools_ServeFile(t *testing.T) {
+	video := strings.Repeat("0123456789", 100)
+	store := &rangeStore{MemoryStore: storage.NewMemoryStore()}
+	info, _ := store.Put(context.Background(), "training/intro.mp4", strings.NewReader(video), "video/mp4")
+
+	testTools := Tools{FileStore: store}
+	opts := DownloadOptions{Name: "Intro.mp4", Inline: true, CacheControl: "private, max-age=3600"}
+
+	// a kiosk seeking into the video
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Range", "bytes=500-509")
+	rr := httptest.NewRecorder()
+	testTools.ServeFile(rr, req, "training/intro.mp4", opts)
+
+	if rr.Code != http.StatusPartialContent || rr.Body.String() != video[500:510] {
+		t.Errorf("expected bytes 500-509, recieved %d %q", rr.Code, rr.Body.String())
+	}
+	if got := rr.Header().Get("Content-Range"); got != "bytes 500-509/1000" {
+		t.Errorf("unexpected content range %s", got)
+	}
+	if got := rr.Header().Get("Content-Disposition"); got != `inline; filename="Intro.mp4"` {
+		t.Errorf("unexpected content disposition %s", got)
+	}
+	if rr.Header().Get("Content-Type") != "video/mp4" || rr.Header().Get("Cache-Control") != "private, max-age=3600" || rr.Header().Get("ETag") != info.ETag {
+		t.Errorf("unexpected headers %v", rr.Header())
+	}
+	if store.ranges != 1 || store.gets != 0 {
+		t.Errorf("expected one ranged read and no full read, recieved %d ranges and %d gets", store.ranges, store.gets)
+	}
+
+	// a full download is read once, from the start
+	rr = httptest.NewRecorder()
+	testTools.ServeFile(rr, httptest.NewRequest("GET", "/", nil), "training/intro.mp4", DownloadOptions{ContentType: "application/octet-stream"})
+	if rr.Code != http.StatusOK || rr.Body.String() != video || store.ranges != 2 {
+		t.Errorf("expected the whole file from one read, recieved %d with %d bytes and %d ranges", rr.Code, rr.Body.Len(), store.ranges)
+	}
+	if rr.Header().Get("Content-Type") != "application/octet-stream" || rr.Header().Get("Content-Disposition") != `attachment; filename="intro.mp4"` {
+		t.Errorf("unexpected headers %v", rr.Header())
+	}
+
+	// a client that already has the file
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("If-None-Match", info.ETag)
+	rr = httptest.NewRecorder()
+	testTools.ServeFile(rr, req, "training/intro.mp4", opts)
+	if rr.Code != http.StatusNotModified || store.ranges != 2 || store.gets != 0 {
+		t.Errorf("expected 304 without reading the file, recieved %d after %d ranges and %d gets", rr.Code, store.ranges, store.gets)
+	}
+
+	rr = httptest.NewRecorder()
+	testTools.ServeFile(rr, httptest.NewRequest("GET", "/", nil), "training/missing.mp4", opts)
+	if rr.Code != http.StatusNotFound || rr.Header().Get("Content-Type") != "application/json" || !strings.Contains(rr.Body.String(), `"error":true`) {
+		t.Errorf("expected a JSON 404, recieved %d %s", rr.Code, rr.Body.String())
+	}
+
+	testTools.ProblemJSON = true
+	rr = httptest.NewRecorder()
+	testTools.ServeFile(rr, httptest.NewRequest("GET", "/", nil), "training/missing.mp4", opts)
+	if rr.Code != http.StatusNotFound || rr.Header().Get("Content-Type") != "application/problem+json" {
+		t.Errorf("expected a problem 404, recieved %d %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,280 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// maxBatch is the most entries EventBridge accepts in one PutEvents request.
+const maxBatch = 10
+
+// AWSOptions configures the EventBridge and SNS publishers.
+type AWSOptions struct {
+	// Region is used for signing and for the default endpoint. It defaults to us-east-1.
+	Region string
+	// Endpoint is the base URL of a compatible service, such as LocalStack, e.g. "http://localhost:4566".
+	// If empty, the AWS endpoint for Region is used.
+	Endpoint string
+	// Credentials signs each request. Requests are sent unsigned if it is nil.
+	Credentials aws.CredentialsProvider
+	// HTTPClient sends the requests. It defaults to a client with a 10 second timeout.
+	HTTPClient *http.Client
+}
+
+// AWSError is an error response returned by EventBridge or SNS.
+type AWSError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+// Error implements the error interface.
+func (e *AWSError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("aws: request failed with status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("aws: %s: %s", e.Code, e.Message)
+}
+
+// awsClient signs and sends requests to a single AWS service.
+type awsClient struct {
+	service string
+	opts    AWSOptions
+	signer  *v4.Signer
+}
+
+// newAWSClient fills in the defaults of opts for service.
+func newAWSClient(service string, opts AWSOptions) awsClient {
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	if opts.Endpoint == "" {
+		opts.Endpoint = fmt.Sprintf("https://%s.%s.amazonaws.com", service, opts.Region)
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return awsClient{service: service, opts: opts, signer: v4.NewSigner()}
+}
+
+// post signs and sends body to the service endpoint and returns the response body. Responses with an error status
+// are returned as the body with an *AWSError, for the caller to fill in from its protocol.
+func (c awsClient) post(ctx context.Context, body []byte, header http.Header) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(c.opts.Endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	if c.opts.Credentials != nil {
+		creds, err := c.opts.Credentials.Retrieve(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+		}
+		hash := sha256.Sum256(body)
+		err = c.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), c.service, c.opts.Region, time.Now().UTC())
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign %s request: %w", c.service, err)
+		}
+	}
+
+	res, err := c.opts.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s response: %w", c.service, err)
+	}
+	if res.StatusCode >= 300 {
+		return b, &AWSError{StatusCode: res.StatusCode}
+	}
+	return b, nil
+}
+
+// EventBridgePublisher publishes events to an Amazon EventBridge event bus with the PutEvents API. Each event becomes
+// an entry with the event's type as its detail type and the whole event as its detail, so rules can match on
+// detail-type or on fields such as detail.company_id.
+type EventBridgePublisher struct {
+	client awsClient
+	bus    string
+}
+
+// NewEventBridgePublisher returns a publisher for the event bus with the given name or ARN. An empty bus uses the
+// account's default bus.
+func NewEventBridgePublisher(bus string, opts AWSOptions) *EventBridgePublisher {
+	return &EventBridgePublisher{client: newAWSClient("events", opts), bus: bus}
+}
+
+// putEventsEntry is an entry of a PutEvents request.
+type putEventsEntry struct {
+	Source       string `json:"Source"`
+	DetailType   string `json:"DetailType"`
+	Detail       string `json:"Detail"`
+	Time         int64  `json:"Time"`
+	EventBusName string `json:"EventBusName,omitempty"`
+}
+
+// Publish sends the events in batches of ten. If EventBridge rejects some entries of a batch, the error names the
+// events that were not published.
+func (p *EventBridgePublisher) Publish(ctx context.Context, events ...Event) error {
+	for start := 0; start < len(events); start += maxBatch {
+		if err := p.putEvents(ctx, events[start:min(start+maxBatch, len(events))]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putEvents sends a single batch.
+func (p *EventBridgePublisher) putEvents(ctx context.Context, events []Event) error {
+	entries := make([]putEventsEntry, len(events))
+	for i, e := range events {
+		detail, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s event: %w", e.Type, err)
+		}
+		entries[i] = putEventsEntry{
+			Source:       e.source(),
+			DetailType:   e.Type,
+			Detail:       string(detail),
+			Time:         e.Time.Unix(),
+			EventBusName: p.bus,
+		}
+	}
+	body, err := json.Marshal(map[string]interface{}{"Entries": entries})
+	if err != nil {
+		return fmt.Errorf("failed to encode PutEvents request: %w", err)
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/x-amz-json-1.1")
+	header.Set("X-Amz-Target", "AWSEvents.PutEvents")
+	b, err := p.client.post(ctx, body, header)
+	if awsErr, ok := err.(*AWSError); ok {
+		var res struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(b, &res)
+		// the type may be prefixed with a namespace, e.g. "com.amazonaws.events#ValidationException"
+		awsErr.Code = res.Type[strings.LastIndex(res.Type, "#")+1:]
+		awsErr.Message = res.Message
+	}
+	if err != nil {
+		return fmt.Errorf("failed to put events: %w", err)
+	}
+
+	var res struct {
+		FailedEntryCount int `json:"FailedEntryCount"`
+		Entries          []struct {
+			ErrorCode    string `json:"ErrorCode"`
+			ErrorMessage string `json:"ErrorMessage"`
+		} `json:"Entries"`
+	}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return fmt.Errorf("failed to decode PutEvents response: %w", err)
+	}
+	if res.FailedEntryCount == 0 {
+		return nil
+	}
+
+	var failed []string
+	for i, entry := range res.Entries {
+		if entry.ErrorCode != "" && i < len(events) {
+			failed = append(failed, fmt.Sprintf("%s (%s: %s)", events[i].ID, entry.ErrorCode, entry.ErrorMessage))
+		}
+	}
+	return fmt.Errorf("failed to put %d of %d events: %s", res.FailedEntryCount, len(events), strings.Join(failed, ", "))
+}
+
+// SNSPublisher publishes events to an Amazon SNS topic. The message is the event as JSON, and the event type and
+// company ID are sent as the message attributes "type" and "company_id", so subscriptions can filter on them. For
+// FIFO topics the subject is the message group and the event ID deduplicates retries.
+type SNSPublisher struct {
+	client   awsClient
+	topicARN string
+}
+
+// NewSNSPublisher returns a publisher for the topic.
+func NewSNSPublisher(topicARN string, opts AWSOptions) *SNSPublisher {
+	return &SNSPublisher{client: newAWSClient("sns", opts), topicARN: topicARN}
+}
+
+// Publish sends each event as a message, in order, stopping at the first that fails.
+func (p *SNSPublisher) Publish(ctx context.Context, events ...Event) error {
+	for _, e := range events {
+		if err := p.publish(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publish sends a single event.
+func (p *SNSPublisher) publish(ctx context.Context, e Event) error {
+	message, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", e.Type, err)
+	}
+
+	form := url.Values{}
+	form.Set("Action", "Publish")
+	form.Set("Version", "2010-03-31")
+	form.Set("TopicArn", p.topicARN)
+	form.Set("Message", string(message))
+	attributes := [][2]string{{"type", e.Type}, {"company_id", e.CompanyID}}
+	n := 0
+	for _, attribute := range attributes {
+		if attribute[1] == "" {
+			continue
+		}
+		n++
+		prefix := "MessageAttributes.entry." + strconv.Itoa(n) + "."
+		form.Set(prefix+"Name", attribute[0])
+		form.Set(prefix+"Value.DataType", "String")
+		form.Set(prefix+"Value.StringValue", attribute[1])
+	}
+	if strings.HasSuffix(p.topicARN, ".fifo") {
+		group := e.Subject
+		if group == "" {
+			group = e.Type
+		}
+		form.Set("MessageGroupId", group)
+		form.Set("MessageDeduplicationId", e.ID)
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	b, err := p.client.post(ctx, []byte(form.Encode()), header)
+	if awsErr, ok := err.(*AWSError); ok {
+		var res struct {
+			Code    string `xml:"Error>Code"`
+			Message string `xml:"Error>Message"`
+		}
+		_ = xml.Unmarshal(b, &res)
+		awsErr.Code, awsErr.Message = res.Code, res.Message
+	}
+	if err != nil {
+		return fmt.Errorf("failed to publish %s event %s: %w", e.Type, e.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+// Package events publishes domain events, such as a trainee checking in or completing a training, so that other
+// services can react to changes without the repositories knowing about them. Repositories create events with New and
+// hand them to a Publisher, which may deliver them in memory, to Amazon EventBridge or SNS, or to an outbox table
+// that is relayed later.
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Event types published by the repositories.
+const (
+	TraineeCreated    = "trainee.created"
+	TraineeUpdated    = "trainee.updated"
+	TraineeDeleted    = "trainee.deleted"
+	TraineeCheckedIn  = "trainee.checked_in"
+	TraineeCheckedOut = "trainee.checked_out"
+	TrainingCompleted = "training.completed"
+	LocationCreated   = "location.created"
+	LocationUpdated   = "location.updated"
+	LocationDeleted   = "location.deleted"
+)
+
+// AllEvents subscribes a handler to every event type.
+const AllEvents = "*"
+
+// DefaultSource is the source of events that do not set one.
+const DefaultSource = "api-micro-util"
+
+// Event is a change to a single record. Data holds the record as JSON after the change, or before it for deletions,
+// so the event can be stored and sent as is; use Decode to read it into a model.
+type Event struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// Source names the service the event came from. Publishers use DefaultSource when it is empty
+	Source string `json:"source,omitempty"`
+	// Subject is the ID of the record the event is about
+	Subject   string          `json:"subject"`
+	CompanyID string          `json:"company_id,omitempty"`
+	Time      time.Time       `json:"time"`
+	Data      json.RawMessage `json:"data,omitempty"`
+}
+
+// New returns an event of eventType about the record subject, with data encoded as JSON, a random ID and the current
+// time.
+func New(eventType, subject, companyID string, data interface{}) (Event, error) {
+	e := Event{
+		ID:        newID(),
+		Type:      eventType,
+		Subject:   subject,
+		CompanyID: companyID,
+		Time:      time.Now().UTC(),
+	}
+	if data != nil {
+		b, err := json.Marshal(data)
+		if err != nil {
+			return Event{}, fmt.Errorf("failed to encode %s event: %w", eventType, err)
+		}
+		e.Data = b
+	}
+	return e, nil
+}
+
+// Decode unmarshals the data of the event into v.
+func (e Event) Decode(v interface{}) error {
+	if len(e.Data) == 0 {
+		return fmt.Errorf("%s event %s has no data", e.Type, e.ID)
+	}
+	if err := json.Unmarshal(e.Data, v); err != nil {
+		return fmt.Errorf("failed to decode %s event: %w", e.Type, err)
+	}
+	return nil
+}
+
+// source returns the source of the event, or DefaultSource.
+func (e Event) source() string {
+	if e.Source == "" {
+		return DefaultSource
+	}
+	return e.Source
+}
+
+// Publisher delivers events to whoever subscribes to them. Publish returns an error if any event could not be
+// delivered; events may be delivered more than once, so subscribers should use the event ID to ignore duplicates.
+type Publisher interface {
+	Publish(ctx context.Context, events ...Event) error
+}
+
+// PublisherFunc adapts a function to a Publisher.
+type PublisherFunc func(ctx context.Context, events ...Event) error
+
+// Publish calls f.
+func (f PublisherFunc) Publish(ctx context.Context, events ...Event) error {
+	return f(ctx, events...)
+}
+
+// newID returns a random 128 bit ID, hex encoded.
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
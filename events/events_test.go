@@ -0,0 +1,172 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+// testCredentials signs requests in tests.
+var testCredentials = credentials.NewStaticCredentialsProvider("AKID", "SECRET", "")
+
+// TestMemoryPublisher verifies handlers receive the events they subscribed to, and handler errors are returned.
+func TestMemoryPublisher(t *testing.T) {
+	p := NewMemoryPublisher()
+	var checkins, all int
+	p.Subscribe(TraineeCheckedIn, func(ctx context.Context, e Event) error {
+		checkins++
+		return nil
+	})
+	p.Subscribe(AllEvents, func(ctx context.Context, e Event) error {
+		all++
+		if e.Type == TraineeDeleted {
+			return errors.New("analytics is down")
+		}
+		return nil
+	})
+
+	checkedIn, _ := New(TraineeCheckedIn, "t1", "acme", map[string]bool{"checked_in": true})
+	deleted, _ := New(TraineeDeleted, "t1", "acme", nil)
+	if err := p.Publish(context.Background(), checkedIn, checkedIn); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Publish(context.Background(), deleted); err == nil || !strings.Contains(err.Error(), "analytics is down") {
+		t.Errorf("expected the handler error, recieved %v", err)
+	}
+
+	if checkins != 2 || all != 3 {
+		t.Errorf("expected 2 check-ins and 3 events handled, recieved %d and %d", checkins, all)
+	}
+	if n := len(p.Events()); n != 3 {
+		t.Errorf("expected 3 events recorded, recieved %d", n)
+	}
+
+	var data map[string]bool
+	if err := checkedIn.Decode(&data); err != nil || !data["checked_in"] {
+		t.Errorf("expected the data to decode: %v %v", data, err)
+	}
+	if err := deleted.Decode(&data); err == nil {
+		t.Error("expected an error decoding an event without data")
+	}
+}
+
+// TestEventBridgePublisher verifies events are sent as signed PutEvents batches of ten, and failed entries reported.
+func TestEventBridgePublisher(t *testing.T) {
+	var batches [][]putEventsEntry
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != "AWSEvents.PutEvents" || !strings.Contains(r.Header.Get("Authorization"), "/events/aws4_request") {
+			t.Errorf("unexpected request headers %v", r.Header)
+		}
+		var req struct{ Entries []putEventsEntry }
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		batches = append(batches, req.Entries)
+
+		if req.Entries[0].DetailType == "bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = io.WriteString(w, `{"__type":"com.amazonaws.events#ValidationException","message":"bus does not exist"}`)
+			return
+		}
+		if len(req.Entries) == 2 {
+			_, _ = io.WriteString(w, `{"FailedEntryCount":1,"Entries":[{"EventId":"1"},{"ErrorCode":"InternalFailure","ErrorMessage":"try again"}]}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"FailedEntryCount":0,"Entries":[]}`)
+	}))
+	defer srv.Close()
+
+	p := NewEventBridgePublisher("trainees", AWSOptions{Endpoint: srv.URL, Credentials: testCredentials})
+	var many []Event
+	for i := 0; i < 12; i++ {
+		e, _ := New(TraineeCheckedIn, "t1", "acme", nil)
+		many = append(many, e)
+	}
+	if err := p.Publish(context.Background(), many...); err == nil || !strings.Contains(err.Error(), many[11].ID) {
+		t.Errorf("expected the failed entry to be reported, recieved %v", err)
+	}
+	if len(batches) != 2 || len(batches[0]) != 10 || len(batches[1]) != 2 {
+		t.Fatalf("expected batches of 10 and 2, recieved %d", len(batches))
+	}
+
+	entry := batches[0][0]
+	var detail Event
+	_ = json.Unmarshal([]byte(entry.Detail), &detail)
+	if entry.Source != DefaultSource || entry.EventBusName != "trainees" || detail.ID != many[0].ID || detail.CompanyID != "acme" {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+
+	bad, _ := New("bad", "t1", "acme", nil)
+	err := p.Publish(context.Background(), bad)
+	var awsErr *AWSError
+	if !errors.As(err, &awsErr) || awsErr.Code != "ValidationException" || awsErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected a ValidationException, recieved %v", err)
+	}
+}
+
+// TestSNSPublisher verifies events are published with filterable attributes, and FIFO fields for FIFO topics.
+func TestSNSPublisher(t *testing.T) {
+	var forms []url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Authorization"), "/sns/aws4_request") {
+			t.Errorf("expected a signed request, recieved %q", r.Header.Get("Authorization"))
+		}
+		_ = r.ParseForm()
+		forms = append(forms, r.PostForm)
+		if strings.Contains(r.PostForm.Get("TopicArn"), "missing") {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, `<ErrorResponse><Error><Type>Sender</Type><Code>NotFound</Code><Message>Topic does not exist</Message></Error></ErrorResponse>`)
+			return
+		}
+		_, _ = io.WriteString(w, `<PublishResponse><PublishResult><MessageId>1</MessageId></PublishResult></PublishResponse>`)
+	}))
+	defer srv.Close()
+
+	opts := AWSOptions{Endpoint: srv.URL, Region: "us-west-2", Credentials: testCredentials}
+	event, _ := New(TrainingCompleted, "t1", "acme", nil)
+
+	var tests = []struct {
+		name     string
+		topic    string
+		wantFIFO bool
+		wantErr  string
+	}{
+		{"standard", "arn:aws:sns:us-west-2:123456789012:trainees", false, ""},
+		{"fifo", "arn:aws:sns:us-west-2:123456789012:trainees.fifo", true, ""},
+		{"missing", "arn:aws:sns:us-west-2:123456789012:missing", false, "NotFound"},
+	}
+
+	for _, e := range tests {
+		forms = nil
+		err := NewSNSPublisher(e.topic, opts).Publish(context.Background(), event)
+		if e.wantErr == "" && err != nil {
+			t.Errorf("%s: %s", e.name, err)
+		}
+		if e.wantErr != "" && (err == nil || !strings.Contains(err.Error(), e.wantErr)) {
+			t.Errorf("%s: expected %s, recieved %v", e.name, e.wantErr, err)
+		}
+		if len(forms) != 1 {
+			t.Errorf("%s: expected 1 request, recieved %d", e.name, len(forms))
+			continue
+		}
+
+		form := forms[0]
+		var message Event
+		_ = json.Unmarshal([]byte(form.Get("Message")), &message)
+		if form.Get("Action") != "Publish" || form.Get("TopicArn") != e.topic || message.ID != event.ID {
+			t.Errorf("%s: unexpected form %v", e.name, form)
+		}
+		if form.Get("MessageAttributes.entry.1.Value.StringValue") != TrainingCompleted || form.Get("MessageAttributes.entry.2.Name") != "company_id" {
+			t.Errorf("%s: expected type and company attributes, recieved %v", e.name, form)
+		}
+		if fifo := form.Get("MessageDeduplicationId") == event.ID && form.Get("MessageGroupId") == "t1"; fifo != e.wantFIFO {
+			t.Errorf("%s: expected fifo %v, recieved %v", e.name, e.wantFIFO, fifo)
+		}
+	}
+}
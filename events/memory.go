@@ -0,0 +1,58 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Handler is called with each event a MemoryPublisher publishes.
+type Handler func(ctx context.Context, e Event) error
+
+// MemoryPublisher delivers events to handlers in the same process, and keeps every published event. It suits tests,
+// and services that react to their own events, such as forwarding them to webhooks.
+type MemoryPublisher struct {
+	mu       sync.Mutex
+	events   []Event
+	handlers map[string][]Handler
+}
+
+// NewMemoryPublisher returns a publisher without any handlers.
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{handlers: make(map[string][]Handler)}
+}
+
+// Subscribe calls h with every event of eventType, or with every event if eventType is AllEvents.
+func (p *MemoryPublisher) Subscribe(eventType string, h Handler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.handlers[eventType] = append(p.handlers[eventType], h)
+}
+
+// Publish records the events and calls the handlers subscribed to them, in order. Every handler is called even if
+// an earlier one fails, and their errors are returned together.
+func (p *MemoryPublisher) Publish(ctx context.Context, events ...Event) error {
+	var errs []error
+	for _, e := range events {
+		p.mu.Lock()
+		p.events = append(p.events, e)
+		handlers := append(append([]Handler(nil), p.handlers[e.Type]...), p.handlers[AllEvents]...)
+		p.mu.Unlock()
+
+		// handlers run without the lock, so they may publish events of their own
+		for _, h := range handlers {
+			if err := h(ctx, e); err != nil {
+				errs = append(errs, fmt.Errorf("failed to handle %s event %s: %w", e.Type, e.ID, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Events returns a copy of the events published so far.
+func (p *MemoryPublisher) Events() []Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Event(nil), p.events...)
+}
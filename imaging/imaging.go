@@ -0,0 +1,245 @@
+// Package imaging prepares uploaded images such as logos and maps for kiosks. It decodes PNG, JPEG and GIF
+// images, turns them upright using their EXIF orientation, re-encodes them without any metadata (which drops
+// EXIF data such as the GPS position of phone photos), and produces smaller renditions.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+// defaultMaxPixels is the largest image decoded when Pipeline.MaxPixels is not set, about a 50 megapixel photo.
+const defaultMaxPixels = 50_000_000
+
+// Output formats.
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+	FormatGIF  = "gif"
+)
+
+// ErrTooLarge is returned when an image has more pixels than Pipeline.MaxPixels.
+var ErrTooLarge = errors.New("image dimensions are too large")
+
+// Rendition describes a resized copy of an image.
+type Rendition struct {
+	// Name identifies the rendition, such as "thumbnail", "kiosk" or "print", and is added to its file name
+	Name string
+	// MaxWidth and MaxHeight bound the rendition's size. The aspect ratio is kept and images are never enlarged.
+	// Zero leaves that dimension unbounded
+	MaxWidth  int
+	MaxHeight int
+	// Format is FormatJPEG or FormatPNG. Empty keeps the format of the original, except GIFs become PNGs
+	Format string
+	// Quality is the JPEG quality from 1 to 100. Zero uses 85
+	Quality int
+}
+
+// Pipeline processes uploaded images.
+type Pipeline struct {
+	// Renditions are produced for every image, in addition to the cleaned original
+	Renditions []Rendition
+	// MaxPixels rejects images with more pixels than this before they are decoded. Zero uses about 50 megapixels
+	MaxPixels int
+}
+
+// Image is an encoded image produced by a Pipeline.
+type Image struct {
+	// Name is the rendition name, or empty for the original
+	Name   string
+	Format string
+	Width  int
+	Height int
+	Data   []byte
+}
+
+// Ext returns the file name extension for the image's format.
+func (i *Image) Ext() string {
+	switch i.Format {
+	case FormatJPEG:
+		return ".jpg"
+	case FormatGIF:
+		return ".gif"
+	default:
+		return ".png"
+	}
+}
+
+// ContentType returns the MIME type of the image's format.
+func (i *Image) ContentType() string {
+	return "image/" + i.Format
+}
+
+// Process decodes data, and returns the original turned upright and re-encoded in its own format without
+// metadata, followed by each rendition. GIFs are returned unchanged as the original, to keep any animation,
+// as they carry no EXIF data.
+func (p *Pipeline) Process(data []byte) (*Image, []*Image, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	maxPixels := p.MaxPixels
+	if maxPixels == 0 {
+		maxPixels = defaultMaxPixels
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, nil, ErrTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	var img image.Image = src
+	if format == FormatJPEG {
+		img = Orient(toRGBA(src), Orientation(data))
+	}
+
+	var original *Image
+	if format == FormatGIF {
+		original = &Image{Format: FormatGIF, Width: cfg.Width, Height: cfg.Height, Data: data}
+	} else if original, err = encode(img, "", format, 0); err != nil {
+		return nil, nil, err
+	}
+
+	renditions := make([]*Image, 0, len(p.Renditions))
+	for _, r := range p.Renditions {
+		out := r.Format
+		if out == "" {
+			out = format
+		}
+		if out == FormatGIF {
+			out = FormatPNG
+		}
+
+		w, h := Fit(img.Bounds().Dx(), img.Bounds().Dy(), r.MaxWidth, r.MaxHeight)
+		rendition, err := encode(Resize(img, w, h), r.Name, out, r.Quality)
+		if err != nil {
+			return nil, nil, err
+		}
+		renditions = append(renditions, rendition)
+	}
+
+	return original, renditions, nil
+}
+
+// encode writes img in format. Quality only applies to JPEG.
+func encode(img image.Image, name, format string, quality int) (*Image, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case FormatJPEG:
+		if quality == 0 {
+			quality = 85
+		}
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	case FormatPNG:
+		err = png.Encode(&buf, img)
+	case FormatGIF:
+		err = gif.Encode(&buf, img, nil)
+	default:
+		return nil, fmt.Errorf("unsupported image format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s image: %w", format, err)
+	}
+
+	return &Image{
+		Name:   name,
+		Format: format,
+		Width:  img.Bounds().Dx(),
+		Height: img.Bounds().Dy(),
+		Data:   buf.Bytes(),
+	}, nil
+}
+
+// Fit returns the largest size within maxWidth by maxHeight with the aspect ratio of width by height, without
+// enlarging it. A zero maximum leaves that dimension unbounded.
+func Fit(width, height, maxWidth, maxHeight int) (int, int) {
+	scale := 1.0
+	if maxWidth > 0 && width > maxWidth {
+		scale = float64(maxWidth) / float64(width)
+	}
+	if maxHeight > 0 && float64(height)*scale > float64(maxHeight) {
+		scale = float64(maxHeight) / float64(height)
+	}
+
+	w, h := int(float64(width)*scale+0.5), int(float64(height)*scale+0.5)
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	return w, h
+}
+
+// Resize scales img to width by height, averaging the source pixels covered by each destination pixel, which
+// gives clean results when shrinking photos.
+func Resize(img image.Image, width, height int) *image.RGBA {
+	src := toRGBA(img)
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	if sw == width && sh == height {
+		copy(dst.Pix, src.Pix)
+		return dst
+	}
+
+	for y := 0; y < height; y++ {
+		y0, y1 := span(y, height, sh)
+		for x := 0; x < width; x++ {
+			x0, x1 := span(x, width, sw)
+
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint32(src.Pix[i])
+					g += uint32(src.Pix[i+1])
+					b += uint32(src.Pix[i+2])
+					a += uint32(src.Pix[i+3])
+					n++
+					i += 4
+				}
+			}
+
+			o := dst.PixOffset(x, y)
+			dst.Pix[o] = uint8(r / n)
+			dst.Pix[o+1] = uint8(g / n)
+			dst.Pix[o+2] = uint8(b / n)
+			dst.Pix[o+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// span returns the range of source pixels covered by destination pixel i, when n destination pixels cover size
+// source pixels. The range always holds at least one pixel.
+func span(i, n, size int) (int, int) {
+	start, end := i*size/n, (i+1)*size/n
+	if end <= start {
+		end = start + 1
+	}
+	if end > size {
+		start, end = size-1, size
+	}
+	return start, end
+}
+
+// toRGBA returns img as an *image.RGBA with bounds starting at the origin, converting it if needed.
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Bounds().Min == (image.Point{}) {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rgba
+}
@@ -0,0 +1,129 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// testPhoto returns a JPEG of width by height whose left half is red and right half is blue, with an EXIF
+// segment recording orientation and a fake GPS string, as a phone camera would write it.
+func testPhoto(t *testing.T, width, height, orientation int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= width/2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a big endian TIFF header with one IFD entry for the orientation
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01")
+	entry := make([]byte, 12)
+	binary.BigEndian.PutUint16(entry[0:], exifOrientationTag)
+	binary.BigEndian.PutUint16(entry[2:], 3) // SHORT
+	binary.BigEndian.PutUint32(entry[4:], 1)
+	binary.BigEndian.PutUint16(entry[8:], uint16(orientation))
+	tiff = append(tiff, entry...)
+	tiff = append(tiff, 0, 0, 0, 0)
+	tiff = append(tiff, "GPS 51.5N 0.1W"...)
+
+	app1 := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(app1)+2))
+	segment = append(segment, app1...)
+
+	data := buf.Bytes()
+	return append(append([]byte{0xFF, 0xD8}, segment...), data[2:]...)
+}
+
+func TestOrientation(t *testing.T) {
+	for _, o := range []int{1, 3, 6, 8} {
+		if got := Orientation(testPhoto(t, 8, 4, o)); got != o {
+			t.Errorf("expected orientation %d, recieved %d", o, got)
+		}
+	}
+
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 1, 1)))
+	if got := Orientation(buf.Bytes()); got != 1 {
+		t.Errorf("expected orientation 1 for a PNG, recieved %d", got)
+	}
+}
+
+var fitTests = []struct {
+	name                          string
+	width, height, maxW, maxH     int
+	expectedWidth, expectedHeight int
+}{
+	{name: "landscape by width", width: 4000, height: 3000, maxW: 400, maxH: 400, expectedWidth: 400, expectedHeight: 300},
+	{name: "portrait by height", width: 3000, height: 4000, maxW: 400, maxH: 400, expectedWidth: 300, expectedHeight: 400},
+	{name: "never enlarged", width: 100, height: 50, maxW: 400, maxH: 400, expectedWidth: 100, expectedHeight: 50},
+	{name: "height unbounded", width: 2000, height: 1000, maxW: 1000, expectedWidth: 1000, expectedHeight: 500},
+}
+
+func TestFit(t *testing.T) {
+	for _, e := range fitTests {
+		w, h := Fit(e.width, e.height, e.maxW, e.maxH)
+		if w != e.expectedWidth || h != e.expectedHeight {
+			t.Errorf("%s: expected %dx%d, recieved %dx%d", e.name, e.expectedWidth, e.expectedHeight, w, h)
+		}
+	}
+}
+
+func TestPipelineProcess(t *testing.T) {
+	pipeline := &Pipeline{Renditions: []Rendition{
+		{Name: "thumbnail", MaxWidth: 20, MaxHeight: 20},
+		{Name: "kiosk", MaxWidth: 60, Format: FormatPNG},
+	}}
+
+	// a landscape photo taken with the camera turned, which should display as portrait
+	original, renditions, err := pipeline.Process(testPhoto(t, 80, 40, 6))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if original.Width != 40 || original.Height != 80 || original.Format != FormatJPEG {
+		t.Errorf("expected an upright 40x80 jpeg original, recieved %dx%d %s", original.Width, original.Height, original.Format)
+	}
+	if bytes.Contains(original.Data, []byte("Exif")) || bytes.Contains(original.Data, []byte("GPS")) {
+		t.Error("expected the EXIF data to be stripped from the original")
+	}
+
+	// after turning clockwise, the red left half is at the top
+	img, err := jpeg.Decode(bytes.NewReader(original.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, _, b, _ := img.At(20, 5).RGBA(); r < b {
+		t.Errorf("expected red at the top after orienting, recieved r=%d b=%d", r, b)
+	}
+
+	if len(renditions) != 2 {
+		t.Fatalf("expected 2 renditions, recieved %d", len(renditions))
+	}
+	if r := renditions[0]; r.Name != "thumbnail" || r.Width != 10 || r.Height != 20 || r.Ext() != ".jpg" {
+		t.Errorf("unexpected thumbnail %s %dx%d %s", r.Name, r.Width, r.Height, r.Ext())
+	}
+	if r := renditions[1]; r.Name != "kiosk" || r.Width != 40 || r.Height != 80 || r.ContentType() != "image/png" {
+		t.Errorf("unexpected kiosk rendition %s %dx%d %s", r.Name, r.Width, r.Height, r.ContentType())
+	}
+}
+
+func TestPipelineMaxPixels(t *testing.T) {
+	pipeline := &Pipeline{MaxPixels: 100}
+	if _, _, err := pipeline.Process(testPhoto(t, 20, 20, 1)); err != ErrTooLarge {
+		t.Errorf("expected ErrTooLarge, recieved %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package lambdahttp
+
+// RESTRequest is an API Gateway REST API proxy event, which is also the HTTP API payload format 1.0.
+type RESTRequest struct {
+	Resource                        string              `json:"resource"`
+	Path                            string              `json:"path"`
+	HTTPMethod                      string              `json:"httpMethod"`
+	Headers                         map[string]string   `json:"headers"`
+	MultiValueHeaders               map[string][]string `json:"multiValueHeaders"`
+	QueryStringParameters           map[string]string   `json:"queryStringParameters"`
+	MultiValueQueryStringParameters map[string][]string `json:"multiValueQueryStringParameters"`
+	PathParameters                  map[string]string   `json:"pathParameters"`
+	StageVariables                  map[string]string   `json:"stageVariables"`
+	RequestContext                  RESTRequestContext  `json:"requestContext"`
+	Body                            string              `json:"body"`
+	IsBase64Encoded                 bool                `json:"isBase64Encoded"`
+}
+
+// RESTRequestContext is the request context of a RESTRequest.
+type RESTRequestContext struct {
+	RequestID  string                 `json:"requestId"`
+	Stage      string                 `json:"stage"`
+	DomainName string                 `json:"domainName"`
+	Identity   RESTIdentity           `json:"identity"`
+	Authorizer map[string]interface{} `json:"authorizer,omitempty"`
+}
+
+// RESTIdentity holds the caller details of a RESTRequest.
+type RESTIdentity struct {
+	SourceIP  string `json:"sourceIp"`
+	UserAgent string `json:"userAgent"`
+}
+
+// RESTResponse is the response returned to API Gateway for a RESTRequest.
+type RESTResponse struct {
+	StatusCode        int                 `json:"statusCode"`
+	Headers           map[string]string   `json:"headers,omitempty"`
+	MultiValueHeaders map[string][]string `json:"multiValueHeaders,omitempty"`
+	Body              string              `json:"body"`
+	IsBase64Encoded   bool                `json:"isBase64Encoded"`
+}
+
+// V2Request is an API Gateway HTTP API payload format 2.0 event. Lambda function URLs use the same format.
+type V2Request struct {
+	Version               string            `json:"version"`
+	RouteKey              string            `json:"routeKey"`
+	RawPath               string            `json:"rawPath"`
+	RawQueryString        string            `json:"rawQueryString"`
+	Cookies               []string          `json:"cookies,omitempty"`
+	Headers               map[string]string `json:"headers"`
+	QueryStringParameters map[string]string `json:"queryStringParameters,omitempty"`
+	PathParameters        map[string]string `json:"pathParameters,omitempty"`
+	StageVariables        map[string]string `json:"stageVariables,omitempty"`
+	RequestContext        V2RequestContext  `json:"requestContext"`
+	Body                  string            `json:"body"`
+	IsBase64Encoded       bool              `json:"isBase64Encoded"`
+}
+
+// V2RequestContext is the request context of a V2Request.
+type V2RequestContext struct {
+	RequestID  string                 `json:"requestId"`
+	DomainName string                 `json:"domainName"`
+	Stage      string                 `json:"stage"`
+	HTTP       V2HTTPDescription      `json:"http"`
+	Authorizer map[string]interface{} `json:"authorizer,omitempty"`
+}
+
+// V2HTTPDescription describes the HTTP request of a V2Request.
+type V2HTTPDescription struct {
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Protocol  string `json:"protocol"`
+	SourceIP  string `json:"sourceIp"`
+	UserAgent string `json:"userAgent"`
+}
+
+// V2Response is the response returned to API Gateway or a function URL for a V2Request.
+type V2Response struct {
+	StatusCode      int               `json:"statusCode"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	Cookies         []string          `json:"cookies,omitempty"`
+	Body            string            `json:"body"`
+	IsBase64Encoded bool              `json:"isBase64Encoded"`
+}
@@ -0,0 +1,297 @@
+// Package lambdahttp runs net/http handlers built with toolkit.Tools under AWS Lambda. It converts API Gateway
+// REST API, HTTP API (payload 1.0 and 2.0) and Lambda function URL events into *http.Request values, and the
+// handler's response back into the matching event response, so the same handlers serve Lambda and a local server.
+//
+// The aws-lambda-go runtime accepts the function returned by Handler directly:
+//
+//	lambda.Start(lambdahttp.Handler(mux))
+package lambdahttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// contextKey is the type of context keys set by this package.
+type contextKey int
+
+const eventKey contextKey = iota
+
+// Handler adapts h to a Lambda handler. The event format is detected from the payload, and the response is
+// returned in the same format.
+func Handler(h http.Handler) func(ctx context.Context, event json.RawMessage) (json.RawMessage, error) {
+	return func(ctx context.Context, event json.RawMessage) (json.RawMessage, error) {
+		var probe struct {
+			Version    string `json:"version"`
+			HTTPMethod string `json:"httpMethod"`
+		}
+		if err := json.Unmarshal(event, &probe); err != nil {
+			return nil, fmt.Errorf("failed to decode Lambda event: %w", err)
+		}
+
+		if probe.Version == "2.0" {
+			var e V2Request
+			if err := json.Unmarshal(event, &e); err != nil {
+				return nil, fmt.Errorf("failed to decode HTTP API event: %w", err)
+			}
+			r, err := RequestFromV2(ctx, &e)
+			if err != nil {
+				return nil, err
+			}
+			w := NewResponseWriter()
+			h.ServeHTTP(w, r)
+			return json.Marshal(w.V2Response())
+		}
+
+		if probe.HTTPMethod == "" {
+			return nil, fmt.Errorf("unsupported Lambda event: not an API Gateway or function URL request")
+		}
+		var e RESTRequest
+		if err := json.Unmarshal(event, &e); err != nil {
+			return nil, fmt.Errorf("failed to decode REST API event: %w", err)
+		}
+		r, err := RequestFromREST(ctx, &e)
+		if err != nil {
+			return nil, err
+		}
+		w := NewResponseWriter()
+		h.ServeHTTP(w, r)
+		return json.Marshal(w.RESTResponse())
+	}
+}
+
+// EventFromContext returns the *RESTRequest or *V2Request the request was built from, or nil when the request
+// did not come through Lambda.
+func EventFromContext(ctx context.Context) interface{} {
+	return ctx.Value(eventKey)
+}
+
+// RequestFromREST builds an *http.Request from a REST API (or HTTP API payload 1.0) event. Multi-value headers
+// and query parameters are used when present, falling back to the single value maps.
+func RequestFromREST(ctx context.Context, e *RESTRequest) (*http.Request, error) {
+	body, err := decodeBody(e.Body, e.IsBase64Encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	if len(e.MultiValueQueryStringParameters) > 0 {
+		for k, values := range e.MultiValueQueryStringParameters {
+			query[k] = append(query[k], values...)
+		}
+	} else {
+		for k, v := range e.QueryStringParameters {
+			query.Set(k, v)
+		}
+	}
+
+	u := &url.URL{Path: e.Path, RawQuery: query.Encode()}
+	r, err := http.NewRequestWithContext(context.WithValue(ctx, eventKey, e), e.HTTPMethod, u.RequestURI(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request from REST API event: %w", err)
+	}
+
+	if len(e.MultiValueHeaders) > 0 {
+		for k, values := range e.MultiValueHeaders {
+			for _, v := range values {
+				r.Header.Add(k, v)
+			}
+		}
+	} else {
+		for k, v := range e.Headers {
+			r.Header.Set(k, v)
+		}
+	}
+
+	host := r.Header.Get("Host")
+	if host == "" {
+		host = e.RequestContext.DomainName
+	}
+	finishRequest(r, host, e.RequestContext.Identity.SourceIP, e.RequestContext.RequestID, len(body))
+	return r, nil
+}
+
+// RequestFromV2 builds an *http.Request from an HTTP API payload 2.0 or function URL event. Headers with several
+// values arrive comma separated, and cookies arrive in a separate list, which is restored as a Cookie header.
+func RequestFromV2(ctx context.Context, e *V2Request) (*http.Request, error) {
+	body, err := decodeBody(e.Body, e.IsBase64Encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	path := e.RawPath
+	if path == "" {
+		path = e.RequestContext.HTTP.Path
+	}
+	u := &url.URL{Path: path, RawQuery: e.RawQueryString}
+	r, err := http.NewRequestWithContext(context.WithValue(ctx, eventKey, e), e.RequestContext.HTTP.Method, u.RequestURI(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request from HTTP API event: %w", err)
+	}
+
+	for k, v := range e.Headers {
+		r.Header.Set(k, v)
+	}
+	if len(e.Cookies) > 0 {
+		r.Header.Set("Cookie", strings.Join(e.Cookies, "; "))
+	}
+
+	host := r.Header.Get("Host")
+	if host == "" {
+		host = e.RequestContext.DomainName
+	}
+	finishRequest(r, host, e.RequestContext.HTTP.SourceIP, e.RequestContext.RequestID, len(body))
+	return r, nil
+}
+
+// finishRequest fills in the parts of r that net/http sets for a server request.
+func finishRequest(r *http.Request, host, sourceIP, requestID string, length int) {
+	r.Host = host
+	r.URL.Host = host
+	r.RemoteAddr = sourceIP
+	r.RequestURI = r.URL.RequestURI()
+	r.ContentLength = int64(length)
+	if requestID != "" && r.Header.Get("X-Amzn-Request-Id") == "" {
+		r.Header.Set("X-Amzn-Request-Id", requestID)
+	}
+}
+
+// decodeBody returns the raw bytes of an event body.
+func decodeBody(body string, isBase64 bool) ([]byte, error) {
+	if !isBase64 {
+		return []byte(body), nil
+	}
+	b, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode base64 request body: %w", err)
+	}
+	return b, nil
+}
+
+// ResponseWriter is an http.ResponseWriter that buffers a response so it can be returned as a Lambda event response.
+type ResponseWriter struct {
+	header      http.Header
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+// NewResponseWriter returns an empty ResponseWriter.
+func NewResponseWriter() *ResponseWriter {
+	return &ResponseWriter{header: http.Header{}}
+}
+
+// Header returns the response headers.
+func (w *ResponseWriter) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader records the status code. Only the first call has any effect.
+func (w *ResponseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.status = status
+	w.wroteHeader = true
+}
+
+// Write buffers b as part of the response body.
+func (w *ResponseWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
+
+// Flush is a no-op, as Lambda returns the response in one piece. It lets streaming handlers run unchanged.
+func (w *ResponseWriter) Flush() {}
+
+// StatusCode returns the status code written, defaulting to 200.
+func (w *ResponseWriter) StatusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// RESTResponse returns the buffered response for a REST API event, with every header value preserved.
+func (w *ResponseWriter) RESTResponse() *RESTResponse {
+	body, isBase64 := w.encodeBody()
+	headers := make(map[string][]string, len(w.header))
+	for k, v := range w.header {
+		headers[k] = append([]string(nil), v...)
+	}
+	return &RESTResponse{
+		StatusCode:        w.StatusCode(),
+		MultiValueHeaders: headers,
+		Body:              body,
+		IsBase64Encoded:   isBase64,
+	}
+}
+
+// V2Response returns the buffered response for an HTTP API payload 2.0 or function URL event. Headers with several
+// values are joined with commas, and Set-Cookie headers are moved to the cookie list.
+func (w *ResponseWriter) V2Response() *V2Response {
+	body, isBase64 := w.encodeBody()
+	res := &V2Response{
+		StatusCode:      w.StatusCode(),
+		Headers:         make(map[string]string, len(w.header)),
+		Body:            body,
+		IsBase64Encoded: isBase64,
+	}
+
+	keys := make([]string, 0, len(w.header))
+	for k := range w.header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if http.CanonicalHeaderKey(k) == "Set-Cookie" {
+			res.Cookies = append(res.Cookies, w.header[k]...)
+			continue
+		}
+		res.Headers[k] = strings.Join(w.header[k], ",")
+	}
+	return res
+}
+
+// encodeBody returns the body as a string, base64 encoded unless it is uncompressed text.
+func (w *ResponseWriter) encodeBody() (string, bool) {
+	if isText(w.header) {
+		return w.body.String(), false
+	}
+	return base64.StdEncoding.EncodeToString(w.body.Bytes()), true
+}
+
+// isText reports whether a response with the given headers can be returned to API Gateway as a plain string.
+func isText(h http.Header) bool {
+	if enc := h.Get("Content-Encoding"); enc != "" && enc != "identity" {
+		return false
+	}
+	contentType := h.Get("Content-Type")
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/x-ndjson", "application/xml", "application/javascript",
+		"application/x-www-form-urlencoded", "image/svg+xml":
+		return true
+	}
+	return false
+}
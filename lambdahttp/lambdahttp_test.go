@@ -0,0 +1,210 @@
+package lambdahttp
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	toolkit "github.com/babykittenz/api-micro-util"
+)
+
+// echoHandler writes back what it received, so tests can check the request conversion and the response conversion together.
+func echoHandler(t *testing.T) http.Handler {
+	var tools toolkit.Tools
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Header().Add("Set-Cookie", "a=1")
+		w.Header().Add("Set-Cookie", "b=2")
+		w.Header().Add("X-Multi", "one")
+		w.Header().Add("X-Multi", "two")
+		_ = tools.WriteJSON(w, http.StatusCreated, map[string]interface{}{
+			"method":  r.Method,
+			"path":    r.URL.Path,
+			"query":   r.URL.Query(),
+			"accept":  r.Header.Values("Accept"),
+			"cookie":  r.Header.Get("Cookie"),
+			"body":    string(body),
+			"host":    r.Host,
+			"remote":  r.RemoteAddr,
+			"isEvent": EventFromContext(r.Context()) != nil,
+		})
+	})
+}
+
+var lambdaTests = []struct {
+	name        string
+	event       string
+	wantMethod  string
+	wantPath    string
+	wantQuery   map[string][]string
+	wantAccept  []string
+	wantCookie  string
+	wantBody    string
+	wantHost    string
+	wantRemote  string
+	wantV2      bool
+	wantHeaders int
+}{
+	{
+		name: "rest api with multi-value headers and base64 body",
+		event: `{"resource":"/trainees","path":"/trainees","httpMethod":"POST",
+			"headers":{"Accept":"application/json","Host":"api.example.com"},
+			"multiValueHeaders":{"Accept":["application/json","text/plain"],"Host":["api.example.com"]},
+			"queryStringParameters":{"tag":"b"},
+			"multiValueQueryStringParameters":{"tag":["a","b"]},
+			"requestContext":{"requestId":"abc","stage":"prod","identity":{"sourceIp":"203.0.113.5"}},
+			"body":"` + base64.StdEncoding.EncodeToString([]byte(`{"first_name":"Jo"}`)) + `","isBase64Encoded":true}`,
+		wantMethod: "POST",
+		wantPath:   "/trainees",
+		wantQuery:  map[string][]string{"tag": {"a", "b"}},
+		wantAccept: []string{"application/json", "text/plain"},
+		wantBody:   `{"first_name":"Jo"}`,
+		wantHost:   "api.example.com",
+		wantRemote: "203.0.113.5",
+	},
+	{
+		name: "http api payload 2.0 with cookies",
+		event: `{"version":"2.0","routeKey":"GET /trainees/{id}","rawPath":"/trainees/42","rawQueryString":"tag=a&tag=b",
+			"cookies":["session=x","theme=dark"],"headers":{"accept":"application/json"},
+			"requestContext":{"requestId":"def","domainName":"abc.execute-api.us-east-1.amazonaws.com",
+			"http":{"method":"GET","path":"/trainees/42","sourceIp":"198.51.100.7"}},"isBase64Encoded":false}`,
+		wantMethod: "GET",
+		wantPath:   "/trainees/42",
+		wantQuery:  map[string][]string{"tag": {"a", "b"}},
+		wantAccept: []string{"application/json"},
+		wantCookie: "session=x; theme=dark",
+		wantHost:   "abc.execute-api.us-east-1.amazonaws.com",
+		wantRemote: "198.51.100.7",
+		wantV2:     true,
+	},
+	{
+		name: "function url",
+		event: `{"version":"2.0","routeKey":"$default","rawPath":"/checkin","rawQueryString":"",
+			"headers":{"host":"xyz.lambda-url.us-east-1.on.aws","content-type":"application/json"},
+			"requestContext":{"requestId":"ghi","domainName":"xyz.lambda-url.us-east-1.on.aws",
+			"http":{"method":"PUT","path":"/checkin","sourceIp":"192.0.2.1"}},
+			"body":"{\"id\":\"1\"}","isBase64Encoded":false}`,
+		wantMethod: "PUT",
+		wantPath:   "/checkin",
+		wantQuery:  map[string][]string{},
+		wantBody:   `{"id":"1"}`,
+		wantHost:   "xyz.lambda-url.us-east-1.on.aws",
+		wantRemote: "192.0.2.1",
+		wantV2:     true,
+	},
+}
+
+func TestHandler(t *testing.T) {
+	handler := Handler(echoHandler(t))
+
+	for _, e := range lambdaTests {
+		raw, err := handler(context.Background(), json.RawMessage(e.event))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", e.name, err)
+			continue
+		}
+
+		var status int
+		var body string
+		if e.wantV2 {
+			var res V2Response
+			if err := json.Unmarshal(raw, &res); err != nil {
+				t.Fatal(err)
+			}
+			status, body = res.StatusCode, res.Body
+			if !reflect.DeepEqual(res.Cookies, []string{"a=1", "b=2"}) {
+				t.Errorf("%s: expected cookies to be moved out of the headers, recieved %v", e.name, res.Cookies)
+			}
+			if res.Headers["X-Multi"] != "one,two" {
+				t.Errorf("%s: expected joined header values, recieved %q", e.name, res.Headers["X-Multi"])
+			}
+		} else {
+			var res RESTResponse
+			if err := json.Unmarshal(raw, &res); err != nil {
+				t.Fatal(err)
+			}
+			status, body = res.StatusCode, res.Body
+			if !reflect.DeepEqual(res.MultiValueHeaders["Set-Cookie"], []string{"a=1", "b=2"}) {
+				t.Errorf("%s: expected both cookies, recieved %v", e.name, res.MultiValueHeaders["Set-Cookie"])
+			}
+		}
+
+		if status != http.StatusCreated {
+			t.Errorf("%s: expected status 201, recieved %d", e.name, status)
+		}
+
+		var got struct {
+			Method  string              `json:"method"`
+			Path    string              `json:"path"`
+			Query   map[string][]string `json:"query"`
+			Accept  []string            `json:"accept"`
+			Cookie  string              `json:"cookie"`
+			Body    string              `json:"body"`
+			Host    string              `json:"host"`
+			Remote  string              `json:"remote"`
+			IsEvent bool                `json:"isEvent"`
+		}
+		if err := json.Unmarshal([]byte(body), &got); err != nil {
+			t.Errorf("%s: response body is not JSON: %s", e.name, body)
+			continue
+		}
+
+		if got.Method != e.wantMethod || got.Path != e.wantPath || got.Body != e.wantBody || got.Cookie != e.wantCookie {
+			t.Errorf("%s: unexpected request %+v", e.name, got)
+		}
+		if got.Host != e.wantHost || got.Remote != e.wantRemote {
+			t.Errorf("%s: expected host %s and remote %s, recieved %s and %s", e.name, e.wantHost, e.wantRemote, got.Host, got.Remote)
+		}
+		if !reflect.DeepEqual(got.Query, e.wantQuery) {
+			t.Errorf("%s: expected query %v, recieved %v", e.name, e.wantQuery, got.Query)
+		}
+		if e.wantAccept != nil && !reflect.DeepEqual(got.Accept, e.wantAccept) {
+			t.Errorf("%s: expected accept %v, recieved %v", e.name, e.wantAccept, got.Accept)
+		}
+		if !got.IsEvent {
+			t.Errorf("%s: expected the event in the request context", e.name)
+		}
+	}
+}
+
+func TestHandlerBinaryResponse(t *testing.T) {
+	png := []byte{0x89, 'P', 'N', 'G', 0, 1, 2}
+	handler := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write(png)
+	}))
+
+	raw, err := handler(context.Background(), json.RawMessage(`{"version":"2.0","rawPath":"/logo.png","requestContext":{"http":{"method":"GET"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var res V2Response
+	if err := json.Unmarshal(raw, &res); err != nil {
+		t.Fatal(err)
+	}
+	if !res.IsBase64Encoded {
+		t.Fatal("expected binary body to be base64 encoded")
+	}
+	if b, _ := base64.StdEncoding.DecodeString(res.Body); string(b) != string(png) {
+		t.Errorf("expected body to round trip, recieved %v", b)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected default status 200, recieved %d", res.StatusCode)
+	}
+}
+
+func TestHandlerUnsupportedEvent(t *testing.T) {
+	_, err := Handler(http.NotFoundHandler())(context.Background(), json.RawMessage(`{"Records":[]}`))
+	if err == nil || !strings.Contains(err.Error(), "unsupported") {
+		t.Errorf("expected unsupported event error, recieved %v", err)
+	}
+}
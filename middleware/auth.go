@@ -0,0 +1,168 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	toolkit "github.com/babykittenz/api-micro-util"
+	"github.com/babykittenz/api-micro-util/models"
+)
+
+// userKey is the context key for the authenticated user.
+type userKey struct{}
+
+// ClaimMapping names the token claims that are copied onto models.User. The defaults match the custom
+// attributes of our Cognito user pools.
+type ClaimMapping struct {
+	ID         string
+	Email      string
+	FirstName  string
+	LastName   string
+	Phone      string
+	Role       string
+	Groups     string
+	CompanyID  string
+	RegionID   string
+	LocationID string
+}
+
+// DefaultClaimMapping is used for any ClaimMapping field left empty.
+var DefaultClaimMapping = ClaimMapping{
+	ID:         "sub",
+	Email:      "email",
+	FirstName:  "given_name",
+	LastName:   "family_name",
+	Phone:      "phone_number",
+	Role:       "custom:role",
+	Groups:     "cognito:groups",
+	CompanyID:  "custom:company_id",
+	RegionID:   "custom:region_id",
+	LocationID: "custom:location_id",
+}
+
+// AuthOptions configures the Authenticate middleware.
+type AuthOptions struct {
+	Keys   *KeySet
+	Verify VerifyOptions
+	Claims ClaimMapping
+}
+
+// Authenticate verifies the bearer token on every request and stores the resulting models.User in the request
+// context. Requests with a missing or invalid token are rejected with a 401 written by tools.ErrorJSON. It panics
+// if opts.Keys is nil, as no token could ever be verified.
+func Authenticate(tools *toolkit.Tools, opts AuthOptions) Middleware {
+	if opts.Keys == nil {
+		panic("middleware: Authenticate requires AuthOptions.Keys")
+	}
+	mapping := opts.Claims.withDefaults()
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerToken(r)
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Bearer`)
+				_ = tools.ErrorJSON(w, errors.New("authorization token required"), http.StatusUnauthorized)
+				return
+			}
+
+			claims, err := VerifyToken(token, opts.Keys, opts.Verify)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				_ = tools.ErrorJSON(w, err, http.StatusUnauthorized)
+				return
+			}
+
+			user := mapping.User(claims)
+			next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), user)))
+		})
+	}
+}
+
+// RequireRole rejects requests whose authenticated user does not have one of the given roles with a 403.
+// Requests without an authenticated user are rejected with a 401. It must run after Authenticate.
+func RequireRole(tools *toolkit.Tools, roles ...string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := UserFromContext(r.Context())
+			if !ok {
+				_ = tools.ErrorJSON(w, errors.New("authentication required"), http.StatusUnauthorized)
+				return
+			}
+
+			for _, role := range roles {
+				if strings.EqualFold(user.Role, role) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			_ = tools.ErrorJSON(w, errors.New("you do not have permission to access this resource"), http.StatusForbidden)
+		})
+	}
+}
+
+// User maps verified claims onto a models.User. If the role claim is missing, the first group is used as the role.
+func (m ClaimMapping) User(claims *Claims) *models.User {
+	user := &models.User{
+		ID:         claims.String(m.ID),
+		FirstName:  claims.String(m.FirstName),
+		LastName:   claims.String(m.LastName),
+		Email:      claims.String(m.Email),
+		Phone:      claims.String(m.Phone),
+		Role:       claims.String(m.Role),
+		CompanyID:  claims.String(m.CompanyID),
+		RegionID:   claims.String(m.RegionID),
+		LocationID: claims.String(m.LocationID),
+	}
+	if user.Role == "" {
+		if groups := claims.Strings(m.Groups); len(groups) > 0 {
+			user.Role = groups[0]
+		}
+	}
+	return user
+}
+
+// withDefaults fills any empty claim names from DefaultClaimMapping.
+func (m ClaimMapping) withDefaults() ClaimMapping {
+	d := DefaultClaimMapping
+	pick := func(v, def string) string {
+		if v == "" {
+			return def
+		}
+		return v
+	}
+	return ClaimMapping{
+		ID:         pick(m.ID, d.ID),
+		Email:      pick(m.Email, d.Email),
+		FirstName:  pick(m.FirstName, d.FirstName),
+		LastName:   pick(m.LastName, d.LastName),
+		Phone:      pick(m.Phone, d.Phone),
+		Role:       pick(m.Role, d.Role),
+		Groups:     pick(m.Groups, d.Groups),
+		CompanyID:  pick(m.CompanyID, d.CompanyID),
+		RegionID:   pick(m.RegionID, d.RegionID),
+		LocationID: pick(m.LocationID, d.LocationID),
+	}
+}
+
+// bearerToken returns the token from an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// WithUser returns a copy of ctx carrying the authenticated user.
+func WithUser(ctx context.Context, user *models.User) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// UserFromContext returns the user stored by Authenticate.
+func UserFromContext(ctx context.Context) (*models.User, bool) {
+	user, ok := ctx.Value(userKey{}).(*models.User)
+	return user, ok && user != nil
+}
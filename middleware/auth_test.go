@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	toolkit "github.com/babykittenz/api-micro-util"
+)
+
+// signTestToken builds a compact JWS token for the claims, signed with an HMAC secret or RSA private key.
+func signTestToken(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		sum := sha256.Sum256([]byte(signed))
+		var err error
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, sum[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// TestAuthenticate verifies HS256 and RS256 tokens, claim mapping and rejection of bad tokens.
+func TestAuthenticate(t *testing.T) {
+	var tools toolkit.Tools
+	secret := []byte("super-secret")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// write the RSA public key to a JWKS file, the way we'd ship a copy of the Cognito jwks.json
+	jwks := fmt.Sprintf(`{"keys":[{"kty":"RSA","kid":"rsa-1","alg":"RS256","use":"sig","n":%q,"e":%q}]}`,
+		base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()))
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksPath, []byte(jwks), 0644); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := LoadJWKSFile(jwksPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys.Add(Key{ID: "hmac-1", Alg: "HS256", Secret: secret})
+
+	claims := func(extra map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub":                "user-1",
+			"iss":                "https://issuer.example.com",
+			"aud":                "kiosk-app",
+			"exp":                time.Now().Add(time.Hour).Unix(),
+			"token_use":          "access",
+			"email":              "admin@example.com",
+			"cognito:groups":     []string{"admin"},
+			"custom:company_id":  "comp-001",
+			"custom:region_id":   "reg-001",
+			"custom:location_id": "loc-001",
+		}
+		for k, v := range extra {
+			if v == nil {
+				delete(c, k)
+				continue
+			}
+			c[k] = v
+		}
+		return c
+	}
+
+	var tests = []struct {
+		name           string
+		token          string
+		expectedStatus int
+	}{
+		{"hs256", signTestToken(t, "HS256", "hmac-1", secret, claims(nil)), http.StatusOK},
+		{"rs256", signTestToken(t, "RS256", "rsa-1", rsaKey, claims(nil)), http.StatusOK},
+		{"missing token", "", http.StatusUnauthorized},
+		{"wrong secret", signTestToken(t, "HS256", "hmac-1", []byte("wrong"), claims(nil)), http.StatusUnauthorized},
+		{"alg confusion", signTestToken(t, "HS256", "rsa-1", secret, claims(nil)), http.StatusUnauthorized},
+		{"unknown key", signTestToken(t, "HS256", "nope", secret, claims(nil)), http.StatusUnauthorized},
+		{"no expiry", signTestToken(t, "HS256", "hmac-1", secret, claims(map[string]interface{}{"exp": nil})), http.StatusUnauthorized},
+		{"id token", signTestToken(t, "HS256", "hmac-1", secret, claims(map[string]interface{}{"token_use": "id"})), http.StatusUnauthorized},
+		{"expired", signTestToken(t, "HS256", "hmac-1", secret, claims(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()})), http.StatusUnauthorized},
+		{"wrong issuer", signTestToken(t, "HS256", "hmac-1", secret, claims(map[string]interface{}{"iss": "https://evil.example.com"})), http.StatusUnauthorized},
+		{"wrong audience", signTestToken(t, "HS256", "hmac-1", secret, claims(map[string]interface{}{"aud": "other-app"})), http.StatusUnauthorized},
+		{"wrong role", signTestToken(t, "HS256", "hmac-1", secret, claims(map[string]interface{}{"custom:role": "trainee"})), http.StatusForbidden},
+	}
+
+	opts := AuthOptions{Keys: keys, Verify: VerifyOptions{Issuer: "https://issuer.example.com", Audience: "kiosk-app", TokenUse: "access"}}
+
+	for _, e := range tests {
+		var seen bool
+		h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := UserFromContext(r.Context())
+			if !ok || user.ID != "user-1" || user.Role != "admin" || user.CompanyID != "comp-001" || user.LocationID != "loc-001" {
+				t.Errorf("%s: wrong user in context %+v", e.name, user)
+			}
+			seen = true
+		}), Authenticate(&tools, opts), RequireRole(&tools, "admin"))
+
+		req := httptest.NewRequest("GET", "/", nil)
+		if e.token != "" {
+			req.Header.Set("Authorization", "Bearer "+e.token)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: wrong status code recieved: %d", e.name, rr.Code)
+		}
+		if seen != (e.expectedStatus == http.StatusOK) {
+			t.Errorf("%s: handler called: %v", e.name, seen)
+		}
+	}
+}
+
+// TestAuthenticate_NilKeys verifies that Authenticate refuses to be built without keys, and that VerifyToken
+// rejects tokens rather than panicking when given a nil key set.
+func TestAuthenticate_NilKeys(t *testing.T) {
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected Authenticate to panic without keys")
+			}
+		}()
+		Authenticate(&toolkit.Tools{}, AuthOptions{})
+	}()
+
+	token := signTestToken(t, "HS256", "", []byte("secret"), map[string]interface{}{"exp": time.Now().Add(time.Hour).Unix()})
+	if _, err := VerifyToken(token, nil, VerifyOptions{}); err != ErrUnknownKey {
+		t.Errorf("wrong error recieved: %v", err)
+	}
+}
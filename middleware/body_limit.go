@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	toolkit "github.com/babykittenz/api-micro-util"
+)
+
+// MaxBodySize limits request bodies to maxBytes. Requests that declare a larger Content-Length are rejected
+// up front with a 413 written by tools.ErrorJSON; bodies that turn out to be larger while being read fail
+// with an error from http.MaxBytesReader.
+func MaxBodySize(tools *toolkit.Tools, maxBytes int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > maxBytes {
+				_ = tools.ErrorJSON(w, fmt.Errorf("body must not be larger than %d bytes", maxBytes), http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
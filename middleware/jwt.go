@@ -0,0 +1,302 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// Errors returned when a token cannot be verified.
+var (
+	ErrTokenMalformed = errors.New("token is malformed")
+	ErrTokenSignature = errors.New("token signature is invalid")
+	ErrTokenExpired   = errors.New("token has expired")
+	ErrTokenNotYet    = errors.New("token is not valid yet")
+	ErrTokenIssuer    = errors.New("token issuer is not accepted")
+	ErrTokenAudience  = errors.New("token audience is not accepted")
+	ErrTokenUse       = errors.New("token use is not accepted")
+	ErrUnknownKey     = errors.New("token signing key is unknown")
+)
+
+// Key is a single verification key. Alg is HS256 (using Secret) or RS256 (using PublicKey).
+type Key struct {
+	ID        string
+	Alg       string
+	Secret    []byte
+	PublicKey *rsa.PublicKey
+}
+
+// KeySet holds the keys tokens are verified against, keyed by key ID. A token without a kid header can only
+// be verified when the set contains exactly one key.
+type KeySet struct {
+	keys map[string]Key
+}
+
+// NewKeySet returns a key set containing the given keys.
+func NewKeySet(keys ...Key) *KeySet {
+	ks := &KeySet{keys: make(map[string]Key)}
+	for _, k := range keys {
+		ks.Add(k)
+	}
+	return ks
+}
+
+// Add adds or replaces a key in the set.
+func (ks *KeySet) Add(k Key) {
+	if ks.keys == nil {
+		ks.keys = make(map[string]Key)
+	}
+	ks.keys[k.ID] = k
+}
+
+// lookup finds the key for kid, falling back to the only key when kid is empty. A nil set has no keys.
+func (ks *KeySet) lookup(kid string) (Key, bool) {
+	if ks == nil {
+		return Key{}, false
+	}
+	if k, ok := ks.keys[kid]; ok {
+		return k, true
+	}
+	if kid == "" && len(ks.keys) == 1 {
+		for _, k := range ks.keys {
+			return k, true
+		}
+	}
+	return Key{}, false
+}
+
+// jwk is a single JSON Web Key, as found in a JWKS document.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	K   string `json:"k"`
+}
+
+// ParseJWKS builds a key set from a JWKS document. RSA keys are used for RS256, and symmetric (oct) keys
+// for HS256. Keys meant for encryption are skipped.
+func ParseJWKS(data []byte) (*KeySet, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("unable to parse JWKS: %w", err)
+	}
+
+	ks := NewKeySet()
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(k.N)
+			if err != nil {
+				return nil, fmt.Errorf("key %s has a bad modulus: %w", k.Kid, err)
+			}
+			e, err := base64.RawURLEncoding.DecodeString(k.E)
+			if err != nil {
+				return nil, fmt.Errorf("key %s has a bad exponent: %w", k.Kid, err)
+			}
+			ks.Add(Key{
+				ID:        k.Kid,
+				Alg:       "RS256",
+				PublicKey: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())},
+			})
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil {
+				return nil, fmt.Errorf("key %s has a bad secret: %w", k.Kid, err)
+			}
+			ks.Add(Key{ID: k.Kid, Alg: "HS256", Secret: secret})
+		}
+	}
+
+	if len(ks.keys) == 0 {
+		return nil, errors.New("JWKS does not contain any signing keys")
+	}
+	return ks, nil
+}
+
+// LoadJWKSFile reads a JWKS document from disk, such as a copy of a Cognito user pool's jwks.json.
+func LoadJWKSFile(path string) (*KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+// Claims are the claims of a verified token. Registered claims are parsed, and every claim is available in Raw.
+type Claims struct {
+	Subject   string
+	Issuer    string
+	Audience  []string
+	ExpiresAt time.Time
+	NotBefore time.Time
+	IssuedAt  time.Time
+	Raw       map[string]interface{}
+}
+
+// String returns the named claim as a string, or an empty string if it is missing or not a string.
+func (c *Claims) String(name string) string {
+	s, _ := c.Raw[name].(string)
+	return s
+}
+
+// Strings returns the named claim as a list of strings. A single string claim is returned as a list of one.
+func (c *Claims) Strings(name string) []string {
+	switch v := c.Raw[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// VerifyOptions are the checks applied to a token after its signature is verified. Empty values are not checked,
+// except for the expiry, which every token must have.
+type VerifyOptions struct {
+	Issuer   string
+	Audience string
+	// TokenUse is the token_use claim tokens must carry, "access" or "id" for Cognito, so that one kind of token
+	// cannot be used in place of the other
+	TokenUse string
+	Leeway   time.Duration
+	Now      func() time.Time
+}
+
+// VerifyToken checks the signature of a compact JWS token against the key set, then checks the time based
+// claims, issuer, audience and token use. The algorithm in the token header must match the algorithm of the key,
+// so an HS256 token can never be verified with an RSA public key. Tokens without an exp claim never expire, so
+// they are rejected as malformed.
+func VerifyToken(token string, keys *KeySet, opts VerifyOptions) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenMalformed
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrTokenMalformed
+	}
+
+	key, ok := keys.lookup(header.Kid)
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if header.Alg != key.Alg {
+		return nil, ErrTokenSignature
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	switch key.Alg {
+	case "HS256":
+		mac := hmac.New(sha256.New, key.Secret)
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, ErrTokenSignature
+		}
+	case "RS256":
+		sum := sha256.Sum256(signed)
+		if key.PublicKey == nil || rsa.VerifyPKCS1v15(key.PublicKey, crypto.SHA256, sum[:], signature) != nil {
+			return nil, ErrTokenSignature
+		}
+	default:
+		return nil, ErrTokenSignature
+	}
+
+	raw := make(map[string]interface{})
+	if err := decodeSegment(parts[1], &raw); err != nil {
+		return nil, ErrTokenMalformed
+	}
+	claims := &Claims{Raw: raw}
+	claims.Subject = claims.String("sub")
+	claims.Issuer = claims.String("iss")
+	claims.Audience = claims.Strings("aud")
+	claims.ExpiresAt = numericDate(raw["exp"])
+	claims.NotBefore = numericDate(raw["nbf"])
+	claims.IssuedAt = numericDate(raw["iat"])
+
+	now := time.Now()
+	if opts.Now != nil {
+		now = opts.Now()
+	}
+	if claims.ExpiresAt.IsZero() {
+		return nil, ErrTokenMalformed
+	}
+	if now.After(claims.ExpiresAt.Add(opts.Leeway)) {
+		return nil, ErrTokenExpired
+	}
+	if !claims.NotBefore.IsZero() && now.Before(claims.NotBefore.Add(-opts.Leeway)) {
+		return nil, ErrTokenNotYet
+	}
+	if opts.Issuer != "" && claims.Issuer != opts.Issuer {
+		return nil, ErrTokenIssuer
+	}
+	if opts.TokenUse != "" && claims.String("token_use") != opts.TokenUse {
+		return nil, ErrTokenUse
+	}
+	if opts.Audience != "" {
+		// Cognito access tokens carry the app client in client_id rather than aud
+		audience := append(append([]string{}, claims.Audience...), claims.String("client_id"))
+		found := false
+		for _, a := range audience {
+			if a == opts.Audience {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, ErrTokenAudience
+		}
+	}
+
+	return claims, nil
+}
+
+// decodeSegment decodes a base64url encoded JSON token segment into v.
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// numericDate converts a JSON NumericDate claim into a time, returning a zero time if it is missing.
+func numericDate(v interface{}) time.Time {
+	f, ok := v.(float64)
+	if !ok {
+		return time.Time{}
+	}
+	sec := int64(f)
+	return time.Unix(sec, int64((f-float64(sec))*1e9))
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	toolkit "github.com/babykittenz/api-micro-util"
+)
+
+// AccessLog logs one line per request with the method, path, status, response size, duration and request ID.
+// If logger is nil the standard logger is used.
+func AccessLog(logger *log.Logger) Middleware {
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			sw := wrapWriter(w)
+
+			next.ServeHTTP(sw, r)
+
+			logger.Printf("%s %s %d %d %s request_id=%s remote=%s",
+				r.Method,
+				r.URL.RequestURI(),
+				sw.status,
+				sw.bytes,
+				time.Since(start).Round(time.Microsecond),
+				sw.Header().Get(toolkit.RequestIDHeader),
+				r.RemoteAddr)
+		})
+	}
+}
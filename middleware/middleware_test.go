@@ -0,0 +1,184 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	toolkit "github.com/babykittenz/api-micro-util"
+)
+
+// TestChain verifies that middleware runs in the order given.
+func TestChain(t *testing.T) {
+	var order []string
+	mark := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	}), mark("first"), mark("second"))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if strings.Join(order, ",") != "first,second,handler" {
+		t.Errorf("wrong order %v", order)
+	}
+}
+
+// TestRequestID verifies request IDs are generated, or kept when valid, and made available to the handler.
+func TestRequestID(t *testing.T) {
+	var tools toolkit.Tools
+	var seen string
+	h := RequestID(&tools)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+	}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if len(seen) != requestIDLength || rr.Header().Get(toolkit.RequestIDHeader) != seen {
+		t.Errorf("expected generated request id, got %q and header %q", seen, rr.Header().Get(toolkit.RequestIDHeader))
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(toolkit.RequestIDHeader, "from-gateway-123")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if seen != "from-gateway-123" {
+		t.Errorf("expected incoming request id to be kept, got %q", seen)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(toolkit.RequestIDHeader, "bad id\nwith newline")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if len(seen) != requestIDLength {
+		t.Errorf("expected invalid request id to be replaced, got %q", seen)
+	}
+}
+
+// TestRecover verifies a panic becomes a 500 JSON error and is logged.
+func TestRecover(t *testing.T) {
+	var tools toolkit.Tools
+	var logs bytes.Buffer
+
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}), RequestID(&tools), Recover(&tools, log.New(&logs, "", 0)))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("wrong status code recieved: %d", rr.Code)
+	}
+
+	var payload toolkit.JSONResponse
+	if err := json.NewDecoder(rr.Body).Decode(&payload); err != nil || !payload.Error {
+		t.Errorf("expected a json error payload, got %v (%v)", payload, err)
+	}
+
+	if !strings.Contains(logs.String(), "boom") {
+		t.Error("panic was not logged")
+	}
+}
+
+// TestAccessLog verifies the access log line contains the status, size and request ID.
+func TestAccessLog(t *testing.T) {
+	var tools toolkit.Tools
+	var logs bytes.Buffer
+
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		_, _ = w.Write([]byte("short and stout"))
+	}), AccessLog(log.New(&logs, "", 0)), RequestID(&tools))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/tea?cup=1", nil))
+
+	line := logs.String()
+	for _, want := range []string{"GET /tea?cup=1 418 15", "request_id=" + rr.Header().Get(toolkit.RequestIDHeader)} {
+		if !strings.Contains(line, want) {
+			t.Errorf("access log %q does not contain %q", line, want)
+		}
+	}
+}
+
+// corsTests is a test table for the CORS middleware, listing the request and the expected CORS headers.
+var corsTests = []struct {
+	name           string
+	options        CORSOptions
+	method         string
+	origin         string
+	expectedOrigin string
+	expectedStatus int
+}{
+	{"allowed origin", CORSOptions{AllowedOrigins: []string{"https://admin.example.com"}}, "GET", "https://admin.example.com", "https://admin.example.com", http.StatusOK},
+	{"disallowed origin", CORSOptions{AllowedOrigins: []string{"https://admin.example.com"}}, "GET", "https://evil.example.com", "", http.StatusOK},
+	{"wildcard", CORSOptions{AllowedOrigins: []string{"*"}}, "GET", "https://kiosk.example.com", "*", http.StatusOK},
+	{"wildcard with credentials", CORSOptions{AllowedOrigins: []string{"*"}, AllowCredentials: true}, "GET", "https://kiosk.example.com", "https://kiosk.example.com", http.StatusOK},
+	{"preflight", CORSOptions{AllowedOrigins: []string{"*"}, MaxAge: time.Hour}, "OPTIONS", "https://kiosk.example.com", "*", http.StatusNoContent},
+}
+
+// TestCORS runs every entry in corsTests.
+func TestCORS(t *testing.T) {
+	for _, e := range corsTests {
+		h := CORS(e.options)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		req := httptest.NewRequest(e.method, "/", nil)
+		req.Header.Set("Origin", e.origin)
+		if e.method == "OPTIONS" {
+			req.Header.Set("Access-Control-Request-Method", "POST")
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if got := rr.Header().Get("Access-Control-Allow-Origin"); got != e.expectedOrigin {
+			t.Errorf("%s: wrong allow origin %q", e.name, got)
+		}
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: wrong status code recieved: %d", e.name, rr.Code)
+		}
+		if e.method == "OPTIONS" && rr.Header().Get("Access-Control-Max-Age") != "3600" {
+			t.Errorf("%s: wrong max age %q", e.name, rr.Header().Get("Access-Control-Max-Age"))
+		}
+	}
+}
+
+// TestMaxBodySize verifies oversized bodies are rejected, whether declared up front or discovered while reading.
+func TestMaxBodySize(t *testing.T) {
+	var tools toolkit.Tools
+	h := MaxBodySize(&tools, 10)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			_ = tools.ErrorJSON(w, err, http.StatusRequestEntityTooLarge)
+		}
+	}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("POST", "/", strings.NewReader("this body is far too long")))
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("declared length: wrong status code recieved: %d", rr.Code)
+	}
+
+	req := httptest.NewRequest("POST", "/", io.NopCloser(strings.NewReader("this body is far too long")))
+	req.ContentLength = -1
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("unknown length: wrong status code recieved: %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("POST", "/", strings.NewReader("small")))
+	if rr.Code != http.StatusOK {
+		t.Errorf("small body: wrong status code recieved: %d", rr.Code)
+	}
+}
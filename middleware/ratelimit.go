@@ -0,0 +1,228 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	toolkit "github.com/babykittenz/api-micro-util"
+)
+
+// Limit describes a token bucket: Rate tokens are added every Per, up to Burst tokens. A request takes one token.
+type Limit struct {
+	Rate  int
+	Per   time.Duration
+	Burst int
+}
+
+// refillRate returns the number of tokens added per second.
+func (l Limit) refillRate() float64 {
+	if l.Per <= 0 || l.Rate <= 0 {
+		return 0
+	}
+	return float64(l.Rate) / l.Per.Seconds()
+}
+
+// BucketState is the stored state of one token bucket.
+type BucketState struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+// RateLimitResult is the outcome of taking a token from a bucket.
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// TakeToken refills the bucket for the time elapsed since it was last updated, then tries to take one token.
+// A zero state is treated as a full bucket. It is used by every RateLimitStore so they behave the same.
+func TakeToken(state BucketState, limit Limit, now time.Time) (BucketState, RateLimitResult) {
+	burst := float64(limit.Burst)
+	rate := limit.refillRate()
+
+	tokens := burst
+	if !state.Updated.IsZero() {
+		elapsed := now.Sub(state.Updated).Seconds()
+		if elapsed < 0 {
+			elapsed = 0
+		}
+		tokens = math.Min(burst, state.Tokens+elapsed*rate)
+	}
+
+	result := RateLimitResult{Limit: limit.Burst}
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else if rate > 0 {
+		result.RetryAfter = time.Duration((1 - tokens) / rate * float64(time.Second))
+	}
+
+	result.Remaining = int(math.Floor(tokens))
+	if rate > 0 {
+		result.Reset = time.Duration((burst - tokens) / rate * float64(time.Second))
+	}
+
+	return BucketState{Tokens: tokens, Updated: now}, result
+}
+
+// ErrRateLimitContended is returned by a RateLimitStore that could not apply TakeToken to a bucket because other
+// requests kept changing it. A burst of concurrent requests on one key is what a limit is for, so RateLimit denies the
+// request instead of letting it through as it does for other store errors.
+var ErrRateLimitContended = errors.New("rate limit bucket is too contended")
+
+// ContendedResult is the denial returned with ErrRateLimitContended: no tokens left, and a retry once a token would
+// have been added.
+func ContendedResult(limit Limit) RateLimitResult {
+	retry := time.Second
+	if rate := limit.refillRate(); rate > 0 {
+		retry = time.Duration(float64(time.Second) / rate)
+	}
+	return RateLimitResult{Limit: limit.Burst, Reset: retry, RetryAfter: retry}
+}
+
+// RateLimitStore keeps token buckets by key. Implementations must apply TakeToken atomically per key.
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (RateLimitResult, error)
+}
+
+// MemoryStore is an in-process RateLimitStore. It is suitable for a single server, or as a first line of
+// defence in each Lambda instance; use a shared store when limits must hold across instances.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]BucketState
+	calls   int
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]BucketState)}
+}
+
+// Take takes a token from the bucket for key.
+func (m *MemoryStore) Take(_ context.Context, key string, limit Limit, now time.Time) (RateLimitResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.buckets == nil {
+		m.buckets = make(map[string]BucketState)
+	}
+
+	state, result := TakeToken(m.buckets[key], limit, now)
+	m.buckets[key] = state
+
+	// every so often drop buckets that have refilled completely, since they are the same as a missing bucket
+	m.calls++
+	if m.calls%1000 == 0 {
+		for k, s := range m.buckets {
+			if _, r := TakeToken(s, limit, now); r.Remaining+1 >= limit.Burst {
+				delete(m.buckets, k)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// KeyFunc returns the rate limit key for a request. An empty key means the KeyFunc does not apply.
+type KeyFunc func(r *http.Request) string
+
+// KeyByIP keys requests by client IP. With no trusted proxies the connection's address is used; under Lambda,
+// lambdahttp sets it to the source IP of the request context, which is the right choice there. Behind proxies that
+// append to X-Forwarded-For (API Gateway, a load balancer, CloudFront), trustedProxies is how many of them there
+// are, and the address the outermost one appended is used. Entries to the left of that were sent by the client and
+// could be anything, so they are never used.
+func KeyByIP(trustedProxies int) KeyFunc {
+	return func(r *http.Request) string {
+		if trustedProxies > 0 {
+			if fwd := r.Header.Values("X-Forwarded-For"); len(fwd) > 0 {
+				hops := strings.Split(strings.Join(fwd, ","), ",")
+				if len(hops) >= trustedProxies {
+					return "ip:" + strings.TrimSpace(hops[len(hops)-trustedProxies])
+				}
+			}
+		}
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		return "ip:" + host
+	}
+}
+
+// KeyByUser keys requests by the ID of the user stored by Authenticate.
+func KeyByUser(r *http.Request) string {
+	if user, ok := UserFromContext(r.Context()); ok && user.ID != "" {
+		return "user:" + user.ID
+	}
+	return ""
+}
+
+// KeyFirst uses the first KeyFunc that returns a key, e.g. KeyFirst(KeyByUser, KeyByIP(0)).
+func KeyFirst(funcs ...KeyFunc) KeyFunc {
+	return func(r *http.Request) string {
+		for _, f := range funcs {
+			if key := f(r); key != "" {
+				return key
+			}
+		}
+		return ""
+	}
+}
+
+// RateLimit limits requests per key using store. Every response gets RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers, and requests over the limit get a 429 with Retry-After, written by tools.ErrorJSON.
+// Requests without a key are not limited. If the store fails the request is let through and the error logged,
+// so an outage of the store does not take the API down with it, except for ErrRateLimitContended, which is a 429.
+func RateLimit(tools *toolkit.Tools, store RateLimitStore, limit Limit, key KeyFunc) Middleware {
+	policy := strconv.Itoa(limit.Burst) + ";w=" + strconv.Itoa(int(math.Ceil(limit.Per.Seconds())))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			k := key(r)
+			if k == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			result, err := store.Take(r.Context(), k, limit, time.Now())
+			if errors.Is(err, ErrRateLimitContended) {
+				log.Printf("rate limit denied for %s: %v", k, err)
+				result, err = ContendedResult(limit), nil
+			}
+			if err != nil {
+				log.Printf("rate limit store failed for %s: %v", k, err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Policy", policy)
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+			if !result.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+				_ = tools.ErrorJSON(w, errors.New("too many requests, please try again later"), http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ceilSeconds rounds d up to whole seconds.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,167 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	toolkit "github.com/babykittenz/api-micro-util"
+)
+
+// TestTakeToken verifies the token bucket refills at the configured rate and never exceeds the burst.
+func TestTakeToken(t *testing.T) {
+	limit := Limit{Rate: 1, Per: time.Second, Burst: 3}
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var state BucketState
+	var result RateLimitResult
+	for i := 0; i < 3; i++ {
+		state, result = TakeToken(state, limit, now)
+		if !result.Allowed {
+			t.Fatalf("request %d should be allowed", i)
+		}
+	}
+	if result.Remaining != 0 {
+		t.Errorf("expected 0 remaining but got %d", result.Remaining)
+	}
+
+	state, result = TakeToken(state, limit, now)
+	if result.Allowed || result.RetryAfter != time.Second {
+		t.Errorf("expected denial with 1s retry, got %+v", result)
+	}
+
+	state, result = TakeToken(state, limit, now.Add(1500*time.Millisecond))
+	if !result.Allowed {
+		t.Error("expected a token after refill")
+	}
+
+	_, result = TakeToken(state, limit, now.Add(time.Hour))
+	if result.Remaining != 2 {
+		t.Errorf("bucket must not exceed burst, remaining %d", result.Remaining)
+	}
+}
+
+// TestRateLimit verifies the middleware headers and 429 responses, and that keys are limited separately.
+func TestRateLimit(t *testing.T) {
+	var tools toolkit.Tools
+	store := NewMemoryStore()
+	h := RateLimit(&tools, store, Limit{Rate: 2, Per: time.Minute, Burst: 2}, KeyByIP(1))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	send := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/trainees/phone/5554567890", nil)
+		req.Header.Set("X-Forwarded-For", "10.0.0.1, "+ip)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i := 0; i < 2; i++ {
+		if rr := send("203.0.113.5"); rr.Code != http.StatusOK {
+			t.Fatalf("request %d: wrong status code recieved: %d", i, rr.Code)
+		}
+	}
+
+	rr := send("203.0.113.5")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("wrong status code recieved: %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") != "30" || rr.Header().Get("RateLimit-Remaining") != "0" || rr.Header().Get("RateLimit-Limit") != "2" {
+		t.Errorf("wrong rate limit headers: %v", rr.Header())
+	}
+
+	if rr := send("198.51.100.7"); rr.Code != http.StatusOK {
+		t.Errorf("other client: wrong status code recieved: %d", rr.Code)
+	}
+}
+
+// failingStore is a RateLimitStore that always errors.
+type failingStore struct{}
+
+// Take always fails.
+func (failingStore) Take(context.Context, string, Limit, time.Time) (RateLimitResult, error) {
+	return RateLimitResult{}, context.DeadlineExceeded
+}
+
+// TestRateLimitFailOpen verifies requests are let through when the store fails.
+func TestRateLimitFailOpen(t *testing.T) {
+	var tools toolkit.Tools
+	h := RateLimit(&tools, failingStore{}, Limit{Rate: 1, Per: time.Minute, Burst: 1}, KeyByIP(0))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("wrong status code recieved: %d", rr.Code)
+	}
+}
+
+// contendedStore is a RateLimitStore whose buckets are always too contended to update.
+type contendedStore struct{}
+
+// Take always gives up.
+func (contendedStore) Take(context.Context, string, Limit, time.Time) (RateLimitResult, error) {
+	return RateLimitResult{}, ErrRateLimitContended
+}
+
+// TestRateLimitContended verifies a contended bucket denies the request instead of failing open.
+func TestRateLimitContended(t *testing.T) {
+	var tools toolkit.Tools
+	h := RateLimit(&tools, contendedStore{}, Limit{Rate: 2, Per: time.Minute, Burst: 2}, KeyByIP(0))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("wrong status code recieved: %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") != "30" || rr.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("wrong rate limit headers: %v", rr.Header())
+	}
+}
+
+// TestKeyByIP verifies that only the addresses appended by trusted proxies are used, so a client cannot get a fresh
+// bucket by forging the start of X-Forwarded-For.
+func TestKeyByIP(t *testing.T) {
+	var tools toolkit.Tools
+	h := RateLimit(&tools, NewMemoryStore(), Limit{Rate: 1, Per: time.Minute, Burst: 1}, KeyByIP(1))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("GET", "/trainees/phone/5554567890", nil)
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("192.0.2.%d, 203.0.113.5", i))
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		expected := http.StatusTooManyRequests
+		if i == 0 {
+			expected = http.StatusOK
+		}
+		if rr.Code != expected {
+			t.Errorf("request %d with forged first hop: wrong status code recieved: %d", i, rr.Code)
+		}
+	}
+
+	var tests = []struct {
+		name           string
+		trustedProxies int
+		forwarded      []string
+		expectedKey    string
+	}{
+		{"no proxies", 0, []string{"192.0.2.1"}, "ip:198.51.100.9"},
+		{"one proxy", 1, []string{"192.0.2.1, 203.0.113.5"}, "ip:203.0.113.5"},
+		{"two proxies", 2, []string{"192.0.2.1, 203.0.113.5, 10.0.0.1"}, "ip:203.0.113.5"},
+		{"repeated header", 2, []string{"192.0.2.1", "203.0.113.5, 10.0.0.1"}, "ip:203.0.113.5"},
+		{"too few hops", 2, []string{"203.0.113.5"}, "ip:198.51.100.9"},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "198.51.100.9:1234"
+		for _, v := range e.forwarded {
+			req.Header.Add("X-Forwarded-For", v)
+		}
+		if key := KeyByIP(e.trustedProxies)(req); key != e.expectedKey {
+			t.Errorf("%s: wrong key recieved: %s", e.name, key)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	toolkit "github.com/babykittenz/api-micro-util"
+)
+
+// Recover turns a panic in a handler into a 500 response written with tools.ErrorJSON, and logs the panic
+// with its stack trace. If logger is nil the standard logger is used. http.ErrAbortHandler is re-panicked,
+// since it is used to deliberately abort a response.
+func Recover(tools *toolkit.Tools, logger *log.Logger) Middleware {
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sw := wrapWriter(w)
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+
+				logger.Printf("panic serving %s %s (request id %s): %v\n%s", r.Method, r.URL.Path, RequestIDFromContext(r.Context()), rec, debug.Stack())
+
+				// if the handler already started the response there is nothing useful we can send
+				if sw.wroteHeader {
+					return
+				}
+				_ = tools.ErrorJSON(sw, errors.New("internal server error"), http.StatusInternalServerError)
+			}()
+
+			next.ServeHTTP(sw, r)
+		})
+	}
+}
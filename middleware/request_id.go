@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	toolkit "github.com/babykittenz/api-micro-util"
+)
+
+// requestIDKey is the context key for the request ID.
+type requestIDKey struct{}
+
+// requestIDLength is the length of generated request IDs.
+const requestIDLength = 24
+
+// validRequestID limits incoming request IDs to safe characters, so they can be logged and echoed back.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9_+\-.:]{1,128}$`)
+
+// RequestID makes sure every request has an ID. A valid X-Request-ID header sent by the client (or a gateway in
+// front of us) is kept, otherwise one is generated with tools.RandomString. The ID is set on the response
+// headers, so ErrorJSON can include it in problem documents, and stored in the request context.
+func RequestID(tools *toolkit.Tools) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(toolkit.RequestIDHeader)
+			if !validRequestID.MatchString(id) {
+				id = tools.RandomString(requestIDLength)
+			}
+
+			w.Header().Set(toolkit.RequestIDHeader, id)
+			r.Header.Set(toolkit.RequestIDHeader, id)
+			next.ServeHTTP(w, r.WithContext(WithRequestID(r.Context(), id)))
+		})
+	}
+}
+
+// WithRequestID returns a copy of ctx carrying the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID stored by RequestID, or an empty string if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
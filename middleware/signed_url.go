@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	toolkit "github.com/babykittenz/api-micro-util"
+)
+
+// NonceStore records the nonces of single use signed URLs. Use must be atomic, so two requests racing with the
+// same URL cannot both succeed.
+type NonceStore interface {
+	// Use records nonce and reports whether it was unused. Expires is when the URL expires, after which the
+	// nonce no longer needs to be kept.
+	Use(ctx context.Context, nonce string, expires time.Time) (bool, error)
+}
+
+// MemoryNonceStore is an in-process NonceStore. Single use only holds within one server or Lambda instance, so
+// use a shared store such as DynamoDB in production.
+type MemoryNonceStore struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+}
+
+// NewMemoryNonceStore returns an empty MemoryNonceStore.
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{nonces: make(map[string]time.Time)}
+}
+
+// Use records nonce, dropping nonces whose URLs have expired.
+func (m *MemoryNonceStore) Use(_ context.Context, nonce string, expires time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.nonces == nil {
+		m.nonces = make(map[string]time.Time)
+	}
+
+	now := time.Now()
+	for k, e := range m.nonces {
+		if now.After(e) {
+			delete(m.nonces, k)
+		}
+	}
+
+	if _, used := m.nonces[nonce]; used {
+		return false, nil
+	}
+	m.nonces[nonce] = expires
+	return true, nil
+}
+
+// SignedURL only lets through requests for URLs signed by signer that have not expired, such as download links
+// shared with inspectors. Single use URLs are checked against nonces, which may be nil if no URLs are signed for
+// single use. Rejected requests get a 403 written by tools.ErrorJSON. Unlike RateLimit, a failing NonceStore
+// rejects the request, since letting it through would make the link reusable, but with a 503 rather than a 403 so
+// clients know the link may still work if they try again later.
+func SignedURL(tools *toolkit.Tools, signer *toolkit.URLSigner, nonces NonceStore) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			nonce, expires, err := signer.Verify(r.URL, time.Now())
+			if err != nil {
+				_ = tools.ErrorJSON(w, err, http.StatusForbidden)
+				return
+			}
+
+			if nonce != "" {
+				if nonces == nil {
+					_ = tools.ErrorJSON(w, errors.New("single use links are not supported"), http.StatusForbidden)
+					return
+				}
+				unused, err := nonces.Use(r.Context(), nonce, expires)
+				if err != nil {
+					log.Printf("nonce store failed for signed URL %s: %v", r.URL.Path, err)
+					_ = tools.ErrorJSON(w, errors.New("unable to verify link, please try again later"), http.StatusServiceUnavailable)
+					return
+				}
+				if !unused {
+					_ = tools.ErrorJSON(w, errors.New("link has already been used"), http.StatusForbidden)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	toolkit "github.com/babykittenz/api-micro-util"
+)
+
+// failingNonceStore is a NonceStore that cannot be reached.
+type failingNonceStore struct{}
+
+// Use always fails.
+func (failingNonceStore) Use(context.Context, string, time.Time) (bool, error) {
+	return false, errors.New("table unavailable")
+}
+
+// TestSignedURL verifies signed links reach the handler, and single use links only once.
+func TestSignedURL(t *testing.T) {
+	var tools toolkit.Tools
+	signer := toolkit.NewURLSigner([]byte("secret"))
+	h := SignedURL(&tools, signer, NewMemoryNonceStore())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	send := func(u string) int {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest("GET", u, nil))
+		return rr.Code
+	}
+
+	reusable, _ := signer.Sign("/files/agreements/acme.pdf", time.Now().Add(time.Hour), false)
+	for i := 0; i < 2; i++ {
+		if code := send(reusable); code != http.StatusOK {
+			t.Errorf("expected a reusable link to work twice, request %d got %d", i, code)
+		}
+	}
+
+	once, _ := signer.Sign("/files/certificates/jane.pdf", time.Now().Add(time.Hour), true)
+	if code := send(once); code != http.StatusOK {
+		t.Errorf("expected a single use link to work once, got %d", code)
+	}
+	if code := send(once); code != http.StatusForbidden {
+		t.Errorf("expected a used link to be refused, got %d", code)
+	}
+
+	expired, _ := signer.Sign("/files/agreements/acme.pdf", time.Now().Add(-time.Minute), false)
+	if code := send(expired); code != http.StatusForbidden {
+		t.Errorf("expected an expired link to be refused, got %d", code)
+	}
+	if code := send("/files/agreements/acme.pdf"); code != http.StatusForbidden {
+		t.Errorf("expected an unsigned link to be refused, got %d", code)
+	}
+
+	noNonces := SignedURL(&tools, signer, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rr := httptest.NewRecorder()
+	noNonces.ServeHTTP(rr, httptest.NewRequest("GET", once, nil))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected single use links to be refused without a nonce store, got %d", rr.Code)
+	}
+
+	broken := SignedURL(&tools, signer, failingNonceStore{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rr = httptest.NewRecorder()
+	broken.ServeHTTP(rr, httptest.NewRequest("GET", once, nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected a failing nonce store to give a 503, got %d", rr.Code)
+	}
+}
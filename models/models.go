@@ -5,11 +5,11 @@ import "time"
 // User represents a system user with authentication and access permissions.
 type User struct {
 	ID         string `json:"id"`
-	FirstName  string `json:"first_name"`
-	LastName   string `json:"last_name"`
-	Email      string `json:"email"`
-	Phone      string `json:"phone"`
-	Role       string `json:"role"`
+	FirstName  string `json:"first_name" validate:"required,max=100"`
+	LastName   string `json:"last_name" validate:"required,max=100"`
+	Email      string `json:"email" validate:"required,email"`
+	Phone      string `json:"phone" validate:"phone"`
+	Role       string `json:"role" validate:"required"`
 	CompanyID  string `json:"company_id"`
 	RegionID   string `json:"region_id"`
 	LocationID string `json:"location_id"`
@@ -18,15 +18,15 @@ type User struct {
 // Trainee represents the details of an individual undergoing training within the system.
 type Trainee struct {
 	ID                    string `json:"id"`
-	FirstName             string `json:"first_name"`
-	LastName              string `json:"last_name"`
+	FirstName             string `json:"first_name" validate:"required,max=100"`
+	LastName              string `json:"last_name" validate:"required,max=100"`
 	Name                  string `json:"display_name"`
-	Email                 string `json:"email"`
-	Phone                 string `json:"phone"`
+	Email                 string `json:"email" validate:"email"`
+	Phone                 string `json:"phone" validate:"phone"`
 	Company               string `json:"company"`
 	CompanyName           string `json:"display_company"`
-	VisitorType           string `json:"visitor_type"`
-	MSHA                  string `json:"msha_number"`
+	VisitorType           string `json:"visitor_type" validate:"oneof=contractor vendor guest"`
+	MSHA                  string `json:"msha_number" validate:"msha"`
 	TruckNumber           string `json:"truck_number"`
 	PreferredLanguage     string `json:"preferred_language"`
 	LastTraining          string `json:"last_training"`
@@ -44,7 +44,7 @@ type Training struct {
 	PDF            string    `json:"pdf,omitempty"`
 	DateCompleted  time.Time `json:"date_completed"`
 	ManualAddition bool      `json:"manual_addition,omitempty"`
-	TraineeID      string    `json:"trainee_id,omitempty"`
+	TraineeID      string    `json:"trainee_id,omitempty" validate:"required"`
 	LocationID     string    `json:"location_id,omitempty"`
 	RegionID       string    `json:"region_id,omitempty"`
 	CompanyID      string    `json:"company_id,omitempty"`
@@ -53,8 +53,8 @@ type Training struct {
 // Checkin represents a record of when a trainee checks in to a location.
 type Checkin struct {
 	ID         string    `json:"id"`
-	TraineeID  string    `json:"trainee_id,omitempty"`
-	LocationID string    `json:"location_id,omitempty"`
+	TraineeID  string    `json:"trainee_id,omitempty" validate:"required"`
+	LocationID string    `json:"location_id,omitempty" validate:"required"`
 	RegionID   string    `json:"region_id,omitempty"`
 	CompanyID  string    `json:"company_id,omitempty"`
 	Timestamp  time.Time `json:"timestamp"`
@@ -63,87 +63,90 @@ type Checkin struct {
 
 // Company represents the details of a company within the system.
 type Company struct {
-	ID                string `json:"id"`
-	Name              string `json:"name"`
-	Address           string `json:"address"`
-	City              string `json:"city"`
-	State             string `json:"state"`
-	Zip               string `json:"zip"`
-	StorageName       string `json:"storage_name"`
-	Email             string `json:"email"`
-	Phone             string `json:"phone"`
-	Logo              string `json:"logo"`
-	BlankPDF          string `json:"blank_pdf"`
-	Map               string `json:"map"`
-	Description       string `json:"description"`
-	PreferredLanguage string `json:"preferred_language"`
-	HasAgreement      bool   `json:"has_agreement"`
-	Agreement         string `json:"agreement,omitempty"`
-	HasVideo          bool   `json:"has_video"`
-	Video             string `json:"video,omitempty"`
+	ID                string    `json:"id"`
+	Name              string    `json:"name" validate:"required,max=200"`
+	Address           string    `json:"address"`
+	City              string    `json:"city"`
+	State             string    `json:"state"`
+	Zip               string    `json:"zip"`
+	StorageName       string    `json:"storage_name"`
+	Email             string    `json:"email" validate:"email"`
+	Phone             string    `json:"phone" validate:"phone"`
+	Logo              string    `json:"logo"`
+	BlankPDF          string    `json:"blank_pdf"`
+	Map               string    `json:"map"`
+	Description       string    `json:"description"`
+	PreferredLanguage string    `json:"preferred_language"`
+	HasAgreement      bool      `json:"has_agreement"`
+	Agreement         string    `json:"agreement,omitempty"`
+	HasVideo          bool      `json:"has_video"`
+	Video             string    `json:"video,omitempty"`
+	Updated           time.Time `json:"updated,omitempty" dynamodbav:"updated,omitempty"`
 }
 
 // Region represents a geographic or operational region associated with a company.
 type Region struct {
-	ID                string   `json:"id"`
-	Name              string   `json:"name"`
-	Email             string   `json:"email"`
-	Phone             string   `json:"phone"`
-	CompanyID         string   `json:"company_id"`
-	StorageName       string   `json:"storage_name"`
-	Address           string   `json:"address"`
-	City              string   `json:"city"`
-	State             string   `json:"state"`
-	Zip               string   `json:"zip"`
-	Map               string   `json:"map"`
-	Logo              string   `json:"logo"`
-	BlankPDF          string   `json:"blank_pdf"`
-	Description       string   `json:"description,omitempty"`
-	PreferredLanguage string   `json:"preferred_lang"`
-	HasAgreement      bool     `json:"has_agreement"`
-	Agreement         string   `json:"agreement,omitempty"`
-	HasVideo          bool     `json:"has_video"`
-	Video             string   `json:"video,omitempty"`
-	Languages         []string `json:"languages"`
+	ID                string    `json:"id"`
+	Name              string    `json:"name" validate:"required,max=200"`
+	Email             string    `json:"email" validate:"email"`
+	Phone             string    `json:"phone" validate:"phone"`
+	CompanyID         string    `json:"company_id" validate:"required"`
+	StorageName       string    `json:"storage_name"`
+	Address           string    `json:"address"`
+	City              string    `json:"city"`
+	State             string    `json:"state"`
+	Zip               string    `json:"zip"`
+	Map               string    `json:"map"`
+	Logo              string    `json:"logo"`
+	BlankPDF          string    `json:"blank_pdf"`
+	Description       string    `json:"description,omitempty"`
+	PreferredLanguage string    `json:"preferred_lang"`
+	HasAgreement      bool      `json:"has_agreement"`
+	Agreement         string    `json:"agreement,omitempty"`
+	HasVideo          bool      `json:"has_video"`
+	Video             string    `json:"video,omitempty"`
+	Languages         []string  `json:"languages"`
+	Updated           time.Time `json:"updated,omitempty" dynamodbav:"updated,omitempty"`
 }
 
 // Location represents a specific site or facility within a region.
 type Location struct {
-	ID                             string   `json:"id"`
-	CompanyID                      string   `json:"company_id"`
-	RegionID                       string   `json:"region_id"`
-	Name                           string   `json:"name"`
-	StorageName                    string   `json:"storage_name"`
-	Phone                          string   `json:"phone"`
-	Email                          string   `json:"email"`
-	Address                        string   `json:"address"`
-	State                          string   `json:"state"`
-	City                           string   `json:"city"`
-	Zip                            string   `json:"zip"`
-	CheckinTextMessages            bool     `json:"checkin_text_messages"`
-	TextNotificationsNumber        string   `json:"text_notifications_number,omitempty"`
-	Map                            string   `json:"map"`
-	Logo                           string   `json:"logo"`
-	BlankPDF                       string   `json:"blank_pdf"`
-	Description                    string   `json:"description,omitempty"`
-	PreferredLanguage              string   `json:"preferred_lang"`
-	HasAgreement                   bool     `json:"has_agreement"`
-	Agreement                      string   `json:"agreement,omitempty"`
-	ExpirationTime                 string   `json:"expiration_time"`
-	HasVideo                       bool     `json:"has_video"`
-	Video                          string   `json:"video,omitempty"`
-	Languages                      []string `json:"languages"`
-	MshaID                         string   `json:"msha_id,omitempty"`
-	DateOfTrainingPlaceholder      string   `json:"date_of_training_placeholder"`
-	TraineeNamePlaceholder         string   `json:"trainee_name_placeholder"`
-	PhonePlaceholder               string   `json:"phone_placeholder"`
-	TrainingLocationPlaceholder    string   `json:"training_location_placeholder"`
-	EmailPlaceholder               string   `json:"email_placeholder"`
-	MshaNumberPlaceholder          string   `json:"msha_number_placeholder"`
-	ScalehouseAttendantPlaceholder string   `json:"scalehouse_attendant_placeholder"`
-	TruckNumberPlaceholder         string   `json:"truck_number_placeholder"`
-	TrainingPerformedPlaceholder   string   `json:"training_performed_placeholder"`
-	CompanyPlaceholder             string   `json:"company_placeholder"`
+	ID                             string    `json:"id"`
+	CompanyID                      string    `json:"company_id" validate:"required"`
+	RegionID                       string    `json:"region_id" validate:"required"`
+	Name                           string    `json:"name" validate:"required,max=200"`
+	StorageName                    string    `json:"storage_name"`
+	Phone                          string    `json:"phone" validate:"phone"`
+	Email                          string    `json:"email" validate:"email"`
+	Address                        string    `json:"address"`
+	State                          string    `json:"state"`
+	City                           string    `json:"city"`
+	Zip                            string    `json:"zip"`
+	CheckinTextMessages            bool      `json:"checkin_text_messages"`
+	TextNotificationsNumber        string    `json:"text_notifications_number,omitempty" validate:"phone"`
+	Map                            string    `json:"map"`
+	Logo                           string    `json:"logo"`
+	BlankPDF                       string    `json:"blank_pdf"`
+	Description                    string    `json:"description,omitempty"`
+	PreferredLanguage              string    `json:"preferred_lang"`
+	HasAgreement                   bool      `json:"has_agreement"`
+	Agreement                      string    `json:"agreement,omitempty"`
+	ExpirationTime                 string    `json:"expiration_time"`
+	HasVideo                       bool      `json:"has_video"`
+	Video                          string    `json:"video,omitempty"`
+	Languages                      []string  `json:"languages"`
+	MshaID                         string    `json:"msha_id,omitempty"`
+	DateOfTrainingPlaceholder      string    `json:"date_of_training_placeholder"`
+	TraineeNamePlaceholder         string    `json:"trainee_name_placeholder"`
+	PhonePlaceholder               string    `json:"phone_placeholder"`
+	TrainingLocationPlaceholder    string    `json:"training_location_placeholder"`
+	EmailPlaceholder               string    `json:"email_placeholder"`
+	MshaNumberPlaceholder          string    `json:"msha_number_placeholder"`
+	ScalehouseAttendantPlaceholder string    `json:"scalehouse_attendant_placeholder"`
+	TruckNumberPlaceholder         string    `json:"truck_number_placeholder"`
+	TrainingPerformedPlaceholder   string    `json:"training_performed_placeholder"`
+	CompanyPlaceholder             string    `json:"company_placeholder"`
+	Updated                        time.Time `json:"updated,omitempty" dynamodbav:"updated,omitempty"`
 }
 
 // Language represents all the text strings used for UI localization and customization.
@@ -209,12 +212,12 @@ type Language struct {
 // TextMessage represents a text message template that can be sent to recipients.
 type TextMessage struct {
 	ID         string    `json:"id"`
-	Title      string    `json:"title"`
-	Text       string    `json:"text"`
+	Title      string    `json:"title" validate:"required,max=200"`
+	Text       string    `json:"text" validate:"required"`
 	Type       string    `json:"type"`
 	Created    time.Time `json:"created"`
 	Updated    time.Time `json:"updated"`
-	LocationID string    `json:"location_id"`
+	LocationID string    `json:"location_id" validate:"required"`
 }
 
 // AutomaticTextMessage represents a scheduled text message to be sent to recipients.
@@ -222,15 +225,75 @@ type AutomaticTextMessage struct {
 	ID                 string   `json:"id"`
 	RuleName           string   `json:"ruleName"`
 	ScheduleExpression string   `json:"scheduleExpression"`
-	Message            string   `json:"message"`
+	Message            string   `json:"message" validate:"required"`
 	Recipients         []string `json:"recipients"`
-	Title              string   `json:"title"`
+	Title              string   `json:"title" validate:"required,max=200"`
 	Active             bool     `json:"active"`
-	LocationID         string   `json:"location_id"`
+	LocationID         string   `json:"location_id" validate:"required"`
 	DayOfWeek          string   `json:"dayOfWeek"`
 	DayOfMonth         string   `json:"dayOfMonth"`
-	Frequency          string   `json:"frequency"`
+	Frequency          string   `json:"frequency" validate:"required,oneof=daily weekly monthly"`
 	TimeToSend         string   `json:"timeToSend"`
-	RecipientType      string   `json:"recipientType"`
+	RecipientType      string   `json:"recipientType" validate:"oneof=all checked_in custom"`
 	MessageID          string   `json:"message_id"`
 }
+
+// Device represents a kiosk device bound to a single location. Only a hash of the device token is stored.
+type Device struct {
+	ID         string    `json:"id" dynamodbav:"id"`
+	Name       string    `json:"name" dynamodbav:"name" validate:"required,max=200"`
+	LocationID string    `json:"location_id" dynamodbav:"location_id" validate:"required"`
+	RegionID   string    `json:"region_id,omitempty" dynamodbav:"region_id,omitempty"`
+	CompanyID  string    `json:"company_id,omitempty" dynamodbav:"company_id,omitempty"`
+	Scopes     []string  `json:"scopes" dynamodbav:"scopes" validate:"required"`
+	TokenHash  string    `json:"-" dynamodbav:"token_hash"`
+	Created    time.Time `json:"created" dynamodbav:"created"`
+	LastSeen   time.Time `json:"last_seen,omitempty" dynamodbav:"last_seen,omitempty"`
+	Revoked    bool      `json:"revoked" dynamodbav:"revoked"`
+	RevokedAt  time.Time `json:"revoked_at,omitempty" dynamodbav:"revoked_at,omitempty"`
+}
+
+// WebhookEndpoint is a customer URL subscribed to webhook events for a company. EventTypes may contain "*" to
+// receive every event. Only the server keeps Secret, which signs every delivery.
+type WebhookEndpoint struct {
+	ID         string    `json:"id" dynamodbav:"id"`
+	CompanyID  string    `json:"company_id" dynamodbav:"company_id" validate:"required"`
+	URL        string    `json:"url" dynamodbav:"url" validate:"required,max=2000"`
+	EventTypes []string  `json:"event_types" dynamodbav:"event_types" validate:"required"`
+	Secret     string    `json:"-" dynamodbav:"secret"`
+	Active     bool      `json:"active" dynamodbav:"active"`
+	Created    time.Time `json:"created" dynamodbav:"created"`
+	Updated    time.Time `json:"updated" dynamodbav:"updated"`
+}
+
+// WebhookDelivery is one event queued for one endpoint. Payload is the exact JSON body that is signed and sent.
+// Deliveries that fail are retried until they succeed or run out of attempts, when they are dead-lettered.
+type WebhookDelivery struct {
+	ID             string    `json:"id" dynamodbav:"id"`
+	EndpointID     string    `json:"endpoint_id" dynamodbav:"endpoint_id"`
+	CompanyID      string    `json:"company_id" dynamodbav:"company_id"`
+	EventID        string    `json:"event_id" dynamodbav:"event_id"`
+	EventType      string    `json:"event_type" dynamodbav:"event_type"`
+	Payload        string    `json:"payload" dynamodbav:"payload"`
+	Status         string    `json:"status" dynamodbav:"status" validate:"required,oneof=pending succeeded dead"`
+	Attempts       int       `json:"attempts" dynamodbav:"attempts"`
+	NextAttempt    time.Time `json:"next_attempt" dynamodbav:"next_attempt,unixtime"`
+	LastStatusCode int       `json:"last_status_code,omitempty" dynamodbav:"last_status_code,omitempty"`
+	LastError      string    `json:"last_error,omitempty" dynamodbav:"last_error,omitempty"`
+	Created        time.Time `json:"created" dynamodbav:"created"`
+	Updated        time.Time `json:"updated" dynamodbav:"updated"`
+}
+
+// WebhookAttempt is the delivery log entry for one attempt to deliver a WebhookDelivery.
+type WebhookAttempt struct {
+	ID           string    `json:"id" dynamodbav:"id"`
+	DeliveryID   string    `json:"delivery_id" dynamodbav:"delivery_id"`
+	EndpointID   string    `json:"endpoint_id" dynamodbav:"endpoint_id"`
+	EventType    string    `json:"event_type" dynamodbav:"event_type"`
+	Attempt      int       `json:"attempt" dynamodbav:"attempt"`
+	StatusCode   int       `json:"status_code,omitempty" dynamodbav:"status_code,omitempty"`
+	Error        string    `json:"error,omitempty" dynamodbav:"error,omitempty"`
+	ResponseBody string    `json:"response_body,omitempty" dynamodbav:"response_body,omitempty"`
+	DurationMS   int64     `json:"duration_ms" dynamodbav:"duration_ms"`
+	Created      time.Time `json:"created" dynamodbav:"created"`
+}
@@ -0,0 +1,333 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Validation codes reported on FieldError.Code.
+const (
+	CodeRequired = "required"
+	CodeEmail    = "email"
+	CodePhone    = "phone"
+	CodeOneOf    = "oneof"
+	CodeMSHA     = "msha"
+	CodeMax      = "max"
+	CodeFormat   = "format"
+	CodeType     = "type"
+	CodeUnknown  = "unknown"
+	CodeUnsafe   = "unsafe"
+)
+
+// Allowed values for Trainee.VisitorType.
+const (
+	VisitorTypeContractor = "contractor"
+	VisitorTypeVendor     = "vendor"
+	VisitorTypeGuest      = "guest"
+)
+
+// Allowed values for AutomaticTextMessage.Frequency.
+const (
+	FrequencyDaily   = "daily"
+	FrequencyWeekly  = "weekly"
+	FrequencyMonthly = "monthly"
+)
+
+// Allowed values for AutomaticTextMessage.RecipientType.
+const (
+	RecipientTypeAll       = "all"
+	RecipientTypeCheckedIn = "checked_in"
+	RecipientTypeCustom    = "custom"
+)
+
+// Allowed values for WebhookDelivery.Status.
+const (
+	WebhookStatusPending   = "pending"
+	WebhookStatusSucceeded = "succeeded"
+	WebhookStatusDead      = "dead"
+)
+
+var (
+	emailRegex = regexp.MustCompile(`^[^\s@]+@[^\s@]+\.[^\s@]+$`)
+	phoneRegex = regexp.MustCompile(`^\+?[\d\s().-]+$`)
+	// mshaRegex matches an MSHA training number, optionally prefixed with "MSHA" (e.g. MSHA123456 or 123456)
+	mshaRegex     = regexp.MustCompile(`(?i)^(msha)?-?\d{5,10}$`)
+	timeOfDay     = regexp.MustCompile(`^([01]\d|2[0-3]):[0-5]\d$`)
+	digitsOnlyReg = regexp.MustCompile(`\d`)
+)
+
+// Validator is implemented by any model that can check itself before being written or after being decoded.
+type Validator interface {
+	Validate() error
+}
+
+// FieldError describes a single field that failed validation. Field is the JSON name of the field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors is a list of field level validation failures. It satisfies the error interface
+// so it can be returned directly, and callers can use errors.As to get at the individual fields.
+type ValidationErrors []FieldError
+
+// Error joins all the field messages into a single string.
+func (v ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(v))
+	for _, e := range v {
+		msgs = append(msgs, e.Message)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Add appends a field error to the list.
+func (v *ValidationErrors) Add(field, code, message string) {
+	*v = append(*v, FieldError{Field: field, Code: code, Message: message})
+}
+
+// ErrOrNil returns nil when there are no errors, so a ValidationErrors can be returned as an error safely.
+func (v ValidationErrors) ErrOrNil() error {
+	if len(v) == 0 {
+		return nil
+	}
+	return v
+}
+
+// ValidateStruct checks every field of the struct s against the rules in its `validate` tag and returns
+// the failures. Rules are comma separated:
+//
+//	required       the field must not be empty (or, for slices, must have at least one element)
+//	email          the value must look like an email address
+//	phone          the value must be a phone number with 10 to 15 digits
+//	msha           the value must be an MSHA number
+//	oneof=a b c    the value must be one of the space separated options, matching case
+//	max=n          the value must be at most n characters long
+//
+// Every rule except required is skipped for empty values. For string slices the rules are applied to each element.
+func ValidateStruct(s interface{}) ValidationErrors {
+	var errs ValidationErrors
+
+	v := reflect.ValueOf(s)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return errs
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return errs
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("validate")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		name := jsonFieldName(sf)
+		fv := v.Field(i)
+
+		switch fv.Kind() {
+		case reflect.String:
+			validateString(&errs, name, fv.String(), tag)
+		case reflect.Slice:
+			if fv.Len() == 0 {
+				if hasRule(tag, CodeRequired) {
+					errs.Add(name, CodeRequired, fmt.Sprintf("%s is required", name))
+				}
+				continue
+			}
+			if fv.Type().Elem().Kind() == reflect.String {
+				for j := 0; j < fv.Len(); j++ {
+					validateString(&errs, fmt.Sprintf("%s[%d]", name, j), fv.Index(j).String(), tag)
+				}
+			}
+		default:
+			if hasRule(tag, CodeRequired) && fv.IsZero() {
+				errs.Add(name, CodeRequired, fmt.Sprintf("%s is required", name))
+			}
+		}
+	}
+
+	return errs
+}
+
+// validateString applies the rules in tag to a single string value.
+func validateString(errs *ValidationErrors, name, value, tag string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		if hasRule(tag, CodeRequired) {
+			errs.Add(name, CodeRequired, fmt.Sprintf("%s is required", name))
+		}
+		return
+	}
+
+	for _, rule := range strings.Split(tag, ",") {
+		key, arg, _ := strings.Cut(rule, "=")
+		switch key {
+		case CodeEmail:
+			if !emailRegex.MatchString(value) {
+				errs.Add(name, CodeEmail, fmt.Sprintf("%s must be a valid email address", name))
+			}
+		case CodePhone:
+			digits := len(digitsOnlyReg.FindAllString(value, -1))
+			if !phoneRegex.MatchString(value) || digits < 10 || digits > 15 {
+				errs.Add(name, CodePhone, fmt.Sprintf("%s must be a valid phone number", name))
+			}
+		case CodeMSHA:
+			if !mshaRegex.MatchString(value) {
+				errs.Add(name, CodeMSHA, fmt.Sprintf("%s must be a valid MSHA number", name))
+			}
+		case CodeOneOf:
+			options := strings.Fields(arg)
+			found := false
+			for _, o := range options {
+				if value == o {
+					found = true
+					break
+				}
+			}
+			if !found {
+				errs.Add(name, CodeOneOf, fmt.Sprintf("%s must be one of: %s", name, strings.Join(options, ", ")))
+			}
+		case CodeMax:
+			n, err := strconv.Atoi(arg)
+			if err == nil && len([]rune(value)) > n {
+				errs.Add(name, CodeMax, fmt.Sprintf("%s must be at most %d characters", name, n))
+			}
+		}
+	}
+}
+
+// hasRule reports whether the comma separated tag contains the rule named key.
+func hasRule(tag, key string) bool {
+	for _, rule := range strings.Split(tag, ",") {
+		if k, _, _ := strings.Cut(rule, "="); k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonFieldName returns the name used for the field in JSON, falling back to the Go field name.
+func jsonFieldName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return sf.Name
+	}
+	return name
+}
+
+// requireIf adds a required error for field when cond is true and value is empty.
+func requireIf(errs *ValidationErrors, cond bool, field, value, reason string) {
+	if cond && strings.TrimSpace(value) == "" {
+		errs.Add(field, CodeRequired, fmt.Sprintf("%s is required when %s", field, reason))
+	}
+}
+
+// Validate checks the user fields.
+func (u *User) Validate() error {
+	return ValidateStruct(u).ErrOrNil()
+}
+
+// Validate checks the trainee fields.
+func (t *Trainee) Validate() error {
+	return ValidateStruct(t).ErrOrNil()
+}
+
+// Validate checks the training fields.
+func (t *Training) Validate() error {
+	errs := ValidateStruct(t)
+	if !t.ManualAddition && t.DateCompleted.IsZero() {
+		errs.Add("date_completed", CodeRequired, "date_completed is required when the training was not added manually")
+	}
+	return errs.ErrOrNil()
+}
+
+// Validate checks the checkin fields.
+func (c *Checkin) Validate() error {
+	return ValidateStruct(c).ErrOrNil()
+}
+
+// Validate checks the company fields, including that a video and agreement are set when enabled.
+func (c *Company) Validate() error {
+	errs := ValidateStruct(c)
+	requireIf(&errs, c.HasVideo, "video", c.Video, "has_video is true")
+	requireIf(&errs, c.HasAgreement, "agreement", c.Agreement, "has_agreement is true")
+	return errs.ErrOrNil()
+}
+
+// Validate checks the region fields, including that a video and agreement are set when enabled.
+func (r *Region) Validate() error {
+	errs := ValidateStruct(r)
+	requireIf(&errs, r.HasVideo, "video", r.Video, "has_video is true")
+	requireIf(&errs, r.HasAgreement, "agreement", r.Agreement, "has_agreement is true")
+	return errs.ErrOrNil()
+}
+
+// Validate checks the location fields, including that a video, agreement and notification number are set when enabled.
+func (l *Location) Validate() error {
+	errs := ValidateStruct(l)
+	requireIf(&errs, l.HasVideo, "video", l.Video, "has_video is true")
+	requireIf(&errs, l.HasAgreement, "agreement", l.Agreement, "has_agreement is true")
+	requireIf(&errs, l.CheckinTextMessages, "text_notifications_number", l.TextNotificationsNumber, "checkin_text_messages is true")
+	return errs.ErrOrNil()
+}
+
+// Validate checks the language fields.
+func (l *Language) Validate() error {
+	return ValidateStruct(l).ErrOrNil()
+}
+
+// Validate checks the text message fields.
+func (m *TextMessage) Validate() error {
+	return ValidateStruct(m).ErrOrNil()
+}
+
+// Validate checks the automatic text message fields, including the schedule fields the frequency depends on.
+func (m *AutomaticTextMessage) Validate() error {
+	errs := ValidateStruct(m)
+	requireIf(&errs, m.Frequency == FrequencyWeekly, "dayOfWeek", m.DayOfWeek, "frequency is weekly")
+	requireIf(&errs, m.Frequency == FrequencyMonthly, "dayOfMonth", m.DayOfMonth, "frequency is monthly")
+	if m.RecipientType == RecipientTypeCustom && len(m.Recipients) == 0 {
+		errs.Add("recipients", CodeRequired, "recipients is required when recipientType is custom")
+	}
+	if m.TimeToSend != "" && !timeOfDay.MatchString(m.TimeToSend) {
+		errs.Add("timeToSend", CodeFormat, "timeToSend must be in HH:MM format")
+	}
+	if m.DayOfMonth != "" {
+		if d, err := strconv.Atoi(m.DayOfMonth); err != nil || d < 1 || d > 31 {
+			errs.Add("dayOfMonth", CodeFormat, "dayOfMonth must be a number between 1 and 31")
+		}
+	}
+	return errs.ErrOrNil()
+}
+
+// Validate checks the device fields.
+func (d *Device) Validate() error {
+	return ValidateStruct(d).ErrOrNil()
+}
+
+// Validate checks the webhook endpoint fields, including that the URL is an absolute https URL. Receivers tested
+// locally need https too, and a dispatcher allowing private networks.
+func (e *WebhookEndpoint) Validate() error {
+	errs := ValidateStruct(e)
+	if e.URL != "" {
+		u, err := url.Parse(e.URL)
+		if err != nil || u.Host == "" || u.Scheme != "https" {
+			errs.Add("url", CodeFormat, "url must be an https URL")
+		}
+	}
+	return errs.ErrOrNil()
+}
+
+// Validate checks the webhook delivery fields.
+func (d *WebhookDelivery) Validate() error {
+	return ValidateStruct(d).ErrOrNil()
+}
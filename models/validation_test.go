@@ -0,0 +1,60 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+// validationTests is a test table for model validation, listing the model, and the field codes expected to fail.
+var validationTests = []struct {
+	name     string
+	model    Validator
+	expected []string
+}{
+	{"valid trainee", &Trainee{FirstName: "Robert", LastName: "Martinez", Email: "robert@example.com", Phone: "555-456-7890", VisitorType: "contractor", MSHA: "MSHA123456"}, nil},
+	{"trainee missing names", &Trainee{}, []string{"first_name:required", "last_name:required"}},
+	{"trainee bad email", &Trainee{FirstName: "a", LastName: "b", Email: "not-an-email"}, []string{"email:email"}},
+	{"trainee bad phone", &Trainee{FirstName: "a", LastName: "b", Phone: "12345"}, []string{"phone:phone"}},
+	{"trainee bad visitor type", &Trainee{FirstName: "a", LastName: "b", VisitorType: "alien"}, []string{"visitor_type:oneof"}},
+	{"trainee visitor type case", &Trainee{FirstName: "a", LastName: "b", VisitorType: "Contractor"}, []string{"visitor_type:oneof"}},
+	{"trainee bad msha", &Trainee{FirstName: "a", LastName: "b", MSHA: "ABC"}, []string{"msha_number:msha"}},
+	{"training without date", &Training{TraineeID: "t"}, []string{"date_completed:required"}},
+	{"manual training without date", &Training{TraineeID: "t", ManualAddition: true}, nil},
+	{"company video without file", &Company{Name: "ABC", HasVideo: true}, []string{"video:required"}},
+	{"location notifications without number", &Location{Name: "Pit 1", CompanyID: "c", RegionID: "r", CheckinTextMessages: true}, []string{"text_notifications_number:required"}},
+	{"weekly message without day", &AutomaticTextMessage{Title: "t", Message: "m", LocationID: "l", Frequency: "weekly"}, []string{"dayOfWeek:required"}},
+	{"message bad frequency and time", &AutomaticTextMessage{Title: "t", Message: "m", LocationID: "l", Frequency: "hourly", TimeToSend: "25:00"}, []string{"frequency:oneof", "timeToSend:format"}},
+	{"webhook endpoint", &WebhookEndpoint{CompanyID: "c", URL: "https://hooks.example.com/training", EventTypes: []string{"*"}}, nil},
+	{"webhook endpoint plain http on localhost", &WebhookEndpoint{CompanyID: "c", URL: "http://localhost:8080/hooks", EventTypes: []string{"*"}}, []string{"url:format"}},
+	{"custom recipients missing", &AutomaticTextMessage{Title: "t", Message: "m", LocationID: "l", Frequency: "daily", RecipientType: "custom"}, []string{"recipients:required"}},
+}
+
+// TestValidate runs every entry of validationTests and compares the reported fields and codes.
+func TestValidate(t *testing.T) {
+	for _, e := range validationTests {
+		err := e.model.Validate()
+		if len(e.expected) == 0 {
+			if err != nil {
+				t.Errorf("%s: error recieved when none expected: %s", e.name, err.Error())
+			}
+			continue
+		}
+
+		var verrs ValidationErrors
+		if !errors.As(err, &verrs) {
+			t.Errorf("%s: expected ValidationErrors but got %v", e.name, err)
+			continue
+		}
+
+		if len(verrs) != len(e.expected) {
+			t.Errorf("%s: expected %d errors but got %d: %v", e.name, len(e.expected), len(verrs), verrs)
+			continue
+		}
+
+		for i, fe := range verrs {
+			if got := fe.Field + ":" + fe.Code; got != e.expected[i] {
+				t.Errorf("%s: expected %s but got %s", e.name, e.expected[i], got)
+			}
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/babykittenz/api-micro-util/models"
+)
+
+// ProblemContentType is the media type for RFC 7807 problem details documents.
+const ProblemContentType = "application/problem+json"
+
+// RequestIDHeader is the header used to carry the request ID. When it is set on the response, it is copied into
+// problem documents as the request_id extension member.
+const RequestIDHeader = "X-Request-ID"
+
+// ProblemDetails is an RFC 7807 problem details document. It also satisfies the error interface, so a handler
+// can return one and have ErrorJSON send it as is. Extensions are written as top level members of the document.
+type ProblemDetails struct {
+	Type       string                 `json:"type,omitempty"`
+	Title      string                 `json:"title,omitempty"`
+	Status     int                    `json:"status,omitempty"`
+	Detail     string                 `json:"detail,omitempty"`
+	Instance   string                 `json:"instance,omitempty"`
+	Extensions map[string]interface{} `json:"-"`
+}
+
+// Error returns the detail of the problem, or the title if there is no detail.
+func (p *ProblemDetails) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return p.Title
+}
+
+// MarshalJSON flattens the extension members into the problem document. Extension members never
+// override the standard members. It has a value receiver, so a ProblemDetails value keeps its extensions too.
+func (p ProblemDetails) MarshalJSON() ([]byte, error) {
+	out := make(map[string]interface{}, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		out[k] = v
+	}
+
+	type problem ProblemDetails
+	std, err := json.Marshal(problem(p))
+	if err != nil {
+		return nil, err
+	}
+	var members map[string]interface{}
+	if err := json.Unmarshal(std, &members); err != nil {
+		return nil, err
+	}
+	for k, v := range members {
+		out[k] = v
+	}
+
+	return json.Marshal(out)
+}
+
+// NewProblem builds a problem details document from an error and status code. If err is already a
+// *ProblemDetails it is used as is, with any missing standard members filled in; a non-zero status replaces
+// its status, and a zero status keeps it. Validation errors are added as the errors extension member.
+func (t *Tools) NewProblem(err error, status int) *ProblemDetails {
+	var p *ProblemDetails
+	if errors.As(err, &p) {
+		// copy, so that shared problem values are never modified
+		cp := *p
+		cp.Extensions = make(map[string]interface{}, len(p.Extensions))
+		for k, v := range p.Extensions {
+			cp.Extensions[k] = v
+		}
+		p = &cp
+	} else {
+		p = &ProblemDetails{Detail: err.Error()}
+	}
+
+	if status != 0 || p.Status == 0 {
+		p.Status = status
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	if p.Type == "" {
+		p.Type = "about:blank"
+		if t.ProblemTypeBaseURI != "" {
+			if slug, err := t.Slugify(p.Title); err == nil {
+				p.Type = t.ProblemTypeBaseURI + slug
+			}
+		}
+	}
+
+	var validationErrors models.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		if p.Extensions == nil {
+			p.Extensions = make(map[string]interface{})
+		}
+		p.Detail = "one or more fields are invalid"
+		p.Extensions["errors"] = []models.FieldError(validationErrors)
+	}
+
+	return p
+}
+
+// WriteProblem writes the problem details document p as application/problem+json, using p.Status as the
+// status code. The request ID from the response headers, if any, is added as the request_id extension member.
+func (t *Tools) WriteProblem(w http.ResponseWriter, p *ProblemDetails, headers ...http.Header) error {
+	if requestID := w.Header().Get(RequestIDHeader); requestID != "" {
+		if p.Extensions == nil {
+			p.Extensions = make(map[string]interface{})
+		}
+		if _, ok := p.Extensions["request_id"]; !ok {
+			p.Extensions["request_id"] = requestID
+		}
+	}
+
+	out, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	if len(headers) > 0 {
+		for k, v := range headers[0] {
+			w.Header()[k] = v
+		}
+	}
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(p.Status)
+	_, err = w.Write(out)
+	return err
+}
@@ -0,0 +1,104 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/babykittenz/api-micro-util/models"
+)
+
+// problemTests is a test table for problem+json responses, listing the error, status and expected members.
+var problemTests = []struct {
+	name           string
+	err            error
+	status         []int
+	expectedStatus int
+	expectedTitle  string
+	expectedType   string
+	expectErrors   bool
+}{
+	{"plain error", errors.New("some error"), []int{http.StatusServiceUnavailable}, http.StatusServiceUnavailable, "Service Unavailable", "https://example.com/problems/service-unavailable", false},
+	{"default status", errors.New("some error"), nil, http.StatusBadGateway, "Bad Gateway", "https://example.com/problems/bad-gateway", false},
+	{"validation errors", models.ValidationErrors{{Field: "email", Code: models.CodeEmail, Message: "bad"}}, nil, http.StatusUnprocessableEntity, "Unprocessable Entity", "https://example.com/problems/unprocessable-entity", true},
+	{"problem error", &ProblemDetails{Type: "https://example.com/problems/out-of-credit", Title: "Out of credit", Status: http.StatusForbidden}, nil, http.StatusForbidden, "Out of credit", "https://example.com/problems/out-of-credit", false},
+	{"problem error with status", &ProblemDetails{Type: "https://example.com/problems/out-of-credit", Title: "Out of credit", Status: http.StatusForbidden}, []int{http.StatusPaymentRequired}, http.StatusPaymentRequired, "Out of credit", "https://example.com/problems/out-of-credit", false},
+}
+
+// TestTools_ProblemJSON verifies that ErrorJSON sends RFC 7807 documents when ProblemJSON is enabled.
+func TestTools_ProblemJSON(t *testing.T) {
+	testTool := Tools{ProblemJSON: true, ProblemTypeBaseURI: "https://example.com/problems/"}
+
+	for _, e := range problemTests {
+		rr := httptest.NewRecorder()
+		rr.Header().Set(RequestIDHeader, "abc123")
+
+		err := testTool.ErrorJSON(rr, e.err, e.status...)
+		if err != nil {
+			t.Errorf("%s: %s", e.name, err.Error())
+		}
+
+		if rr.Header().Get("Content-Type") != ProblemContentType {
+			t.Errorf("%s: wrong content type %s", e.name, rr.Header().Get("Content-Type"))
+		}
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: wrong status code recieved: %d", e.name, rr.Code)
+		}
+
+		var doc map[string]interface{}
+		if err := json.NewDecoder(rr.Body).Decode(&doc); err != nil {
+			t.Errorf("%s: received error while decoding json: %s", e.name, err.Error())
+			continue
+		}
+
+		if doc["title"] != e.expectedTitle {
+			t.Errorf("%s: wrong title %v", e.name, doc["title"])
+		}
+
+		if doc["type"] != e.expectedType {
+			t.Errorf("%s: wrong type %v", e.name, doc["type"])
+		}
+
+		if int(doc["status"].(float64)) != e.expectedStatus {
+			t.Errorf("%s: wrong status member %v", e.name, doc["status"])
+		}
+
+		if doc["request_id"] != "abc123" {
+			t.Errorf("%s: request id missing from problem document", e.name)
+		}
+
+		if _, ok := doc["errors"]; ok != e.expectErrors {
+			t.Errorf("%s: errors member present: %v, expected: %v", e.name, ok, e.expectErrors)
+		}
+	}
+}
+
+// TestProblemDetails_MarshalJSON verifies that extensions are written for both problem values and pointers.
+func TestProblemDetails_MarshalJSON(t *testing.T) {
+	p := ProblemDetails{Title: "Out of credit", Status: http.StatusForbidden, Extensions: map[string]interface{}{"balance": 30, "title": "ignored"}}
+
+	for name, v := range map[string]interface{}{"value": p, "pointer": &p} {
+		out, err := json.Marshal(v)
+		if err != nil {
+			t.Errorf("%s: %s", name, err.Error())
+			continue
+		}
+
+		var doc map[string]interface{}
+		if err := json.Unmarshal(out, &doc); err != nil {
+			t.Errorf("%s: received error while decoding json: %s", name, err.Error())
+			continue
+		}
+
+		if doc["balance"] != float64(30) {
+			t.Errorf("%s: extension member missing, recieved %s", name, out)
+		}
+
+		if doc["title"] != "Out of credit" {
+			t.Errorf("%s: extension overrode title, recieved %v", name, doc["title"])
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// defaultRemoteTimeout bounds each attempt made with the default client, so a remote service that never answers
+// cannot hold a Lambda until it is killed.
+const defaultRemoteTimeout = 30 * time.Second
+
+// defaultMaxResponseSize is the largest response body read when RemoteOptions.MaxResponseSize is not set.
+const defaultMaxResponseSize = 10 << 20
+
+// defaultHTTPClient is used when no client is given.
+var defaultHTTPClient = &http.Client{Timeout: defaultRemoteTimeout}
+
+// RetryPolicy controls how requests to a remote service are retried. Network errors, 5xx responses and 429 Too Many
+// Requests are retried; other responses are returned straight away.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first. Zero or one means no retries
+	MaxAttempts int
+	// BaseDelay is the backoff before the first retry, doubled for each retry after it. Zero uses 200ms
+	BaseDelay time.Duration
+	// MaxDelay caps each backoff, including a delay asked for with Retry-After. Zero uses 10 seconds
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy makes up to three attempts with exponential backoff.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: 200 * time.Millisecond, MaxDelay: 10 * time.Second}
+
+// backoff returns a random delay of up to BaseDelay*2^retry, capped at MaxDelay (full jitter), so clients that
+// failed together do not all retry together.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	base := p.BaseDelay
+	if base <= 0 {
+		base = 200 * time.Millisecond
+	}
+
+	ceiling := p.maxDelay()
+	if retry < 32 && base<<retry > 0 && base<<retry < ceiling {
+		ceiling = base << retry
+	}
+	return rand.N(ceiling) + 1
+}
+
+// maxDelay returns MaxDelay, or its default.
+func (p RetryPolicy) maxDelay() time.Duration {
+	if p.MaxDelay <= 0 {
+		return 10 * time.Second
+	}
+	return p.MaxDelay
+}
+
+// RemoteOptions configures a request made with PushJSON or a Client.
+type RemoteOptions struct {
+	// Client sends the request. It defaults to a client with a 30 second timeout
+	Client *http.Client
+	// Retry is the retry policy. The zero value makes a single attempt
+	Retry RetryPolicy
+	// IdempotencyKey is sent as the Idempotency-Key header, so the remote service can tell a retry from a new
+	// request. If it is empty and Retry allows more than one attempt, a random key is generated
+	IdempotencyKey string
+	// Headers are added to the request, e.g. Authorization
+	Headers http.Header
+	// MaxResponseSize is the largest response body read. Zero uses 10 MB
+	MaxResponseSize int64
+}
+
+// RemoteResponse is the response from a remote service, with its body already read.
+type RemoteResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// Attempts is the number of requests made
+	Attempts int
+}
+
+// RemoteError is returned when a remote service responds with a status of 400 or above.
+type RemoteError struct {
+	StatusCode int
+	Body       []byte
+}
+
+// Error describes the status the remote service responded with.
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("remote service responded with %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// PushJSON posts data as JSON to uri, retrying according to opts, and decodes a successful JSON response into out,
+// which may be nil. The response is returned with its body read, even when the remote service responds with an
+// error status, in which case the error is a *RemoteError.
+func (t *Tools) PushJSON(ctx context.Context, uri string, data, out interface{}, opts ...RemoteOptions) (*RemoteResponse, error) {
+	var o RemoteOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	res, err := t.sendJSON(ctx, http.MethodPost, uri, data, o)
+	if err != nil {
+		return res, err
+	}
+	if out != nil && len(bytes.TrimSpace(res.Body)) > 0 {
+		if err := json.Unmarshal(res.Body, out); err != nil {
+			return res, fmt.Errorf("failed to decode response from %s: %w", uri, err)
+		}
+	}
+	return res, nil
+}
+
+// sendJSON sends data, if not nil, as JSON to uri, retrying network errors, 5xx and 429 responses as opts.Retry
+// allows, and returns the last response. Errors encoding data or building the request are returned straight away,
+// since another attempt would fail the same way.
+func (t *Tools) sendJSON(ctx context.Context, method, uri string, data interface{}, opts RemoteOptions) (*RemoteResponse, error) {
+	var body []byte
+	if data != nil {
+		var err error
+		if body, err = json.Marshal(data); err != nil {
+			return nil, fmt.Errorf("failed to encode request to %s: %w", uri, err)
+		}
+	}
+
+	client := opts.Client
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	maxAttempts := opts.Retry.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	idempotencyKey := opts.IdempotencyKey
+	if idempotencyKey == "" && maxAttempts > 1 && method != http.MethodGet {
+		idempotencyKey = t.RandomString(32)
+	}
+
+	request, err := newJSONRequest(ctx, method, uri, body, idempotencyKey, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request to %s: %w", uri, err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		res, err := attemptJSON(client, request, uri, body, opts)
+		if res != nil {
+			res.Attempts = attempt
+		}
+
+		retryable := err != nil && ctx.Err() == nil && !errors.Is(err, errResponseTooLarge)
+		if res != nil && (res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500) {
+			retryable = true
+		}
+		if !retryable || attempt >= maxAttempts {
+			if err == nil && res.StatusCode >= 400 {
+				err = &RemoteError{StatusCode: res.StatusCode, Body: res.Body}
+			}
+			return res, err
+		}
+
+		delay := opts.Retry.backoff(attempt - 1)
+		if res != nil {
+			if after, ok := retryAfter(res.Header, time.Now()); ok {
+				delay = min(after, opts.Retry.maxDelay())
+			}
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return res, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// errResponseTooLarge is returned when a response body is larger than RemoteOptions.MaxResponseSize.
+var errResponseTooLarge = errors.New("response is too large")
+
+// newJSONRequest builds the request each attempt sends a copy of.
+func newJSONRequest(ctx context.Context, method, uri string, body []byte, idempotencyKey string, opts RemoteOptions) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, uri, reader)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range opts.Headers {
+		request.Header[k] = v
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	request.Header.Set("Accept", "application/json")
+	if idempotencyKey != "" {
+		request.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+	return request, nil
+}
+
+// attemptJSON sends a copy of request, with a fresh reader over body, and reads the response body.
+func attemptJSON(client *http.Client, request *http.Request, uri string, body []byte, opts RemoteOptions) (*RemoteResponse, error) {
+	request = request.Clone(request.Context())
+	if body != nil {
+		request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	maxSize := opts.MaxResponseSize
+	if maxSize == 0 {
+		maxSize = defaultMaxResponseSize
+	}
+	b, err := io.ReadAll(io.LimitReader(response.Body, maxSize+1))
+	res := &RemoteResponse{StatusCode: response.StatusCode, Header: response.Header, Body: b}
+	if err != nil {
+		return res, fmt.Errorf("failed to read response from %s: %w", uri, err)
+	}
+	if int64(len(b)) > maxSize {
+		res.Body = b[:maxSize]
+		return res, fmt.Errorf("failed to read response from %s: %w", uri, errResponseTooLarge)
+	}
+	return res, nil
+}
+
+// retryAfter reads a Retry-After header given in seconds or as an HTTP date.
+func retryAfter(h http.Header, now time.Time) (time.Duration, bool) {
+	value := h.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
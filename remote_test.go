@@ -0,0 +1,145 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTools_PushJSON(t *testing.T) {
+	var mu sync.Mutex
+	var keys []string
+	failures := 2
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+
+		var payload map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload["phone"] != "5554567890" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error": true, "message": "bad payload"}`))
+			return
+		}
+		if failures > 0 {
+			failures--
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id": "msg-1"}`))
+	}))
+	defer srv.Close()
+
+	var testTools Tools
+	var out struct {
+		ID string `json:"id"`
+	}
+	res, err := testTools.PushJSON(context.Background(), srv.URL, map[string]string{"phone": "5554567890"}, &out, RemoteOptions{
+		Retry: RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusCreated || res.Attempts != 3 || out.ID != "msg-1" {
+		t.Errorf("expected the decoded response after 3 attempts, recieved %d after %d: %+v", res.StatusCode, res.Attempts, out)
+	}
+	if len(keys) != 3 || keys[0] == "" || keys[0] != keys[1] || keys[1] != keys[2] {
+		t.Errorf("expected every attempt to send the same idempotency key, recieved %v", keys)
+	}
+
+	// client errors are not retried, and the body is still returned
+	res, err = testTools.PushJSON(context.Background(), srv.URL, map[string]string{}, &out, RemoteOptions{
+		Retry: RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+	})
+	var remoteErr *RemoteError
+	if !errors.As(err, &remoteErr) || remoteErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected a RemoteError for a 400, recieved %v", err)
+	}
+	if res == nil || res.Attempts != 1 || string(res.Body) != `{"error": true, "message": "bad payload"}` {
+		t.Errorf("expected a single attempt with the error body, recieved %+v", res)
+	}
+}
+
+func TestTools_PushJSONCancelled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	var testTools Tools
+	start := time.Now()
+	res, err := testTools.PushJSON(ctx, srv.URL, nil, nil, RemoteOptions{Retry: RetryPolicy{MaxAttempts: 5, MaxDelay: time.Minute}})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline to stop the retries, recieved %v", err)
+	}
+	if res == nil || res.StatusCode != http.StatusTooManyRequests || time.Since(start) > 5*time.Second {
+		t.Errorf("expected the last response to be returned promptly, recieved %+v", res)
+	}
+}
+
+func TestTools_PushJSONInvalidRequest(t *testing.T) {
+	var testTools Tools
+	retry := RemoteOptions{Retry: RetryPolicy{MaxAttempts: 5, BaseDelay: time.Minute}}
+
+	start := time.Now()
+	res, err := testTools.PushJSON(context.Background(), "://no-scheme", nil, nil, retry)
+	if err == nil || res != nil {
+		t.Errorf("expected an invalid URL to fail without a response, recieved %+v, %v", res, err)
+	}
+	_, err = testTools.PushJSON(context.Background(), "http://example.com", make(chan int), nil, retry)
+	if err == nil {
+		t.Error("expected data that cannot be encoded to fail")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("expected requests that cannot be built to fail without retrying")
+	}
+}
+
+var retryAfterTests = []struct {
+	name     string
+	value    string
+	expected time.Duration
+	ok       bool
+}{
+	{name: "seconds", value: "120", expected: 2 * time.Minute, ok: true},
+	{name: "http date", value: "Wed, 01 Jan 2025 12:00:30 GMT", expected: 30 * time.Second, ok: true},
+	{name: "date in the past", value: "Wed, 01 Jan 2025 11:00:00 GMT", expected: 0, ok: true},
+	{name: "missing", value: "", ok: false},
+	{name: "invalid", value: "soon", ok: false},
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, e := range retryAfterTests {
+		h := http.Header{}
+		if e.value != "" {
+			h.Set("Retry-After", e.value)
+		}
+		got, ok := retryAfter(h, now)
+		if got != e.expected || ok != e.ok {
+			t.Errorf("%s: expected %s %v, recieved %s %v", e.name, e.expected, e.ok, got, ok)
+		}
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for retry := 0; retry < 40; retry++ {
+		ceiling := min(policy.BaseDelay<<min(retry, 10), policy.MaxDelay)
+		if d := policy.backoff(retry); d <= 0 || d > ceiling {
+			t.Errorf("retry %d: expected a delay up to %s, recieved %s", retry, ceiling, d)
+		}
+	}
+}
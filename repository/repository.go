@@ -1,6 +1,16 @@
 package repository
 
-import "github.com/babykittenz/api-micro-util/models"
+import (
+	"time"
+
+	"github.com/babykittenz/api-micro-util/models"
+)
+
+// LastModifier is implemented by repositories that can report when any of their records last changed.
+// It is used to answer conditional requests (If-Modified-Since) for list endpoints.
+type LastModifier interface {
+	LastModified() (time.Time, error)
+}
 
 // TraineeRepository provides methods to perform CRUD operations and specific queries on Trainee data.
 type TraineeRepository interface {
@@ -58,6 +68,7 @@ type CompanyRepository interface {
 	Save(company *models.Company) error
 	Update(company *models.Company) error
 	Delete(id string) error
+	LastModifier
 }
 
 // RegionRepository defines the interface for managing operations related to regions in the repository.
@@ -69,6 +80,7 @@ type RegionRepository interface {
 	Save(region *models.Region) error
 	Update(region *models.Region) error
 	Delete(id string) error
+	LastModifier
 }
 
 // LocationRepository defines the interface for managing and executing operations on Location entities.
@@ -81,6 +93,7 @@ type LocationRepository interface {
 	Save(location *models.Location) error
 	Update(location *models.Location) error
 	Delete(id string) error
+	LastModifier
 }
 
 // LanguageRepository defines methods to manage Language resources in storage.
@@ -111,3 +124,36 @@ type AutomaticTextMessageRepository interface {
 	Update(automaticTextMessage *models.AutomaticTextMessage) error
 	Delete(id string) error
 }
+
+// DeviceRepository defines the interface for managing kiosk devices and their credentials.
+type DeviceRepository interface {
+	FindByID(id string) (*models.Device, error)
+	FindAllByLocationID(id string) ([]*models.Device, error)
+	Save(device *models.Device) error
+	Update(device *models.Device) error
+	Delete(id string) error
+	Touch(id string, lastSeen time.Time) error
+}
+
+// WebhookEndpointRepository defines the interface for managing the endpoints companies subscribe to webhook events.
+type WebhookEndpointRepository interface {
+	FindByID(id string) (*models.WebhookEndpoint, error)
+	FindAllByCompanyID(id string) ([]*models.WebhookEndpoint, error)
+	Save(endpoint *models.WebhookEndpoint) error
+	Update(endpoint *models.WebhookEndpoint) error
+	Delete(id string) error
+}
+
+// WebhookDeliveryRepository is the durable queue of webhook deliveries, and the log of every attempt to deliver them.
+// FindDue returns pending deliveries whose next attempt is due. Claim leases a due delivery to one worker by moving
+// its next attempt to until, only if no other worker has moved it since it was read, and reports whether it did.
+type WebhookDeliveryRepository interface {
+	FindByID(id string) (*models.WebhookDelivery, error)
+	FindDue(now time.Time, limit int) ([]*models.WebhookDelivery, error)
+	FindAllByEndpointID(id string, status string) ([]*models.WebhookDelivery, error)
+	Save(delivery *models.WebhookDelivery) error
+	Update(delivery *models.WebhookDelivery) error
+	Claim(delivery *models.WebhookDelivery, until time.Time) (bool, error)
+	SaveAttempt(attempt *models.WebhookAttempt) error
+	FindAttemptsByEndpointID(id string, limit int) ([]*models.WebhookAttempt, error)
+}
@@ -0,0 +1,129 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// defaultChunkSize is the size of the chunks streamed to clamd when ClamdScanner.ChunkSize is not set.
+const defaultChunkSize = 64 * 1024
+
+// ClamdScanner scans files with a ClamAV daemon, streaming them over the clamd INSTREAM protocol so the daemon
+// does not need access to the files.
+type ClamdScanner struct {
+	// Network is "tcp" or "unix"
+	Network string
+	// Address is the clamd address, such as "127.0.0.1:3310" or "/var/run/clamav/clamd.ctl"
+	Address string
+	// Timeout bounds each scan, including the connection. Zero uses one minute
+	Timeout time.Duration
+	// ChunkSize is the size of each chunk sent to clamd. It must be below clamd's StreamMaxLength. Zero uses 64 KB
+	ChunkSize int
+}
+
+// NewClamdScanner returns a ClamdScanner for the daemon listening on network and address.
+func NewClamdScanner(network, address string) *ClamdScanner {
+	return &ClamdScanner{Network: network, Address: address}
+}
+
+// Scan streams r to clamd and returns its verdict.
+func (c *ClamdScanner) Scan(ctx context.Context, name string, r io.Reader) (Result, error) {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = time.Minute
+	}
+	chunkSize := c.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = defaultChunkSize
+	}
+
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, c.Network, c.Address)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+
+	// the z prefix means commands and replies are terminated by a NUL byte
+	if _, err := io.WriteString(conn, "zINSTREAM\x00"); err != nil {
+		return Result{}, fmt.Errorf("failed to send clamd command: %w", err)
+	}
+
+	// each chunk is prefixed with its length as a 4 byte big endian integer, and a zero length ends the stream
+	buf := make([]byte, 4+chunkSize)
+	for {
+		n, readErr := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				return Result{}, fmt.Errorf("failed to stream %s to clamd: %w", name, err)
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return Result{}, readErr
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return Result{}, fmt.Errorf("failed to stream %s to clamd: %w", name, err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return Result{}, fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	return parseClamdReply(reply)
+}
+
+// Ping checks that clamd is reachable and responding.
+func (c *ClamdScanner) Ping(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: 5 * time.Second}
+	conn, err := dialer.DialContext(ctx, c.Network, c.Address)
+	if err != nil {
+		return fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := io.WriteString(conn, "zPING\x00"); err != nil {
+		return err
+	}
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return err
+	}
+	if strings.TrimRight(reply, "\x00") != "PONG" {
+		return fmt.Errorf("unexpected clamd reply %q", reply)
+	}
+	return nil
+}
+
+// parseClamdReply turns a reply such as "stream: OK" or "stream: Eicar-Signature FOUND" into a Result.
+func parseClamdReply(reply string) (Result, error) {
+	reply = string(bytes.TrimRight([]byte(reply), "\x00\n"))
+	_, verdict, _ := strings.Cut(reply, ": ")
+
+	switch {
+	case verdict == "OK":
+		return Result{Clean: true}, nil
+	case strings.HasSuffix(verdict, " FOUND"):
+		return Result{Threat: strings.TrimSuffix(verdict, " FOUND")}, nil
+	default:
+		return Result{}, fmt.Errorf("clamd error: %s", reply)
+	}
+}
@@ -0,0 +1,125 @@
+package scan
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// defaultMaxPDFSize is the largest PDF read by PDFScanner when MaxSize is not set.
+const defaultMaxPDFSize = 64 << 20
+
+// unsafePDFNames are the PDF name objects that run code or other programs when a document is opened or used.
+var unsafePDFNames = []struct {
+	name, threat string
+}{
+	{"/JavaScript", "PDF JavaScript"},
+	{"/JS", "PDF JavaScript"},
+	{"/Launch", "PDF Launch action"},
+}
+
+var (
+	// pdfStream matches the data of a stream object
+	pdfStream = regexp.MustCompile(`(?s)stream\r?\n(.*?)\r?\nendstream`)
+	// pdfNameEscape matches a #xx hex escape inside a name, used to hide names such as /J#61vaScript
+	pdfNameEscape = regexp.MustCompile(`#[0-9A-Fa-f]{2}`)
+)
+
+// PDFScanner rejects PDF documents that embed JavaScript or launch actions. Files that are not PDFs are
+// reported as clean. Names hidden with hex escapes and names inside Flate compressed object streams are
+// also found.
+type PDFScanner struct {
+	// MaxSize is the largest document read, and the most data inflated from its streams. Zero uses 64 MB
+	MaxSize int64
+}
+
+// Scan reads a document and looks for unsafe actions.
+func (p *PDFScanner) Scan(ctx context.Context, name string, r io.Reader) (Result, error) {
+	maxSize := p.MaxSize
+	if maxSize == 0 {
+		maxSize = defaultMaxPDFSize
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return Result{}, err
+	}
+	// the header may follow a little junk, which readers accept
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	if !bytes.Contains(head, []byte("%PDF-")) {
+		return Result{Clean: true}, nil
+	}
+	if int64(len(data)) > maxSize {
+		return Result{}, fmt.Errorf("%s is too large to scan", name)
+	}
+
+	if threat := findUnsafePDFName(data); threat != "" {
+		return Result{Threat: threat}, nil
+	}
+
+	// look inside compressed streams, where object streams can hide whole dictionaries
+	budget := maxSize
+	for _, m := range pdfStream.FindAllSubmatch(data, -1) {
+		if err := ctx.Err(); err != nil {
+			return Result{}, err
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(m[1]))
+		if err != nil {
+			continue
+		}
+		inflated, _ := io.ReadAll(io.LimitReader(zr, budget))
+		_ = zr.Close()
+		budget -= int64(len(inflated))
+
+		if threat := findUnsafePDFName(inflated); threat != "" {
+			return Result{Threat: threat}, nil
+		}
+		if budget <= 0 {
+			break
+		}
+	}
+
+	return Result{Clean: true}, nil
+}
+
+// findUnsafePDFName returns the threat for the first unsafe name in data, after undoing hex escapes.
+func findUnsafePDFName(data []byte) string {
+	if bytes.IndexByte(data, '#') >= 0 {
+		data = pdfNameEscape.ReplaceAllFunc(data, func(b []byte) []byte {
+			v, _ := strconv.ParseUint(string(b[1:]), 16, 8)
+			return []byte{byte(v)}
+		})
+	}
+
+	for _, unsafe := range unsafePDFNames {
+		for i := 0; ; {
+			j := bytes.Index(data[i:], []byte(unsafe.name))
+			if j < 0 {
+				break
+			}
+			end := i + j + len(unsafe.name)
+			// a name ends at whitespace or a delimiter, so /JSON or /Launcher are not matches
+			if end == len(data) || isPDFDelimiter(data[end]) {
+				return unsafe.threat
+			}
+			i = end
+		}
+	}
+	return ""
+}
+
+// isPDFDelimiter reports whether c ends a PDF name.
+func isPDFDelimiter(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '\f', 0, '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+// Package scan checks uploaded files for malware and unsafe content before they are kept. UploadFiles runs the
+// scanners set in Tools.Scanners over every staged file, and rolls the upload back if any of them finds a threat.
+package scan
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// Result is the outcome of scanning a file.
+type Result struct {
+	// Clean is false if the scanner found a threat
+	Clean bool
+	// Threat names what was found, such as a virus signature or "PDF JavaScript"
+	Threat string
+}
+
+// Scanner inspects the content of a file. An error means the file could not be scanned, not that it is unsafe;
+// callers should treat it as a failure rather than letting the file through.
+type Scanner interface {
+	Scan(ctx context.Context, name string, r io.Reader) (Result, error)
+}
+
+// ScannerFunc adapts a function to a Scanner.
+type ScannerFunc func(ctx context.Context, name string, r io.Reader) (Result, error)
+
+// Scan calls f.
+func (f ScannerFunc) Scan(ctx context.Context, name string, r io.Reader) (Result, error) {
+	return f(ctx, name, r)
+}
+
+// All runs every scanner over a single read of r, copying what is read to each of them through a pipe, so a file
+// in remote storage is downloaded once however many scanners there are. Scanners run concurrently and a scanner
+// that returns before reading everything does not hold up the others. The first error, or else the first
+// threat, in the order of scanners is returned.
+func All(ctx context.Context, name string, r io.Reader, scanners ...Scanner) (Result, error) {
+	results := make([]Result, len(scanners))
+	errs := make([]error, len(scanners))
+	writers := make([]io.Writer, len(scanners))
+	pipes := make([]*io.PipeWriter, len(scanners))
+
+	var wg sync.WaitGroup
+	for i, scanner := range scanners {
+		pr, pw := io.Pipe()
+		writers[i], pipes[i] = pw, pw
+
+		wg.Add(1)
+		go func(i int, scanner Scanner) {
+			defer wg.Done()
+			results[i], errs[i] = scanner.Scan(ctx, name, pr)
+			// keep reading what is left so the copy to the other scanners is not blocked
+			_, _ = io.Copy(io.Discard, pr)
+		}(i, scanner)
+	}
+
+	_, err := io.Copy(io.MultiWriter(writers...), r)
+	for _, pw := range pipes {
+		_ = pw.CloseWithError(err)
+	}
+	wg.Wait()
+	if err != nil {
+		return Result{}, err
+	}
+
+	for i := range scanners {
+		if errs[i] != nil {
+			return Result{}, errs[i]
+		}
+	}
+	for _, result := range results {
+		if !result.Clean {
+			return result, nil
+		}
+	}
+	return Result{Clean: true}, nil
+}
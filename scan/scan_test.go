@@ -0,0 +1,170 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// eicar is the standard anti-virus test file.
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// startClamdStub listens on a unix socket and answers INSTREAM commands like clamd, reporting the EICAR test
+// file as infected.
+func startClamdStub(t *testing.T) string {
+	address := filepath.Join(t.TempDir(), "clamd.sock")
+	l, err := net.Listen("unix", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				command, _ := r.ReadString(0)
+				if command == "zPING\x00" {
+					_, _ = io.WriteString(conn, "PONG\x00")
+					return
+				}
+
+				var data bytes.Buffer
+				for {
+					var size uint32
+					if err := binary.Read(r, binary.BigEndian, &size); err != nil || size == 0 {
+						break
+					}
+					_, _ = io.CopyN(&data, r, int64(size))
+				}
+				if strings.Contains(data.String(), "EICAR-STANDARD-ANTIVIRUS-TEST-FILE") {
+					_, _ = io.WriteString(conn, "stream: Eicar-Signature FOUND\x00")
+					return
+				}
+				_, _ = io.WriteString(conn, "stream: OK\x00")
+			}(conn)
+		}
+	}()
+	return address
+}
+
+func TestClamdScanner(t *testing.T) {
+	scanner := NewClamdScanner("unix", startClamdStub(t))
+	scanner.ChunkSize = 16
+	ctx := context.Background()
+
+	if err := scanner.Ping(ctx); err != nil {
+		t.Fatalf("expected ping to succeed: %s", err)
+	}
+
+	result, err := scanner.Scan(ctx, "signature.png", strings.NewReader("a perfectly normal signature"))
+	if err != nil || !result.Clean {
+		t.Errorf("expected a clean result, recieved %+v %v", result, err)
+	}
+
+	// the signature spans several chunks
+	result, err = scanner.Scan(ctx, "eicar.com", strings.NewReader(eicar))
+	if err != nil || result.Clean || result.Threat != "Eicar-Signature" {
+		t.Errorf("expected the EICAR file to be found, recieved %+v %v", result, err)
+	}
+
+	if _, err := NewClamdScanner("unix", filepath.Join(t.TempDir(), "missing.sock")).Scan(ctx, "x", strings.NewReader("x")); err == nil {
+		t.Error("expected an error when clamd is unreachable")
+	}
+}
+
+// deflate returns data compressed as a PDF FlateDecode stream.
+func deflate(data string) string {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	_, _ = io.WriteString(w, data)
+	_ = w.Close()
+	return buf.String()
+}
+
+var pdfTests = []struct {
+	name     string
+	document string
+	threat   string
+}{
+	{name: "clean", document: "%PDF-1.7\n1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n%%EOF"},
+	{name: "not a pdf", document: "/JavaScript is fine in a text file"},
+	{name: "open action javascript", document: "%PDF-1.7\n1 0 obj << /OpenAction << /S /JavaScript /JS (app.alert(1)) >> >> endobj", threat: "PDF JavaScript"},
+	{name: "launch action", document: "%PDF-1.4\n1 0 obj << /AA << /O << /S /Launch /F (cmd.exe) >> >> >> endobj", threat: "PDF Launch action"},
+	{name: "hex escaped name", document: "%PDF-1.4\n1 0 obj << /S /J#61va#53cript >> endobj", threat: "PDF JavaScript"},
+	{name: "similar names", document: "%PDF-1.4\n1 0 obj << /JSON 1 /Launcher 2 >> endobj"},
+	{name: "compressed object stream", document: "%PDF-1.5\n5 0 obj << /Type /ObjStm /Filter /FlateDecode >>\nstream\n" + deflate("<< /S /JS /JS (this.exportDataObject()) >>") + "\nendstream\nendobj", threat: "PDF JavaScript"},
+}
+
+func TestPDFScanner(t *testing.T) {
+	var scanner PDFScanner
+	for _, e := range pdfTests {
+		result, err := scanner.Scan(context.Background(), e.name+".pdf", strings.NewReader(e.document))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", e.name, err)
+			continue
+		}
+		if result.Threat != e.threat || result.Clean != (e.threat == "") {
+			t.Errorf("%s: expected threat %q, recieved %+v", e.name, e.threat, result)
+		}
+	}
+}
+
+// readCounter counts how many bytes are read from a source.
+type readCounter struct {
+	r io.Reader
+	n int
+}
+
+func (c *readCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+// allTests is a test table for running several scanners over one read.
+var allTests = []struct {
+	name     string
+	document string
+	threat   string
+}{
+	{name: "clean", document: strings.Repeat("clean text ", 100000)},
+	{name: "virus", document: strings.Repeat("x", 100000) + eicar, threat: "Eicar-Signature"},
+	{name: "javascript", document: "%PDF-1.7\n1 0 obj << /S /JavaScript /JS (app.alert(1)) >> endobj\n%%EOF", threat: "PDF JavaScript"},
+}
+
+func TestAll(t *testing.T) {
+	address := startClamdStub(t)
+	// a scanner that stops reading after the first bytes must not block the others
+	early := ScannerFunc(func(ctx context.Context, name string, r io.Reader) (Result, error) {
+		_, err := io.ReadFull(r, make([]byte, 8))
+		return Result{Clean: true}, err
+	})
+
+	for _, e := range allTests {
+		source := &readCounter{r: strings.NewReader(e.document)}
+		result, err := All(context.Background(), e.name, source, early, &PDFScanner{}, NewClamdScanner("unix", address))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", e.name, err)
+			continue
+		}
+		if result.Threat != e.threat || result.Clean != (e.threat == "") {
+			t.Errorf("%s: expected threat %q, recieved %+v", e.name, e.threat, result)
+		}
+		if source.n != len(e.document) {
+			t.Errorf("%s: expected the file to be read once, recieved %d of %d bytes", e.name, source.n, len(e.document))
+		}
+	}
+}
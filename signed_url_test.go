@@ -0,0 +1,55 @@
+package toolkit
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestURLSigner(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	old := NewURLSigner([]byte("old secret"))
+	signer := NewURLSigner([]byte("new secret"), []byte("old secret"))
+
+	signed, err := signer.Sign("https://api.example.com/files/certificates/jane doe.pdf?company=acme", now.Add(time.Hour), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, _ := old.Sign("/files/agreements/acme.pdf", now.Add(time.Hour), false)
+
+	tamper := func(s, old, new string) string {
+		return strings.Replace(s, old, new, 1)
+	}
+
+	var signedURLTests = []struct {
+		name          string
+		url           string
+		now           time.Time
+		expectedErr   error
+		expectedNonce bool
+	}{
+		{name: "valid", url: signed, now: now, expectedNonce: true},
+		{name: "signed with a previous secret", url: rotated, now: now},
+		{name: "expired", url: signed, now: now.Add(time.Hour), expectedErr: ErrURLExpired},
+		{name: "path changed", url: tamper(signed, "jane", "john"), now: now, expectedErr: ErrURLSignature},
+		{name: "query changed", url: tamper(signed, "company=acme", "company=other"), now: now, expectedErr: ErrURLSignature},
+		{name: "expiry extended", url: tamper(signed, "expires=1", "expires=2"), now: now, expectedErr: ErrURLSignature},
+		{name: "nonce removed", url: tamper(signed, "nonce=", "n="), now: now, expectedErr: ErrURLSignature},
+		{name: "unsigned", url: "/files/certificates/jane.pdf", now: now, expectedErr: ErrURLSignature},
+	}
+
+	for _, e := range signedURLTests {
+		u, _ := url.Parse(e.url)
+		nonce, expires, err := signer.Verify(u, e.now)
+		if err != e.expectedErr {
+			t.Errorf("%s: expected error %v, recieved %v", e.name, e.expectedErr, err)
+		}
+		if err == nil && (nonce != "") != e.expectedNonce {
+			t.Errorf("%s: expected nonce %v, recieved %q", e.name, e.expectedNonce, nonce)
+		}
+		if err == nil && !expires.Equal(now.Add(time.Hour)) {
+			t.Errorf("%s: expected the expiry, recieved %s", e.name, expires)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LocalStore is a FileStore that keeps objects as files below a root directory.
+type LocalStore struct {
+	root string
+}
+
+// NewLocalStore returns a LocalStore rooted at dir. Keys cannot escape dir. An empty dir keeps paths as given,
+// relative to the working directory or absolute, which is how Tools behaves when no FileStore is configured.
+func NewLocalStore(dir string) *LocalStore {
+	return &LocalStore{root: dir}
+}
+
+// filename returns the file path for key.
+func (s *LocalStore) filename(key string) string {
+	if s.root == "" {
+		return filepath.FromSlash(key)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(CleanKey(key)))
+}
+
+// Put writes r to the file for key, creating any missing directories.
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, contentType string) (ObjectInfo, error) {
+	name := s.filename(key)
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return ObjectInfo{}, err
+	}
+
+	f, err := os.Create(name)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(name)
+		return ObjectInfo{}, err
+	}
+
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info.ContentType = contentTypeFor(key, contentType)
+	return info, nil
+}
+
+// Get opens the file for key. The returned reader is an *os.File, so it can be seeked.
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	f, err := os.Open(s.filename(key))
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	return f, info, nil
+}
+
+// Delete removes the file for key.
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	err := os.Remove(s.filename(key))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Move renames the file for from to the file for to, creating any missing directories.
+func (s *LocalStore) Move(ctx context.Context, from, to string) error {
+	name := s.filename(to)
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	err := os.Rename(s.filename(from), name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Stat returns the details of the file for key.
+func (s *LocalStore) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	fi, err := os.Stat(s.filename(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return ObjectInfo{}, ErrNotFound
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if fi.IsDir() {
+		return ObjectInfo{}, fmt.Errorf("%s is a directory: %w", key, ErrNotFound)
+	}
+	return ObjectInfo{
+		Key:         key,
+		Size:        fi.Size(),
+		ContentType: contentTypeFor(key, ""),
+		ModTime:     fi.ModTime(),
+	}, nil
+}
+
+// List walks the directory holding prefix and returns the files whose key starts with prefix.
+func (s *LocalStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	dir := prefix
+	if !strings.HasSuffix(dir, "/") {
+		dir = dir[:strings.LastIndex(dir, "/")+1]
+	}
+
+	start := s.filename(dir)
+	if start == "" {
+		start = "."
+	}
+	var infos []ObjectInfo
+	err := filepath.WalkDir(start, func(name string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && name == start {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(start, name)
+		if err != nil {
+			return err
+		}
+		key := dir + filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		infos = append(infos, ObjectInfo{
+			Key:         key,
+			Size:        fi.Size(),
+			ContentType: contentTypeFor(key, ""),
+			ModTime:     fi.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+	return infos, nil
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a FileStore that keeps objects in memory. It is intended for tests.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+}
+
+// memoryObject is an object held by a MemoryStore.
+type memoryObject struct {
+	data []byte
+	info ObjectInfo
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{objects: make(map[string]memoryObject)}
+}
+
+// Put reads r into memory and stores it under key.
+func (s *MemoryStore) Put(ctx context.Context, key string, r io.Reader, contentType string) (ObjectInfo, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	key = CleanKey(key)
+	sum := md5.Sum(data)
+	info := ObjectInfo{
+		Key:         key,
+		Size:        int64(len(data)),
+		ContentType: contentTypeFor(key, contentType),
+		ModTime:     time.Now().UTC(),
+		ETag:        `"` + hex.EncodeToString(sum[:]) + `"`,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = memoryObject{data: data, info: info}
+	return info, nil
+}
+
+// Get returns a seekable reader over the object stored under key.
+func (s *MemoryStore) Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	obj, ok := s.objects[CleanKey(key)]
+	if !ok {
+		return nil, ObjectInfo{}, ErrNotFound
+	}
+	return readSeekNopCloser{bytes.NewReader(obj.data)}, obj.info, nil
+}
+
+// Delete removes the object stored under key.
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, CleanKey(key))
+	return nil
+}
+
+// Move stores the object under from as to, and removes from.
+func (s *MemoryStore) Move(ctx context.Context, from, to string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	from, to = CleanKey(from), CleanKey(to)
+	obj, ok := s.objects[from]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(s.objects, from)
+	obj.info.Key = to
+	s.objects[to] = obj
+	return nil
+}
+
+// Stat returns the details of the object stored under key.
+func (s *MemoryStore) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	obj, ok := s.objects[CleanKey(key)]
+	if !ok {
+		return ObjectInfo{}, ErrNotFound
+	}
+	return obj.info, nil
+}
+
+// List returns the details of every object whose key starts with prefix.
+func (s *MemoryStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var infos []ObjectInfo
+	for key, obj := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			infos = append(infos, obj.info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+	return infos, nil
+}
+
+// readSeekNopCloser adds a no-op Close to a *bytes.Reader, keeping it seekable.
+type readSeekNopCloser struct {
+	*bytes.Reader
+}
+
+// Close does nothing.
+func (readSeekNopCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,258 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+// S3API is the part of the S3 client used by an S3Store. *s3.Client implements it.
+type S3API interface {
+	manager.UploadAPIClient
+	s3.ListObjectsV2APIClient
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+}
+
+// S3Store is a FileStore backed by a bucket in Amazon S3 or an S3-compatible service. Uploads go through the SDK's
+// upload manager, which sends large or unsized bodies as a multipart upload, part by part from memory, so nothing
+// is written to disk whatever the size of the upload.
+type S3Store struct {
+	client   S3API
+	bucket   string
+	uploader *manager.Uploader
+}
+
+// NewS3Store returns an S3Store for bucket using client, such as the *s3.Client returned by s3.NewFromConfig.
+// For MinIO or another local emulator, set the client's BaseEndpoint and UsePathStyle options. The upload
+// manager can be tuned with opts, e.g. to change the part size or concurrency, which bound the memory an upload
+// uses (5MB parts, five at a time, by default).
+func NewS3Store(client S3API, bucket string, opts ...func(*manager.Uploader)) *S3Store {
+	return &S3Store{
+		client:   client,
+		bucket:   bucket,
+		uploader: manager.NewUploader(client, opts...),
+	}
+}
+
+// NewS3StoreFromConfig returns an S3Store for bucket using an AWS SDK config, such as the one loaded by
+// config.LoadDefaultConfig in InitDDBLambda. optFns configure the S3 client.
+func NewS3StoreFromConfig(cfg aws.Config, bucket string, optFns ...func(*s3.Options)) *S3Store {
+	return NewS3Store(s3.NewFromConfig(cfg, optFns...), bucket)
+}
+
+// Put uploads r as the object key. Readers of unknown length are streamed as a multipart upload.
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, contentType string) (ObjectInfo, error) {
+	key = CleanKey(key)
+	contentType = contentTypeFor(key, contentType)
+
+	// the upload manager reads seekable bodies by section, so only count readers that cannot seek
+	var body io.Reader = r
+	var size int64
+	counter := &countingReader{r: r}
+	if seeker, ok := r.(io.ReadSeeker); ok {
+		start, err := seeker.Seek(0, io.SeekCurrent)
+		if err == nil {
+			var end int64
+			if end, err = seeker.Seek(0, io.SeekEnd); err == nil {
+				_, err = seeker.Seek(start, io.SeekStart)
+			}
+			size = end - start
+		}
+		if err != nil {
+			return ObjectInfo{}, fmt.Errorf("failed to size %s: %w", key, err)
+		}
+	} else {
+		body = counter
+	}
+
+	out, err := s.uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("failed to put %s: %w", key, s3Error(err))
+	}
+	if body == counter {
+		size = counter.n
+	}
+
+	return ObjectInfo{
+		Key:         key,
+		Size:        size,
+		ContentType: contentType,
+		ModTime:     time.Now().UTC(),
+		ETag:        aws.ToString(out.ETag),
+	}, nil
+}
+
+// Get downloads the object key. The returned reader is the response body, which cannot be seeked.
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	key = CleanKey(key)
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)})
+	if err != nil {
+		return nil, ObjectInfo{}, fmt.Errorf("failed to get %s: %w", key, s3Error(err))
+	}
+	return out.Body, ObjectInfo{
+		Key:         key,
+		Size:        aws.ToInt64(out.ContentLength),
+		ContentType: contentTypeFor(key, aws.ToString(out.ContentType)),
+		ModTime:     aws.ToTime(out.LastModified),
+		ETag:        aws.ToString(out.ETag),
+	}, nil
+}
+
+// GetRange reads length bytes of the object key starting at offset, with a Range request.
+func (s *S3Store) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	key = CleanKey(key)
+	byteRange := fmt.Sprintf("bytes=%d-", offset)
+	if length > 0 {
+		byteRange = fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	}
+
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key), Range: aws.String(byteRange)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %w", key, s3Error(err))
+	}
+	if out.ContentRange != nil {
+		return out.Body, nil
+	}
+
+	// a server that ignores the range sends the whole object, so skip to the offset
+	if _, err := io.CopyN(io.Discard, out.Body, offset); err != nil {
+		_ = out.Body.Close()
+		return nil, fmt.Errorf("failed to get %s: %w", key, err)
+	}
+	if length > 0 {
+		return struct {
+			io.Reader
+			io.Closer
+		}{io.LimitReader(out.Body, length), out.Body}, nil
+	}
+	return out.Body, nil
+}
+
+// Delete removes the object key.
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	key = CleanKey(key)
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)})
+	if err = s3Error(err); err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	return nil
+}
+
+// Move copies the object from to the key to within the bucket on the server, then deletes from.
+func (s *S3Store) Move(ctx context.Context, from, to string) error {
+	from, to = CleanKey(from), CleanKey(to)
+	_, err := s.client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(s.bucket),
+		Key:        aws.String(to),
+		CopySource: aws.String(escapePath(s.bucket + "/" + from)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy %s to %s: %w", from, to, s3Error(err))
+	}
+	return s.Delete(ctx, from)
+}
+
+// Stat returns the details of the object key using a HEAD request.
+func (s *S3Store) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	key = CleanKey(key)
+	out, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)})
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("failed to stat %s: %w", key, s3Error(err))
+	}
+	return ObjectInfo{
+		Key:         key,
+		Size:        aws.ToInt64(out.ContentLength),
+		ContentType: contentTypeFor(key, aws.ToString(out.ContentType)),
+		ModTime:     aws.ToTime(out.LastModified),
+		ETag:        aws.ToString(out.ETag),
+	}, nil
+}
+
+// List returns every object whose key starts with prefix, reading every page of results.
+func (s *S3Store) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var infos []ObjectInfo
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{Bucket: aws.String(s.bucket), Prefix: aws.String(prefix)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", prefix, s3Error(err))
+		}
+		for _, c := range page.Contents {
+			key := aws.ToString(c.Key)
+			infos = append(infos, ObjectInfo{
+				Key:         key,
+				Size:        aws.ToInt64(c.Size),
+				ContentType: contentTypeFor(key, ""),
+				ModTime:     aws.ToTime(c.LastModified),
+				ETag:        aws.ToString(c.ETag),
+			})
+		}
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+	return infos, nil
+}
+
+// s3Error returns ErrNotFound for S3's answers about a missing key: NoSuchKey, or NotFound for a HEAD request,
+// which has no body to carry an error code. Other errors are returned as they are.
+func s3Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && (apiErr.ErrorCode() == "NoSuchKey" || apiErr.ErrorCode() == "NotFound") {
+		return ErrNotFound
+	}
+	var resErr *awshttp.ResponseError
+	if errors.As(err, &resErr) && resErr.HTTPStatusCode() == http.StatusNotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// escapePath percent-encodes every byte of p except unreserved characters and slashes, as S3 expects of a copy
+// source.
+func escapePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// RangeGetter is implemented by stores whose Get returns a reader that cannot seek, but which can read an object
+// from an offset without fetching what comes before it, such as S3 with a Range header.
+type RangeGetter interface {
+	// GetRange returns a reader for length bytes of key starting at offset. A length of zero or less reads to the
+	// end of the object.
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+}
+
+// NewSeeker returns a reader for the object key of the given size that can seek, by reading from store with
+// GetRange after each seek. Body, if not nil, is an open reader from the start of the object, such as the one
+// returned by Get, and is used until the first seek away from the start. The seeker closes whatever reader it
+// has open when it is closed.
+func NewSeeker(ctx context.Context, store RangeGetter, key string, size int64, body io.ReadCloser) io.ReadSeekCloser {
+	return &seeker{ctx: ctx, store: store, key: key, size: size, body: body}
+}
+
+// seeker opens ranged reads lazily, so seeks that are undone before reading, such as the seek to the end
+// http.ServeContent makes to find the size, cost nothing.
+type seeker struct {
+	ctx   context.Context
+	store RangeGetter
+	key   string
+	size  int64
+	// pos is where the next read starts, and bodyPos is where body is up to
+	pos, bodyPos int64
+	body         io.ReadCloser
+}
+
+func (s *seeker) Read(p []byte) (int, error) {
+	if s.body != nil && s.bodyPos != s.pos {
+		_ = s.body.Close()
+		s.body = nil
+	}
+	if s.pos >= s.size {
+		return 0, io.EOF
+	}
+	if s.body == nil {
+		body, err := s.store.GetRange(s.ctx, s.key, s.pos, 0)
+		if err != nil {
+			return 0, err
+		}
+		s.body, s.bodyPos = body, s.pos
+	}
+
+	n, err := s.body.Read(p)
+	s.pos += int64(n)
+	s.bodyPos = s.pos
+	return n, err
+}
+
+func (s *seeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.pos
+	case io.SeekEnd:
+		offset += s.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	s.pos = offset
+	return offset, nil
+}
+
+func (s *seeker) Close() error {
+	if s.body == nil {
+		return nil
+	}
+	err := s.body.Close()
+	s.body = nil
+	return err
+}
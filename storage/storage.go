@@ -0,0 +1,83 @@
+// Package storage defines FileStore, the backend Tools uses to save uploads and serve downloads, with local disk,
+// in-memory and S3-compatible implementations. Keys are slash separated paths such as "logos/acme.png"; for S3
+// they are object keys within a bucket, such as the one named by Company.StorageName or Location.StorageName.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when a key does not exist in a FileStore.
+var ErrNotFound = errors.New("storage: object not found")
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+	ETag        string
+}
+
+// FileStore saves, reads and removes objects by key.
+type FileStore interface {
+	// Put stores the contents of r under key, replacing any existing object, and returns its details.
+	Put(ctx context.Context, key string, r io.Reader, contentType string) (ObjectInfo, error)
+	// Get opens the object stored under key. The caller must close the returned reader. If the reader also
+	// implements io.Seeker it may be used to serve range requests.
+	Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error)
+	// Delete removes the object stored under key. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+	// Stat returns the details of the object stored under key, or ErrNotFound.
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// List returns the details of every object whose key starts with prefix, sorted by key.
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+}
+
+// Mover is implemented by stores that can move an object without the caller copying it, such as a rename on
+// disk or a server side copy in S3.
+type Mover interface {
+	Move(ctx context.Context, from, to string) error
+}
+
+// Move moves the object stored under from to the key to, replacing any object already there. Stores that are
+// not a Mover have the object copied through Get and Put, then deleted.
+func Move(ctx context.Context, store FileStore, from, to string) error {
+	if m, ok := store.(Mover); ok {
+		return m.Move(ctx, from, to)
+	}
+
+	rc, info, err := store.Get(ctx, from)
+	if err != nil {
+		return err
+	}
+	_, err = store.Put(ctx, to, rc, info.ContentType)
+	_ = rc.Close()
+	if err != nil {
+		return err
+	}
+	return store.Delete(ctx, from)
+}
+
+// CleanKey normalises a key to a slash separated path without a leading "./" or "/".
+func CleanKey(key string) string {
+	key = path.Clean("/" + strings.ReplaceAll(key, "\\", "/"))
+	return strings.TrimPrefix(key, "/")
+}
+
+// contentTypeFor returns contentType, or the type implied by the key's extension if contentType is empty.
+func contentTypeFor(key, contentType string) string {
+	if contentType != "" {
+		return contentType
+	}
+	if t := mime.TypeByExtension(path.Ext(key)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
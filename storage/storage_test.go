@@ -0,0 +1,332 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+// fakeS3 is a minimal S3-compatible server using path style addressing, like a local MinIO. It supports single
+// and multipart uploads, so requests come from the real SDK client.
+type fakeS3 struct {
+	mu      sync.Mutex
+	bucket  string
+	objects map[string][]byte
+	types   map[string]string
+	uploads map[string]map[int][]byte
+	// ignoreRange sends whole objects for Range requests, as some S3-compatible servers do
+	ignoreRange bool
+}
+
+func newFakeS3(bucket string) *fakeS3 {
+	return &fakeS3{bucket: bucket, objects: map[string][]byte{}, types: map[string]string{}, uploads: map[string]map[int][]byte{}}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = io.WriteString(w, "<Error><Code>AccessDenied</Code><Message>missing signature</Message></Error>")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if path != f.bucket && !strings.HasPrefix(path, f.bucket+"/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	key := strings.TrimPrefix(strings.TrimPrefix(path, f.bucket), "/")
+	query := r.URL.Query()
+
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		type content struct {
+			Key          string
+			LastModified time.Time
+			Size         int64
+		}
+		var result struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Contents []content
+		}
+		for k, v := range f.objects {
+			if strings.HasPrefix(k, query.Get("prefix")) {
+				result.Contents = append(result.Contents, content{Key: k, LastModified: time.Now(), Size: int64(len(v))})
+			}
+		}
+		_ = xml.NewEncoder(w).Encode(result)
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		id := fmt.Sprint(len(f.uploads) + 1)
+		f.uploads[id] = map[int][]byte{}
+		f.types[key] = r.Header.Get("Content-Type")
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>", f.bucket, key, id)
+	case r.Method == http.MethodPut && query.Has("partNumber"):
+		parts, ok := f.uploads[query.Get("uploadId")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, "<Error><Code>NoSuchUpload</Code></Error>")
+			return
+		}
+		n, _ := strconv.Atoi(query.Get("partNumber"))
+		parts[n], _ = io.ReadAll(r.Body)
+		w.Header().Set("ETag", fmt.Sprintf(`"part%d"`, n))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		parts := f.uploads[query.Get("uploadId")]
+		numbers := make([]int, 0, len(parts))
+		for n := range parts {
+			numbers = append(numbers, n)
+		}
+		sort.Ints(numbers)
+		var b []byte
+		for _, n := range numbers {
+			b = append(b, parts[n]...)
+		}
+		f.objects[key] = b
+		delete(f.uploads, query.Get("uploadId"))
+		_, _ = io.WriteString(w, `<CompleteMultipartUploadResult><ETag>"multipart"</ETag></CompleteMultipartUploadResult>`)
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(f.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		source, _ := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+		b, ok := f.objects[strings.TrimPrefix(source, f.bucket+"/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, "<Error><Code>NoSuchKey</Code></Error>")
+			return
+		}
+		f.objects[key] = b
+		_, _ = io.WriteString(w, "<CopyObjectResult></CopyObjectResult>")
+	case r.Method == http.MethodPut:
+		if r.ContentLength < 0 {
+			w.WriteHeader(http.StatusLengthRequired)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		f.objects[key] = b
+		f.types[key] = r.Header.Get("Content-Type")
+		w.Header().Set("ETag", `"etag"`)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		b, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method == http.MethodGet {
+				_, _ = io.WriteString(w, "<Error><Code>NoSuchKey</Code></Error>")
+			}
+			return
+		}
+		w.Header().Set("Content-Type", f.types[key])
+		if f.ignoreRange {
+			w.Header().Set("Content-Length", fmt.Sprint(len(b)))
+			if r.Method == http.MethodGet {
+				_, _ = w.Write(b)
+			}
+			return
+		}
+		http.ServeContent(w, r, key, time.Time{}, bytes.NewReader(b))
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// newTestS3Store returns an S3Store using the SDK client against a fake server, signing with creds.
+func newTestS3Store(t *testing.T, fake *fakeS3, creds aws.CredentialsProvider) *S3Store {
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(srv.URL),
+		UsePathStyle: true,
+		Credentials:  creds,
+	})
+	return NewS3Store(client, fake.bucket)
+}
+
+// testStores returns each FileStore implementation, with any server backing it.
+func testStores(t *testing.T) map[string]FileStore {
+	return map[string]FileStore{
+		"local":  NewLocalStore(t.TempDir()),
+		"memory": NewMemoryStore(),
+		"s3":     newTestS3Store(t, newFakeS3("logos"), credentials.NewStaticCredentialsProvider("AKID", "SECRET", "")),
+	}
+}
+
+func TestFileStores(t *testing.T) {
+	ctx := context.Background()
+
+	for name, store := range testStores(t) {
+		info, err := store.Put(ctx, "companies/acme/logo.png", strings.NewReader("png data"), "image/png")
+		if err != nil {
+			t.Errorf("%s: put failed: %s", name, err)
+			continue
+		}
+		if info.Size != 8 || info.ContentType != "image/png" {
+			t.Errorf("%s: unexpected put info %+v", name, info)
+		}
+
+		// a reader that cannot seek, with a key that needs escaping
+		if _, err := store.Put(ctx, "companies/acme/site map+1.pdf", io.MultiReader(strings.NewReader("%PDF")), ""); err != nil {
+			t.Errorf("%s: put of unseekable reader failed: %s", name, err)
+		}
+
+		rc, info, err := store.Get(ctx, "companies/acme/logo.png")
+		if err != nil {
+			t.Errorf("%s: get failed: %s", name, err)
+			continue
+		}
+		b, _ := io.ReadAll(rc)
+		_ = rc.Close()
+		if string(b) != "png data" || info.Size != 8 {
+			t.Errorf("%s: expected the stored data, recieved %q (%d bytes)", name, b, info.Size)
+		}
+
+		info, err = store.Stat(ctx, "companies/acme/site map+1.pdf")
+		if err != nil || info.Size != 4 || info.ContentType != "application/pdf" {
+			t.Errorf("%s: unexpected stat %+v %v", name, info, err)
+		}
+
+		list, err := store.List(ctx, "companies/acme/")
+		if err != nil {
+			t.Errorf("%s: list failed: %s", name, err)
+		}
+		var keys []string
+		for _, o := range list {
+			keys = append(keys, o.Key)
+		}
+		sort.Strings(keys)
+		if strings.Join(keys, ",") != "companies/acme/logo.png,companies/acme/site map+1.pdf" {
+			t.Errorf("%s: unexpected list %v", name, keys)
+		}
+
+		if err := Move(ctx, store, "companies/acme/site map+1.pdf", "companies/acme/map.pdf"); err != nil {
+			t.Errorf("%s: move failed: %s", name, err)
+		}
+		if _, err := store.Stat(ctx, "companies/acme/map.pdf"); err != nil {
+			t.Errorf("%s: expected the moved object, recieved %v", name, err)
+		}
+		if _, err := store.Stat(ctx, "companies/acme/site map+1.pdf"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: expected the move source to be gone, recieved %v", name, err)
+		}
+
+		if err := store.Delete(ctx, "companies/acme/logo.png"); err != nil {
+			t.Errorf("%s: delete failed: %s", name, err)
+		}
+		if _, err := store.Stat(ctx, "companies/acme/logo.png"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: expected ErrNotFound after delete, recieved %v", name, err)
+		}
+		if _, _, err := store.Get(ctx, "missing.png"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: expected ErrNotFound for a missing key, recieved %v", name, err)
+		}
+		if err := store.Delete(ctx, "missing.png"); err != nil {
+			t.Errorf("%s: expected deleting a missing key to succeed, recieved %v", name, err)
+		}
+	}
+}
+
+func TestLocalStoreConfinesKeys(t *testing.T) {
+	dir := t.TempDir()
+	store := NewLocalStore(dir + "/root")
+
+	if _, err := store.Put(context.Background(), "../../escape.txt", strings.NewReader("x"), ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewLocalStore(dir).Stat(context.Background(), "root/escape.txt"); err != nil {
+		t.Errorf("expected the key to be kept inside the root, recieved %v", err)
+	}
+}
+
+func TestS3StoreErrors(t *testing.T) {
+	store := newTestS3Store(t, newFakeS3("logos"), aws.AnonymousCredentials{})
+	_, _, err := store.Get(context.Background(), "logo.png")
+
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "AccessDenied" {
+		t.Errorf("expected AccessDenied for an unsigned request, recieved %v", err)
+	}
+}
+
+func TestS3StoreMultipart(t *testing.T) {
+	// the upload must not spool to disk, so point temporary files at a directory that can be checked
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	fake := newFakeS3("videos")
+	store := newTestS3Store(t, fake, credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""))
+
+	data := bytes.Repeat([]byte("0123456789"), 1200*1024)
+	info, err := store.Put(context.Background(), "intro.mp4", io.MultiReader(bytes.NewReader(data)), "video/mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != int64(len(data)) || info.ETag != `"multipart"` {
+		t.Errorf("expected a multipart upload of %d bytes, recieved %+v", len(data), info)
+	}
+	if !bytes.Equal(fake.objects["intro.mp4"], data) {
+		t.Errorf("expected the parts to join into the uploaded data, recieved %d bytes", len(fake.objects["intro.mp4"]))
+	}
+	if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+		t.Errorf("expected nothing written to disk, recieved %d files", len(entries))
+	}
+}
+
+func TestS3StoreSeeker(t *testing.T) {
+	ctx := context.Background()
+
+	for _, ignoreRange := range []bool{false, true} {
+		fake := newFakeS3("videos")
+		fake.ignoreRange = ignoreRange
+		store := newTestS3Store(t, fake, credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""))
+
+		if _, err := store.Put(ctx, "intro.mp4", strings.NewReader("0123456789"), "video/mp4"); err != nil {
+			t.Fatal(err)
+		}
+		rc, info, err := store.Get(ctx, "intro.mp4")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := NewSeeker(ctx, store, "intro.mp4", info.Size, rc)
+
+		if end, _ := s.Seek(0, io.SeekEnd); end != 10 {
+			t.Errorf("ignore range %v: expected the end at 10, recieved %d", ignoreRange, end)
+		}
+		_, _ = s.Seek(3, io.SeekStart)
+		b := make([]byte, 4)
+		if _, err := io.ReadFull(s, b); err != nil || string(b) != "3456" {
+			t.Errorf("ignore range %v: expected 3456, recieved %q %v", ignoreRange, b, err)
+		}
+		if part, _ := store.GetRange(ctx, "intro.mp4", 8, 1); part != nil {
+			b, _ := io.ReadAll(part)
+			_ = part.Close()
+			if string(b) != "8" {
+				t.Errorf("ignore range %v: expected a one byte range, recieved %q", ignoreRange, b)
+			}
+		}
+		_, _ = s.Seek(0, io.SeekStart)
+		if all, _ := io.ReadAll(s); string(all) != "0123456789" {
+			t.Errorf("ignore range %v: expected the whole object after seeking back, recieved %q", ignoreRange, all)
+		}
+		_ = s.Close()
+	}
+}
@@ -0,0 +1,327 @@
+package toolkit
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// NDJSONContentType is the media type for newline delimited JSON.
+const NDJSONContentType = "application/x-ndjson"
+
+// EncoderFunc wraps w in a compressing writer. Closing the returned writer must flush any buffered data to w.
+type EncoderFunc func(w io.Writer) (io.WriteCloser, error)
+
+// defaultEncoders are the content encodings available without any configuration. Brotli ("br") is not in the
+// standard library and this module has no dependency providing it, so br is only negotiated once an encoder is
+// added through Tools.Encoders, e.g. one wrapping github.com/andybalholm/brotli.
+var defaultEncoders = map[string]EncoderFunc{
+	"gzip": func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriter(w), nil
+	},
+	"deflate": func(w io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(w, flate.DefaultCompression)
+	},
+}
+
+// etagBufferSize is the most JSON StreamJSON holds back while computing an ETag. Larger responses are streamed
+// without an ETag.
+const etagBufferSize = 1 << 20
+
+// StreamJSON writes data as JSON without marshalling the whole payload into memory first. Slices and arrays are
+// encoded element by element, and receive only channels are drained until closed, so large result sets (and
+// results produced as they are read) can be sent as they become available. Anything else is encoded as a single value.
+//
+// The response is compressed using the best encoding from the request's Accept-Encoding header (gzip or deflate,
+// plus any in Tools.Encoders), and is written as NDJSON (one value per line) if the request accepts
+// application/x-ndjson. For GET and HEAD requests returning 200, slices and single values whose JSON fits in 1MB
+// get a weak ETag computed from the uncompressed JSON, and a 304 is sent if it matches the request's If-None-Match
+// header. The payload is encoded once; larger payloads are streamed as soon as they outgrow the buffer.
+//
+// A channel is read until it is closed or the request's context is done, e.g. because the client went away, in
+// which case StreamJSON returns the context's error. It stops reading on a write error too, so the goroutine
+// sending on the channel must also select on r.Context().Done() to stop when nothing is reading any more:
+//
+//	select {
+//	case ch <- trainee:
+//	case <-r.Context().Done():
+//		return
+//	}
+func (t *Tools) StreamJSON(w http.ResponseWriter, r *http.Request, status int, data interface{}, headers ...http.Header) (err error) {
+	ndjson := acceptsNDJSON(r)
+
+	if len(headers) > 0 {
+		for k, v := range headers[0] {
+			w.Header()[k] = v
+		}
+	}
+
+	if ndjson {
+		w.Header().Set("Content-Type", NDJSONContentType)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	// the body depends on Accept-Encoding, so caches must know, even for a 304
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	v := reflect.ValueOf(data)
+	isChan := v.Kind() == reflect.Chan
+	lastModified, _ := http.ParseTime(w.Header().Get("Last-Modified"))
+
+	s := &jsonStream{t: t, w: w, r: r, status: status}
+	if !isChan && status == http.StatusOK && (r.Method == http.MethodGet || r.Method == http.MethodHead) && w.Header().Get("ETag") == "" {
+		s.hash = sha256.New()
+	} else if status == http.StatusOK && NotModified(r, w.Header().Get("ETag"), lastModified) {
+		// answer conditional requests for an ETag or Last-Modified header passed in by the caller
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	defer func() {
+		if s.closer != nil {
+			if closeErr := s.closer.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	}()
+
+	if s.hash == nil {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+
+	bw := bufio.NewWriterSize(s, 32*1024)
+	var flush func() error
+	if isChan {
+		// values from a channel may arrive slowly, so push each one to the client as it is written
+		flush = func() error {
+			if err := bw.Flush(); err != nil {
+				return err
+			}
+			if f, ok := s.out.(interface{ Flush() error }); ok {
+				if err := f.Flush(); err != nil {
+					return err
+				}
+			}
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+			return nil
+		}
+	}
+
+	if err := encodeStream(r.Context(), bw, v, ndjson, flush); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	if s.out == nil {
+		// the whole payload fit in the buffer, so it gets an ETag
+		etag := `W/"` + hex.EncodeToString(s.hash.Sum(nil))[:32] + `"`
+		w.Header().Set("ETag", etag)
+		if NotModified(r, etag, lastModified) {
+			w.WriteHeader(http.StatusNotModified)
+			return nil
+		}
+		return s.start()
+	}
+	return nil
+}
+
+// jsonStream is the body of a StreamJSON response. While an ETag is computed, the JSON is hashed and held back
+// until the response is started.
+type jsonStream struct {
+	t      *Tools
+	w      http.ResponseWriter
+	r      *http.Request
+	status int
+	hash   hash.Hash
+	held   bytes.Buffer
+	// out is where the body goes once the response is started, and closer closes its compressor, if any
+	out    io.Writer
+	closer io.Closer
+}
+
+// Write sends p to the client once the response is started, or holds it back until it outgrows etagBufferSize.
+func (s *jsonStream) Write(p []byte) (int, error) {
+	if s.out != nil {
+		return s.out.Write(p)
+	}
+	s.hash.Write(p)
+	s.held.Write(p)
+	if s.held.Len() > etagBufferSize {
+		if err := s.start(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// start negotiates the content encoding, writes the headers and sends any JSON held back.
+func (s *jsonStream) start() error {
+	name, enc := s.t.negotiateEncoding(s.r)
+	if enc != nil {
+		s.w.Header().Set("Content-Encoding", name)
+		s.w.Header().Del("Content-Length")
+	}
+
+	if s.r.Method == http.MethodHead {
+		s.w.WriteHeader(s.status)
+		s.out = io.Discard
+		return nil
+	}
+
+	s.out = s.w
+	if enc != nil {
+		cw, err := enc(s.w)
+		if err != nil {
+			s.w.Header().Del("Content-Encoding")
+			s.out = nil
+			return err
+		}
+		s.out, s.closer = cw, cw
+	}
+
+	s.w.WriteHeader(s.status)
+	_, err := s.held.WriteTo(s.out)
+	return err
+}
+
+// encodeStream writes v to w as a JSON array or NDJSON if it is a slice, array or channel, or as a single value
+// otherwise. If flush is not nil it is called after each element. A channel is read until it is closed or ctx is
+// done.
+func encodeStream(ctx context.Context, w io.Writer, v reflect.Value, ndjson bool, flush func() error) error {
+	enc := json.NewEncoder(w)
+
+	var next func() (reflect.Value, bool)
+	// done is set once the context stops a channel from being read
+	var done error
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() && !ndjson {
+			_, err := io.WriteString(w, "null\n")
+			return err
+		}
+		i := 0
+		next = func() (reflect.Value, bool) {
+			if i >= v.Len() {
+				return reflect.Value{}, false
+			}
+			i++
+			return v.Index(i - 1), true
+		}
+	case reflect.Chan:
+		cases := []reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+			{Dir: reflect.SelectRecv, Chan: v},
+		}
+		next = func() (reflect.Value, bool) {
+			chosen, item, ok := reflect.Select(cases)
+			if chosen == 0 {
+				done = ctx.Err()
+				return reflect.Value{}, false
+			}
+			return item, ok
+		}
+	default:
+		if !v.IsValid() {
+			_, err := io.WriteString(w, "null\n")
+			return err
+		}
+		return enc.Encode(v.Interface())
+	}
+
+	if !ndjson {
+		if _, err := io.WriteString(w, "["); err != nil {
+			return err
+		}
+	}
+
+	for n := 0; ; n++ {
+		item, ok := next()
+		if !ok {
+			if done != nil {
+				return done
+			}
+			break
+		}
+		if n > 0 && !ndjson {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		// Encode always appends a newline, which is what NDJSON needs and is harmless inside an array
+		if err := enc.Encode(item.Interface()); err != nil {
+			return err
+		}
+		if flush != nil {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !ndjson {
+		if _, err := io.WriteString(w, "]\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// acceptsNDJSON reports whether the request asked for newline delimited JSON.
+func acceptsNDJSON(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(accept, ";")
+		if strings.EqualFold(strings.TrimSpace(mediaType), NDJSONContentType) {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateEncoding picks the content encoding with the highest q value from the request's Accept-Encoding
+// header that is available in t.Encoders or the default encoders. It returns a nil EncoderFunc for identity.
+func (t *Tools) negotiateEncoding(r *http.Request) (string, EncoderFunc) {
+	bestName, bestQ := "", 0.0
+	var best EncoderFunc
+
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		q := 1.0
+		if k, v, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(k) == "q" {
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				q = f
+			}
+		}
+		if q <= bestQ {
+			continue
+		}
+
+		enc, ok := t.Encoders[name]
+		if !ok {
+			enc, ok = defaultEncoders[name]
+		}
+		if ok && enc != nil {
+			bestName, bestQ, best = name, q, enc
+		}
+	}
+
+	return bestName, best
+}
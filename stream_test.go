@@ -0,0 +1,265 @@
+package toolkit
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/babykittenz/api-micro-util/models"
+)
+
+// streamTests is a test table for StreamJSON, listing the request headers and the expected response encoding and format.
+var streamTests = []struct {
+	name             string
+	acceptEncoding   string
+	accept           string
+	expectedEncoding string
+	expectNDJSON     bool
+}{
+	{"plain", "", "", "", false},
+	{"gzip", "gzip, deflate", "", "gzip", false},
+	{"deflate preferred", "gzip;q=0.5, deflate", "", "deflate", false},
+	{"unsupported encoding", "br", "", "", false},
+	{"ndjson", "", "application/x-ndjson", "", true},
+	{"gzip ndjson", "gzip", "application/x-ndjson", "gzip", true},
+}
+
+// TestTools_StreamJSON tests StreamJSON with a slice of trainees for every entry in streamTests.
+func TestTools_StreamJSON(t *testing.T) {
+	var testTools Tools
+	trainees := []*models.Trainee{
+		{ID: "1", FirstName: "Robert", LastName: "Martinez"},
+		{ID: "2", FirstName: "Jennifer", LastName: "Garcia"},
+		{ID: "3", FirstName: "Thomas", LastName: "Wilson"},
+	}
+
+	for _, e := range streamTests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", e.acceptEncoding)
+		req.Header.Set("Accept", e.accept)
+		rr := httptest.NewRecorder()
+
+		err := testTools.StreamJSON(rr, req, http.StatusOK, trainees)
+		if err != nil {
+			t.Errorf("%s: %s", e.name, err.Error())
+			continue
+		}
+
+		if rr.Header().Get("Content-Encoding") != e.expectedEncoding {
+			t.Errorf("%s: wrong content encoding %q", e.name, rr.Header().Get("Content-Encoding"))
+		}
+
+		if rr.Header().Get("ETag") == "" {
+			t.Errorf("%s: expected an ETag", e.name)
+		}
+
+		var body io.Reader = rr.Body
+		if e.expectedEncoding == "gzip" {
+			body, err = gzip.NewReader(rr.Body)
+			if err != nil {
+				t.Errorf("%s: %s", e.name, err.Error())
+				continue
+			}
+		} else if e.expectedEncoding != "" {
+			continue
+		}
+
+		var decoded []models.Trainee
+		if e.expectNDJSON {
+			scanner := bufio.NewScanner(body)
+			for scanner.Scan() {
+				var trainee models.Trainee
+				if err := json.Unmarshal(scanner.Bytes(), &trainee); err != nil {
+					t.Errorf("%s: bad ndjson line %q", e.name, scanner.Text())
+				}
+				decoded = append(decoded, trainee)
+			}
+		} else if err := json.NewDecoder(body).Decode(&decoded); err != nil {
+			t.Errorf("%s: received error while decoding json: %s", e.name, err.Error())
+		}
+
+		if len(decoded) != len(trainees) || decoded[2].FirstName != "Thomas" {
+			t.Errorf("%s: wrong trainees decoded: %v", e.name, decoded)
+		}
+	}
+}
+
+// TestTools_StreamJSONChannel tests that StreamJSON drains a channel into a JSON array.
+func TestTools_StreamJSONChannel(t *testing.T) {
+	var testTools Tools
+	ch := make(chan int)
+	go func() {
+		defer close(ch)
+		for i := 0; i < 5; i++ {
+			ch <- i
+		}
+	}()
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rr := httptest.NewRecorder()
+
+	err := testTools.StreamJSON(rr, req, http.StatusOK, ch)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if got := strings.TrimSpace(strings.ReplaceAll(rr.Body.String(), "\n", "")); got != "[0,1,2,3,4]" {
+		t.Errorf("wrong body %q", got)
+	}
+
+	if rr.Header().Get("ETag") != "" {
+		t.Error("channels must not get an ETag")
+	}
+}
+
+// brokenWriter is a response writer whose client has gone away: writes fail and the request context is cancelled,
+// as net/http does when the connection drops.
+type brokenWriter struct {
+	*httptest.ResponseRecorder
+	cancel context.CancelFunc
+}
+
+func (w *brokenWriter) Write(p []byte) (int, error) {
+	w.cancel()
+	return 0, errors.New("connection reset by peer")
+}
+
+// TestTools_StreamJSONChannelCancel tests that StreamJSON stops reading a channel when the client goes away, either
+// during a write or while waiting for the next value, and that a producer selecting on the request context exits.
+func TestTools_StreamJSONChannelCancel(t *testing.T) {
+	tests := []struct {
+		name       string
+		disconnect bool
+	}{
+		{"write fails", true},
+		{"cancelled while waiting", false},
+	}
+
+	for _, tt := range tests {
+		var testTools Tools
+		ctx, cancel := context.WithCancel(context.Background())
+		req := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+
+		ch := make(chan int)
+		exited := make(chan struct{})
+		go func() {
+			defer close(exited)
+			for i := 0; ; i++ {
+				if i == 2 && !tt.disconnect {
+					// nothing more is ready yet when the client goes away
+					time.AfterFunc(20*time.Millisecond, cancel)
+				}
+				if i >= 2 && !tt.disconnect {
+					<-ctx.Done()
+					return
+				}
+				select {
+				case ch <- i:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+
+		var w http.ResponseWriter = httptest.NewRecorder()
+		if tt.disconnect {
+			w = &brokenWriter{ResponseRecorder: httptest.NewRecorder(), cancel: cancel}
+		}
+		err := testTools.StreamJSON(w, req, http.StatusOK, ch)
+		if err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+		if !tt.disconnect && !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: expected context.Canceled, recieved %v", tt.name, err)
+		}
+
+		select {
+		case <-exited:
+		case <-time.After(time.Second):
+			t.Errorf("%s: producer did not exit", tt.name)
+		}
+		cancel()
+	}
+}
+
+// closeRecorder is a compressing writer that records whether it was closed.
+type closeRecorder struct {
+	io.Writer
+	closed bool
+}
+
+// Close records the close.
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+// TestTools_StreamJSONConditional tests 304 responses, large payloads and encode errors.
+func TestTools_StreamJSONConditional(t *testing.T) {
+	var testTools Tools
+	trainees := []*models.Trainee{{ID: "1", FirstName: "Robert"}}
+
+	// a matching ETag gets a 304 that still varies on Accept-Encoding
+	req := httptest.NewRequest("GET", "/", nil)
+	rr := httptest.NewRecorder()
+	if err := testTools.StreamJSON(rr, req, http.StatusOK, trainees); err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("If-None-Match", rr.Header().Get("ETag"))
+	rr = httptest.NewRecorder()
+	if err := testTools.StreamJSON(rr, req, http.StatusOK, trainees); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("wrong status code recieved: %d", rr.Code)
+	}
+	if rr.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("304 without Vary, recieved %q", rr.Header().Get("Vary"))
+	}
+
+	// a payload larger than the ETag buffer is streamed without one
+	large := make([]string, 0, 2000)
+	for i := 0; i < cap(large); i++ {
+		large = append(large, strings.Repeat("x", 1000))
+	}
+	rr = httptest.NewRecorder()
+	if err := testTools.StreamJSON(rr, httptest.NewRequest("GET", "/", nil), http.StatusOK, large); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Header().Get("ETag") != "" {
+		t.Error("large payloads must not get an ETag")
+	}
+	var decoded []string
+	if err := json.NewDecoder(rr.Body).Decode(&decoded); err != nil || len(decoded) != len(large) {
+		t.Errorf("wrong large payload decoded: %d values, %v", len(decoded), err)
+	}
+
+	// the compressor is closed when encoding fails
+	enc := &closeRecorder{}
+	toolsWithEncoder := Tools{Encoders: map[string]EncoderFunc{"br": func(w io.Writer) (io.WriteCloser, error) {
+		enc.Writer = w
+		return enc, nil
+	}}}
+	ch := make(chan interface{}, 2)
+	ch <- 1
+	ch <- func() {}
+	close(ch)
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "br")
+	if err := toolsWithEncoder.StreamJSON(httptest.NewRecorder(), req, http.StatusOK, ch); err == nil {
+		t.Error("expected an encode error")
+	}
+	if !enc.closed {
+		t.Error("compressor was not closed after an encode error")
+	}
+}
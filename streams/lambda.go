@@ -0,0 +1,183 @@
+package streams
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ttlPrincipal is the principal of the records of items removed by TTL.
+const ttlPrincipal = "dynamodb.amazonaws.com"
+
+// LambdaEvent is the payload Lambda sends a function subscribed to a DynamoDB stream.
+type LambdaEvent struct {
+	Records []LambdaRecord `json:"Records"`
+}
+
+// LambdaRecord is a record of a LambdaEvent.
+type LambdaRecord struct {
+	EventID        string             `json:"eventID"`
+	EventName      string             `json:"eventName"`
+	EventSource    string             `json:"eventSource"`
+	EventSourceARN string             `json:"eventSourceARN"`
+	AWSRegion      string             `json:"awsRegion"`
+	DynamoDB       LambdaStreamRecord `json:"dynamodb"`
+	UserIdentity   *struct {
+		Type        string `json:"type"`
+		PrincipalID string `json:"principalId"`
+	} `json:"userIdentity,omitempty"`
+}
+
+// LambdaStreamRecord is the change described by a LambdaRecord.
+type LambdaStreamRecord struct {
+	// ApproximateCreationDateTime is in Unix seconds
+	ApproximateCreationDateTime float64 `json:"ApproximateCreationDateTime"`
+	Keys                        Image   `json:"Keys"`
+	NewImage                    Image   `json:"NewImage,omitempty"`
+	OldImage                    Image   `json:"OldImage,omitempty"`
+	SequenceNumber              string  `json:"SequenceNumber"`
+	SizeBytes                   int64   `json:"SizeBytes"`
+	StreamViewType              string  `json:"StreamViewType"`
+}
+
+// Image is an item in the DynamoDB JSON format used by Lambda, e.g. {"id": {"S": "1"}}.
+type Image map[string]types.AttributeValue
+
+// UnmarshalJSON decodes an item in the DynamoDB JSON format.
+func (i *Image) UnmarshalJSON(b []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if raw == nil {
+		*i = nil
+		return nil
+	}
+	image, err := decodeMap(raw)
+	if err != nil {
+		return err
+	}
+	*i = image
+	return nil
+}
+
+// BatchResponse reports the records a function failed to process, for event source mappings with
+// ReportBatchItemFailures enabled. Lambda retries the batch from the first failed record.
+type BatchResponse struct {
+	BatchItemFailures []BatchItemFailure `json:"batchItemFailures"`
+}
+
+// BatchItemFailure identifies a failed record by its sequence number.
+type BatchItemFailure struct {
+	ItemIdentifier string `json:"itemIdentifier"`
+}
+
+// HandleLambda processes the records of a Lambda event, and can be passed to lambda.Start. When a handler fails,
+// the error is returned so Lambda retries the whole batch, unless the consumer reports batch item failures, in which
+// case the failed record is reported in the response and Lambda retries from it.
+func (c *Consumer) HandleLambda(ctx context.Context, event LambdaEvent) (BatchResponse, error) {
+	records := make([]Record, len(event.Records))
+	for i, r := range event.Records {
+		records[i] = r.record()
+	}
+
+	res := BatchResponse{BatchItemFailures: []BatchItemFailure{}}
+	processed, err := c.Process(ctx, records)
+	if err == nil {
+		return res, nil
+	}
+	if !c.ReportBatchItemFailures || records[processed].SequenceNumber == "" {
+		return res, err
+	}
+	res.BatchItemFailures = append(res.BatchItemFailures, BatchItemFailure{ItemIdentifier: records[processed].SequenceNumber})
+	return res, nil
+}
+
+// record converts the Lambda record to a Record.
+func (r LambdaRecord) record() Record {
+	record := Record{
+		EventID:        r.EventID,
+		EventName:      r.EventName,
+		Table:          tableFromARN(r.EventSourceARN),
+		SequenceNumber: r.DynamoDB.SequenceNumber,
+		Keys:           r.DynamoDB.Keys,
+		OldImage:       r.DynamoDB.OldImage,
+		NewImage:       r.DynamoDB.NewImage,
+		Expired:        r.UserIdentity != nil && r.UserIdentity.PrincipalID == ttlPrincipal,
+	}
+	if t := r.DynamoDB.ApproximateCreationDateTime; t > 0 {
+		record.Created = time.UnixMilli(int64(t * 1000)).UTC()
+	}
+	return record
+}
+
+// decodeMap decodes the attributes of an item or map.
+func decodeMap(raw map[string]json.RawMessage) (map[string]types.AttributeValue, error) {
+	m := make(map[string]types.AttributeValue, len(raw))
+	for name, value := range raw {
+		av, err := decodeAttributeValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode attribute %s: %w", name, err)
+		}
+		m[name] = av
+	}
+	return m, nil
+}
+
+// decodeAttributeValue decodes a single value in the DynamoDB JSON format, such as {"N": "42"}.
+func decodeAttributeValue(b json.RawMessage) (types.AttributeValue, error) {
+	var v struct {
+		S    *string                    `json:"S"`
+		N    *string                    `json:"N"`
+		B    []byte                     `json:"B"`
+		BOOL *bool                      `json:"BOOL"`
+		NULL *bool                      `json:"NULL"`
+		SS   []string                   `json:"SS"`
+		NS   []string                   `json:"NS"`
+		BS   [][]byte                   `json:"BS"`
+		L    []json.RawMessage          `json:"L"`
+		M    map[string]json.RawMessage `json:"M"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case v.S != nil:
+		return &types.AttributeValueMemberS{Value: *v.S}, nil
+	case v.N != nil:
+		return &types.AttributeValueMemberN{Value: *v.N}, nil
+	case v.B != nil:
+		return &types.AttributeValueMemberB{Value: v.B}, nil
+	case v.BOOL != nil:
+		return &types.AttributeValueMemberBOOL{Value: *v.BOOL}, nil
+	case v.NULL != nil:
+		return &types.AttributeValueMemberNULL{Value: *v.NULL}, nil
+	case v.SS != nil:
+		return &types.AttributeValueMemberSS{Value: v.SS}, nil
+	case v.NS != nil:
+		return &types.AttributeValueMemberNS{Value: v.NS}, nil
+	case v.BS != nil:
+		return &types.AttributeValueMemberBS{Value: v.BS}, nil
+	case v.L != nil:
+		list := make([]types.AttributeValue, len(v.L))
+		for i, item := range v.L {
+			av, err := decodeAttributeValue(item)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = av
+		}
+		return &types.AttributeValueMemberL{Value: list}, nil
+	case v.M != nil:
+		m, err := decodeMap(v.M)
+		if err != nil {
+			return nil, err
+		}
+		return &types.AttributeValueMemberM{Value: m}, nil
+	}
+	return nil, fmt.Errorf("unsupported attribute value %s", b)
+}
@@ -0,0 +1,257 @@
+package streams
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+)
+
+// StreamsAPI is the part of the DynamoDB Streams client used by a Poller. *dynamodbstreams.Client implements it.
+type StreamsAPI interface {
+	ListStreams(ctx context.Context, params *dynamodbstreams.ListStreamsInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.ListStreamsOutput, error)
+	DescribeStream(ctx context.Context, params *dynamodbstreams.DescribeStreamInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.DescribeStreamOutput, error)
+	GetShardIterator(ctx context.Context, params *dynamodbstreams.GetShardIteratorInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetShardIteratorOutput, error)
+	GetRecords(ctx context.Context, params *dynamodbstreams.GetRecordsInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetRecordsOutput, error)
+}
+
+// LatestStreamARN returns the ARN of the current stream of table.
+func LatestStreamARN(ctx context.Context, client StreamsAPI, table string) (string, error) {
+	out, err := client.ListStreams(ctx, &dynamodbstreams.ListStreamsInput{TableName: aws.String(table)})
+	if err != nil {
+		return "", fmt.Errorf("failed to list streams of %s: %w", table, err)
+	}
+	if len(out.Streams) == 0 {
+		return "", fmt.Errorf("table %s has no stream", table)
+	}
+	// streams are listed oldest first
+	return aws.ToString(out.Streams[len(out.Streams)-1].StreamArn), nil
+}
+
+// Poller reads a stream directly and hands its records to a Consumer, for running consumers locally against
+// DynamoDB Local, or anywhere Lambda is not used. Positions are kept in memory, so a new Poller starts again from
+// IteratorType. Shards are read after their parent shard is finished, so the records of an item stay in order.
+type Poller struct {
+	client    StreamsAPI
+	consumer  *Consumer
+	streamARN string
+	shards    map[string]*shardPosition
+	// IteratorType is where shards are first read from. Defaults to TRIM_HORIZON, the oldest record in the stream.
+	IteratorType types.ShardIteratorType
+	// Limit is the most records read from a shard at a time. Defaults to 100.
+	Limit int32
+	// Interval is how long Run waits after a poll that found no records. Defaults to one second.
+	Interval time.Duration
+}
+
+// shardPosition is how far a shard has been read.
+type shardPosition struct {
+	parent   string
+	iterator *string
+	// after is the sequence number of the last processed record
+	after string
+	// retry is the sequence number of a failed record, to be read again
+	retry  string
+	closed bool
+}
+
+// NewPoller returns a poller handing the records of the stream to consumer.
+func NewPoller(client StreamsAPI, streamARN string, consumer *Consumer) *Poller {
+	return &Poller{
+		client:       client,
+		consumer:     consumer,
+		streamARN:    streamARN,
+		shards:       make(map[string]*shardPosition),
+		IteratorType: types.ShardIteratorTypeTrimHorizon,
+		Limit:        100,
+		Interval:     time.Second,
+	}
+}
+
+// Run polls the stream until ctx is done, and returns ctx.Err(). Failed polls are logged, and failed records are
+// read again on the next poll.
+func (p *Poller) Run(ctx context.Context) error {
+	for {
+		n, err := p.Poll(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("failed to poll stream %s: %v", p.streamARN, err)
+		}
+		if n > 0 && err == nil {
+			continue
+		}
+
+		timer := time.NewTimer(p.Interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Poll reads the next records of every open shard once, hands them to the consumer and returns the number
+// processed. A shard whose records fail is read from the failed record on the next poll.
+func (p *Poller) Poll(ctx context.Context) (int, error) {
+	table, err := p.describe(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	processed := 0
+	var errs []error
+	for id, shard := range p.shards {
+		if shard.closed {
+			continue
+		}
+		if parent, ok := p.shards[shard.parent]; ok && !parent.closed {
+			continue
+		}
+
+		n, err := p.pollShard(ctx, table, id, shard)
+		processed += n
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return processed, errors.Join(errs...)
+}
+
+// describe adds the shards of the stream that are not known yet, and returns the stream's table.
+func (p *Poller) describe(ctx context.Context) (string, error) {
+	input := &dynamodbstreams.DescribeStreamInput{StreamArn: aws.String(p.streamARN)}
+	var table string
+	for {
+		out, err := p.client.DescribeStream(ctx, input)
+		if err != nil {
+			return "", fmt.Errorf("failed to describe stream %s: %w", p.streamARN, err)
+		}
+		table = aws.ToString(out.StreamDescription.TableName)
+
+		for _, s := range out.StreamDescription.Shards {
+			id := aws.ToString(s.ShardId)
+			if _, ok := p.shards[id]; !ok {
+				p.shards[id] = &shardPosition{parent: aws.ToString(s.ParentShardId)}
+			}
+		}
+
+		if out.StreamDescription.LastEvaluatedShardId == nil {
+			return table, nil
+		}
+		input.ExclusiveStartShardId = out.StreamDescription.LastEvaluatedShardId
+	}
+}
+
+// pollShard reads and processes the next records of a shard.
+func (p *Poller) pollShard(ctx context.Context, table, id string, shard *shardPosition) (int, error) {
+	if shard.iterator == nil {
+		input := &dynamodbstreams.GetShardIteratorInput{
+			StreamArn:         aws.String(p.streamARN),
+			ShardId:           aws.String(id),
+			ShardIteratorType: p.IteratorType,
+		}
+		switch {
+		case shard.retry != "":
+			input.ShardIteratorType = types.ShardIteratorTypeAtSequenceNumber
+			input.SequenceNumber = aws.String(shard.retry)
+		case shard.after != "":
+			input.ShardIteratorType = types.ShardIteratorTypeAfterSequenceNumber
+			input.SequenceNumber = aws.String(shard.after)
+		}
+
+		out, err := p.client.GetShardIterator(ctx, input)
+		var trimmed *types.TrimmedDataAccessException
+		if errors.As(err, &trimmed) {
+			// the records after our position have expired from the stream, so carry on from the oldest left
+			shard.retry, shard.after = "", ""
+			input.ShardIteratorType, input.SequenceNumber = types.ShardIteratorTypeTrimHorizon, nil
+			out, err = p.client.GetShardIterator(ctx, input)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to get iterator for shard %s: %w", id, err)
+		}
+		if out.ShardIterator == nil {
+			shard.closed = true
+			return 0, nil
+		}
+		shard.iterator = out.ShardIterator
+	}
+
+	out, err := p.client.GetRecords(ctx, &dynamodbstreams.GetRecordsInput{ShardIterator: shard.iterator, Limit: aws.Int32(p.Limit)})
+	var expired *types.ExpiredIteratorException
+	if errors.As(err, &expired) {
+		// get a new iterator from the same position next time
+		shard.iterator = nil
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get records of shard %s: %w", id, err)
+	}
+
+	records := make([]Record, len(out.Records))
+	for i, r := range out.Records {
+		if records[i], err = streamRecord(table, r); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := p.consumer.Process(ctx, records)
+	if n > 0 {
+		shard.after = records[n-1].SequenceNumber
+	}
+	if err != nil {
+		shard.retry = records[n].SequenceNumber
+		shard.iterator = nil
+		return n, err
+	}
+
+	shard.retry = ""
+	shard.iterator = out.NextShardIterator
+	// a shard without a next iterator has been closed and fully read
+	shard.closed = out.NextShardIterator == nil
+	return n, nil
+}
+
+// streamRecord converts a record read from the stream to a Record.
+func streamRecord(table string, r types.Record) (Record, error) {
+	record := Record{
+		EventID:   aws.ToString(r.EventID),
+		EventName: string(r.EventName),
+		Table:     table,
+		Expired:   r.UserIdentity != nil && aws.ToString(r.UserIdentity.PrincipalId) == ttlPrincipal,
+	}
+	if r.Dynamodb == nil {
+		return record, nil
+	}
+
+	record.SequenceNumber = aws.ToString(r.Dynamodb.SequenceNumber)
+	if r.Dynamodb.ApproximateCreationDateTime != nil {
+		record.Created = r.Dynamodb.ApproximateCreationDateTime.UTC()
+	}
+
+	var err error
+	if record.Keys, err = convertImage(r.Dynamodb.Keys); err != nil {
+		return record, fmt.Errorf("failed to convert keys of record %s: %w", record.EventID, err)
+	}
+	if record.OldImage, err = convertImage(r.Dynamodb.OldImage); err != nil {
+		return record, fmt.Errorf("failed to convert old image of record %s: %w", record.EventID, err)
+	}
+	if record.NewImage, err = convertImage(r.Dynamodb.NewImage); err != nil {
+		return record, fmt.Errorf("failed to convert new image of record %s: %w", record.EventID, err)
+	}
+	return record, nil
+}
+
+// convertImage converts an image from the stream types to the DynamoDB types, keeping a missing image nil.
+func convertImage(image map[string]types.AttributeValue) (Image, error) {
+	if image == nil {
+		return nil, nil
+	}
+	return attributevalue.FromDynamoDBStreamsMap(image)
+}
@@ -0,0 +1,167 @@
+// Package streams consumes DynamoDB Streams. A Consumer routes the INSERT, MODIFY and REMOVE records of each table
+// to the handlers registered for it, decoding the old and new images into models types. Records are delivered by
+// Lambda through an event source mapping (HandleLambda), or read from the stream directly by a Poller, which is
+// useful against DynamoDB Local:
+//
+//	consumer := streams.NewConsumer()
+//	streams.Handle(consumer, "trainees", func(ctx context.Context, c streams.Change[models.Trainee]) error {
+//		if c.EventName == streams.Modify && !c.Old.CheckedIn && c.New.CheckedIn {
+//			// the trainee checked in
+//		}
+//		return nil
+//	})
+//	lambda.Start(consumer.HandleLambda)
+package streams
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Names of the events in a stream.
+const (
+	Insert = "INSERT"
+	Modify = "MODIFY"
+	Remove = "REMOVE"
+)
+
+// AllTables registers a handler for the records of every table.
+const AllTables = "*"
+
+// LastModifiedID is the id of the item the dynamodb repositories keep in each table to record when it last
+// changed. It is not a model, so the Consumer skips its records.
+const LastModifiedID = "_last_modified"
+
+// Record is a change to a single item. The images are nil when the stream view type does not include them: OldImage
+// is only set for MODIFY and REMOVE records, and NewImage for INSERT and MODIFY records.
+type Record struct {
+	EventID        string
+	EventName      string
+	Table          string
+	SequenceNumber string
+	Keys           map[string]types.AttributeValue
+	OldImage       map[string]types.AttributeValue
+	NewImage       map[string]types.AttributeValue
+	// Created is the approximate time the change was made
+	Created time.Time
+	// Expired reports whether DynamoDB removed the item because its TTL passed
+	Expired bool
+}
+
+// Change is a record with its images decoded into T.
+type Change[T any] struct {
+	Record
+	Old *T
+	New *T
+}
+
+// RecordHandler handles a single record.
+type RecordHandler func(ctx context.Context, r Record) error
+
+// Consumer routes stream records to the handlers registered for their table.
+type Consumer struct {
+	handlers map[string][]RecordHandler
+	// ReportBatchItemFailures makes HandleLambda report a failed record in its response rather than returning an
+	// error. Only set it if the event source mapping has ReportBatchItemFailures turned on, or Lambda treats the
+	// batch as processed and the failed records are lost.
+	ReportBatchItemFailures bool
+}
+
+// NewConsumer returns a consumer without any handlers.
+func NewConsumer() *Consumer {
+	return &Consumer{handlers: make(map[string][]RecordHandler)}
+}
+
+// HandleFunc calls h with every record of table, or of every table if table is AllTables.
+func (c *Consumer) HandleFunc(table string, h RecordHandler) {
+	c.handlers[table] = append(c.handlers[table], h)
+}
+
+// Handle calls h with every record of table, with the images decoded into T.
+func Handle[T any](c *Consumer, table string, h func(ctx context.Context, change Change[T]) error) {
+	c.HandleFunc(table, func(ctx context.Context, r Record) error {
+		change := Change[T]{Record: r}
+		var err error
+		if change.Old, err = decodeImage[T](r.OldImage); err != nil {
+			return fmt.Errorf("failed to decode old image of %s record %s: %w", r.Table, r.EventID, err)
+		}
+		if change.New, err = decodeImage[T](r.NewImage); err != nil {
+			return fmt.Errorf("failed to decode new image of %s record %s: %w", r.Table, r.EventID, err)
+		}
+		return h(ctx, change)
+	})
+}
+
+// Process hands the records to their handlers in order, and stops at the first record a handler fails. It returns
+// the number of records processed before it, so the caller can retry from the failed record; records are
+// delivered at least once, and handlers should expect to see a record again. Records of the LastModifiedID item
+// are skipped.
+func (c *Consumer) Process(ctx context.Context, records []Record) (int, error) {
+	for i, r := range records {
+		if err := ctx.Err(); err != nil {
+			return i, err
+		}
+		if r.marker() {
+			continue
+		}
+		for _, h := range c.handlers[r.Table] {
+			if err := h(ctx, r); err != nil {
+				return i, fmt.Errorf("failed to handle %s record %s of %s: %w", r.EventName, r.EventID, r.Table, err)
+			}
+		}
+		for _, h := range c.handlers[AllTables] {
+			if err := h(ctx, r); err != nil {
+				return i, fmt.Errorf("failed to handle %s record %s of %s: %w", r.EventName, r.EventID, r.Table, err)
+			}
+		}
+	}
+	return len(records), nil
+}
+
+// marker reports whether r is a change to the LastModifiedID item. Keys are always set by DynamoDB, but the images
+// are checked too for records built without them.
+func (r Record) marker() bool {
+	for _, image := range []map[string]types.AttributeValue{r.Keys, r.NewImage, r.OldImage} {
+		if id, ok := image["id"].(*types.AttributeValueMemberS); ok {
+			return id.Value == LastModifiedID
+		}
+	}
+	return false
+}
+
+// decodeImage unmarshals image into a new T, or returns nil if there is no image. The repositories put whole items
+// under their field names, but update single attributes under their JSON names (checked_in, last_training), so
+// an item can hold both, and a stale field name beside an updated JSON name. The image is read with both, and the
+// JSON names win, as the trainee repository reads items.
+func decodeImage[T any](image map[string]types.AttributeValue) (*T, error) {
+	if image == nil {
+		return nil, nil
+	}
+	v := new(T)
+	if err := attributevalue.UnmarshalMap(image, v); err != nil {
+		return nil, err
+	}
+	err := attributevalue.UnmarshalMapWithOptions(image, v, func(o *attributevalue.DecoderOptions) {
+		o.TagKey = "json"
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// tableFromARN returns the table name in a table or stream ARN, such as
+// "arn:aws:dynamodb:us-east-1:123456789012:table/trainees/stream/2025-01-01T00:00:00.000".
+func tableFromARN(arn string) string {
+	_, resource, ok := strings.Cut(arn, ":table/")
+	if !ok {
+		return ""
+	}
+	table, _, _ := strings.Cut(resource, "/")
+	return table
+}
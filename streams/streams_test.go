@@ -0,0 +1,297 @@
+package streams
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/babykittenz/api-micro-util/models"
+)
+
+// lambdaPayload is a batch as Lambda delivers it, with records of two tables. The trainee images are what the
+// repository writes: Save puts the field names, and Checkin then sets checked_in beside the stale CheckedIn.
+const lambdaPayload = `{"Records": [
+	{"eventID": "1", "eventName": "INSERT", "eventSource": "aws:dynamodb",
+	 "eventSourceARN": "arn:aws:dynamodb:us-east-1:123456789012:table/trainees/stream/2025-01-01T00:00:00.000",
+	 "dynamodb": {"ApproximateCreationDateTime": 1735689600, "Keys": {"id": {"S": "t1"}},
+	  "NewImage": {"id": {"S": "t1"}, "FirstName": {"S": "Jane"}, "CheckedIn": {"BOOL": false}},
+	  "SequenceNumber": "100", "StreamViewType": "NEW_AND_OLD_IMAGES"}},
+	{"eventID": "2", "eventName": "MODIFY", "eventSource": "aws:dynamodb",
+	 "eventSourceARN": "arn:aws:dynamodb:us-east-1:123456789012:table/trainees/stream/2025-01-01T00:00:00.000",
+	 "dynamodb": {"Keys": {"id": {"S": "t1"}},
+	  "OldImage": {"id": {"S": "t1"}, "FirstName": {"S": "Jane"}, "CheckedIn": {"BOOL": false}},
+	  "NewImage": {"id": {"S": "t1"}, "FirstName": {"S": "Jane"}, "CheckedIn": {"BOOL": false}, "checked_in": {"BOOL": true}},
+	  "SequenceNumber": "200", "StreamViewType": "NEW_AND_OLD_IMAGES"}},
+	{"eventID": "3", "eventName": "REMOVE", "eventSource": "aws:dynamodb",
+	 "eventSourceARN": "arn:aws:dynamodb:us-east-1:123456789012:table/trainees/stream/2025-01-01T00:00:00.000",
+	 "userIdentity": {"type": "Service", "principalId": "dynamodb.amazonaws.com"},
+	 "dynamodb": {"Keys": {"id": {"S": "t1"}},
+	  "OldImage": {"id": {"S": "t1"}, "FirstName": {"S": "Jane"}, "CheckedIn": {"BOOL": false}, "checked_in": {"BOOL": true}},
+	  "SequenceNumber": "300", "StreamViewType": "NEW_AND_OLD_IMAGES"}},
+	{"eventID": "4", "eventName": "INSERT", "eventSource": "aws:dynamodb",
+	 "eventSourceARN": "arn:aws:dynamodb:us-east-1:123456789012:table/locations/stream/2025-01-01T00:00:00.000",
+	 "dynamodb": {"Keys": {"id": {"S": "l1"}},
+	  "NewImage": {"id": {"S": "l1"}, "Languages": {"L": [{"S": "en"}, {"S": "es"}]},
+	   "Extra": {"M": {"size": {"N": "3"}, "logo": {"B": "aGk="}, "tags": {"SS": ["a"]}, "gone": {"NULL": true}}}},
+	  "SequenceNumber": "400", "StreamViewType": "NEW_AND_OLD_IMAGES"}}
+]}`
+
+// TestConsumer_HandleLambda verifies records are routed by table and decoded into models.
+func TestConsumer_HandleLambda(t *testing.T) {
+	var event LambdaEvent
+	if err := json.Unmarshal([]byte(lambdaPayload), &event); err != nil {
+		t.Fatal(err)
+	}
+
+	consumer := NewConsumer()
+	var changes []Change[models.Trainee]
+	Handle(consumer, "trainees", func(ctx context.Context, c Change[models.Trainee]) error {
+		changes = append(changes, c)
+		return nil
+	})
+	var all []Record
+	consumer.HandleFunc(AllTables, func(ctx context.Context, r Record) error {
+		all = append(all, r)
+		return nil
+	})
+
+	res, err := consumer.HandleLambda(context.Background(), event)
+	if err != nil || len(res.BatchItemFailures) != 0 {
+		t.Fatalf("expected the batch to succeed: %+v %v", res, err)
+	}
+	if len(changes) != 3 || len(all) != 4 {
+		t.Fatalf("expected 3 trainee changes and 4 records, recieved %d and %d", len(changes), len(all))
+	}
+
+	var tests = []struct {
+		name      string
+		eventName string
+		oldIn     *bool
+		newIn     *bool
+		expired   bool
+	}{
+		{"insert", Insert, nil, aws.Bool(false), false},
+		{"modify", Modify, aws.Bool(false), aws.Bool(true), false},
+		{"remove", Remove, aws.Bool(true), nil, true},
+	}
+
+	for i, e := range tests {
+		c := changes[i]
+		if c.EventName != e.eventName || c.Table != "trainees" || c.Expired != e.expired {
+			t.Errorf("%s: unexpected record %+v", e.name, c.Record)
+		}
+		if (c.Old == nil) != (e.oldIn == nil) || (c.Old != nil && c.Old.CheckedIn != *e.oldIn) {
+			t.Errorf("%s: unexpected old image %+v", e.name, c.Old)
+		}
+		if (c.New == nil) != (e.newIn == nil) || (c.New != nil && (c.New.CheckedIn != *e.newIn || c.New.FirstName != "Jane")) {
+			t.Errorf("%s: unexpected new image %+v", e.name, c.New)
+		}
+	}
+	if !changes[0].Created.Equal(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the creation time, recieved %s", changes[0].Created)
+	}
+
+	extra := all[3].NewImage["Extra"].(*ddbtypes.AttributeValueMemberM).Value
+	if string(extra["logo"].(*ddbtypes.AttributeValueMemberB).Value) != "hi" || extra["size"].(*ddbtypes.AttributeValueMemberN).Value != "3" {
+		t.Errorf("unexpected map attribute %+v", extra)
+	}
+}
+
+// TestConsumer_ProcessMarker verifies the records of the last modified marker are not handed to handlers, and
+// still count as processed.
+func TestConsumer_ProcessMarker(t *testing.T) {
+	consumer := NewConsumer()
+	var changes []Change[models.Trainee]
+	Handle(consumer, "trainees", func(ctx context.Context, c Change[models.Trainee]) error {
+		changes = append(changes, c)
+		return nil
+	})
+	handled := 0
+	consumer.HandleFunc(AllTables, func(ctx context.Context, r Record) error {
+		handled++
+		return nil
+	})
+
+	marker := map[string]ddbtypes.AttributeValue{"id": &ddbtypes.AttributeValueMemberS{Value: LastModifiedID}}
+	modified := map[string]ddbtypes.AttributeValue{
+		"id":       &ddbtypes.AttributeValueMemberS{Value: LastModifiedID},
+		"modified": &ddbtypes.AttributeValueMemberN{Value: "1735689600000"},
+	}
+	trainee := map[string]ddbtypes.AttributeValue{
+		"id":        &ddbtypes.AttributeValueMemberS{Value: "t1"},
+		"FirstName": &ddbtypes.AttributeValueMemberS{Value: "Jane"},
+	}
+	records := []Record{
+		{EventID: "1", EventName: Insert, Table: "trainees", Keys: map[string]ddbtypes.AttributeValue{"id": trainee["id"]}, NewImage: trainee},
+		{EventID: "2", EventName: Modify, Table: "trainees", Keys: marker, OldImage: modified, NewImage: modified},
+		{EventID: "3", EventName: Insert, Table: "trainees", NewImage: modified},
+	}
+
+	n, err := consumer.Process(context.Background(), records)
+	if err != nil || n != len(records) {
+		t.Fatalf("expected every record to be processed, recieved %d %v", n, err)
+	}
+	if len(changes) != 1 || changes[0].New.FirstName != "Jane" || handled != 1 {
+		t.Errorf("expected only the trainee record to be handled, recieved %d changes and %d records", len(changes), handled)
+	}
+}
+
+// TestConsumer_HandleLambdaFailure verifies a failed record is reported to Lambda, or fails the batch.
+func TestConsumer_HandleLambdaFailure(t *testing.T) {
+	var event LambdaEvent
+	if err := json.Unmarshal([]byte(lambdaPayload), &event); err != nil {
+		t.Fatal(err)
+	}
+
+	consumer := NewConsumer()
+	var handled []string
+	consumer.HandleFunc("trainees", func(ctx context.Context, r Record) error {
+		if r.EventName == Modify {
+			return errors.New("notifications are down")
+		}
+		handled = append(handled, r.EventID)
+		return nil
+	})
+
+	if _, err := consumer.HandleLambda(context.Background(), event); err == nil {
+		t.Error("expected the batch to fail without batch item failures")
+	}
+
+	handled = nil
+	consumer.ReportBatchItemFailures = true
+	res, err := consumer.HandleLambda(context.Background(), event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.BatchItemFailures) != 1 || res.BatchItemFailures[0].ItemIdentifier != "200" {
+		t.Errorf("expected record 200 to be reported, recieved %+v", res)
+	}
+	if !reflect.DeepEqual(handled, []string{"1"}) {
+		t.Errorf("expected processing to stop at the failed record, recieved %v", handled)
+	}
+}
+
+// fakeStream is a stream with a closed parent shard and an open child shard.
+type fakeStream struct {
+	shards    map[string][]types.Record
+	parents   map[string]string
+	closed    map[string]bool
+	iterators []string
+}
+
+// ListStreams returns an old stream and the current one.
+func (s *fakeStream) ListStreams(ctx context.Context, params *dynamodbstreams.ListStreamsInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.ListStreamsOutput, error) {
+	return &dynamodbstreams.ListStreamsOutput{Streams: []types.Stream{{StreamArn: aws.String("old")}, {StreamArn: aws.String("arn:stream")}}}, nil
+}
+
+// DescribeStream returns the child shard first, to check the parent is still read first.
+func (s *fakeStream) DescribeStream(ctx context.Context, params *dynamodbstreams.DescribeStreamInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.DescribeStreamOutput, error) {
+	var shards []types.Shard
+	for _, id := range []string{"child", "parent"} {
+		shards = append(shards, types.Shard{ShardId: aws.String(id), ParentShardId: aws.String(s.parents[id])})
+	}
+	return &dynamodbstreams.DescribeStreamOutput{StreamDescription: &types.StreamDescription{TableName: aws.String("trainees"), Shards: shards}}, nil
+}
+
+// GetShardIterator encodes the shard and the index of the next record in the iterator.
+func (s *fakeStream) GetShardIterator(ctx context.Context, params *dynamodbstreams.GetShardIteratorInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetShardIteratorOutput, error) {
+	id := aws.ToString(params.ShardId)
+	s.iterators = append(s.iterators, fmt.Sprintf("%s %s %s", id, params.ShardIteratorType, aws.ToString(params.SequenceNumber)))
+
+	next := 0
+	for i, r := range s.shards[id] {
+		seq := aws.ToString(r.Dynamodb.SequenceNumber)
+		if params.ShardIteratorType == types.ShardIteratorTypeAtSequenceNumber && seq == *params.SequenceNumber {
+			next = i
+		}
+		if params.ShardIteratorType == types.ShardIteratorTypeAfterSequenceNumber && seq == *params.SequenceNumber {
+			next = i + 1
+		}
+	}
+	return &dynamodbstreams.GetShardIteratorOutput{ShardIterator: aws.String(fmt.Sprintf("%s/%d", id, next))}, nil
+}
+
+// GetRecords returns up to two records from the iterator's position.
+func (s *fakeStream) GetRecords(ctx context.Context, params *dynamodbstreams.GetRecordsInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetRecordsOutput, error) {
+	id, position, _ := strings.Cut(*params.ShardIterator, "/")
+	next, _ := strconv.Atoi(position)
+
+	records := s.shards[id][next:min(next+2, len(s.shards[id]))]
+	out := &dynamodbstreams.GetRecordsOutput{Records: records}
+	if end := next + len(records); end < len(s.shards[id]) || !s.closed[id] {
+		out.NextShardIterator = aws.String(fmt.Sprintf("%s/%d", id, end))
+	}
+	return out, nil
+}
+
+// streamInsert returns an INSERT record of a trainee.
+func streamInsert(seq, id string) types.Record {
+	return types.Record{
+		EventID:   aws.String(seq),
+		EventName: types.OperationTypeInsert,
+		Dynamodb: &types.StreamRecord{
+			SequenceNumber: aws.String(seq),
+			Keys:           map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: id}},
+			NewImage: map[string]types.AttributeValue{
+				"id":        &types.AttributeValueMemberS{Value: id},
+				"FirstName": &types.AttributeValueMemberS{Value: "Jane"},
+			},
+		},
+	}
+}
+
+// TestPoller verifies records are read parent shard first, in order, and a failed record is read again.
+func TestPoller(t *testing.T) {
+	stream := &fakeStream{
+		shards: map[string][]types.Record{
+			"parent": {streamInsert("1", "t1"), streamInsert("2", "t2"), streamInsert("3", "t3")},
+			"child":  {streamInsert("4", "t4")},
+		},
+		parents: map[string]string{"child": "parent"},
+		closed:  map[string]bool{"parent": true},
+	}
+	arn, err := LatestStreamARN(context.Background(), stream, "trainees")
+	if err != nil || arn != "arn:stream" {
+		t.Fatalf("expected the latest stream, recieved %q %v", arn, err)
+	}
+
+	consumer := NewConsumer()
+	var seen []string
+	failures := 1
+	Handle(consumer, "trainees", func(ctx context.Context, c Change[models.Trainee]) error {
+		if c.New.ID == "t2" && failures > 0 {
+			failures--
+			return errors.New("analytics is down")
+		}
+		seen = append(seen, c.New.ID)
+		return nil
+	})
+
+	poller := NewPoller(stream, arn, consumer)
+	ctx := context.Background()
+	if n, err := poller.Poll(ctx); err == nil || n != 1 {
+		t.Errorf("expected the first poll to fail after 1 record, recieved %d %v", n, err)
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := poller.Poll(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !reflect.DeepEqual(seen, []string{"t1", "t2", "t3", "t4"}) {
+		t.Errorf("expected every record once in order, recieved %v", seen)
+	}
+	if stream.iterators[1] != "parent AT_SEQUENCE_NUMBER 2" {
+		t.Errorf("expected the failed record to be read again, recieved iterators %v", stream.iterators)
+	}
+}
@@ -4,14 +4,18 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/config"
 	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/babykittenz/api-micro-util/models"
+	"github.com/babykittenz/api-micro-util/scan"
+	"github.com/babykittenz/api-micro-util/storage"
 	"io"
-	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
@@ -29,6 +33,27 @@ type Tools struct {
 	AllowedFileTypes   []string
 	MaxJSONSize        int
 	AllowUnknownFields bool
+	// ProblemJSON makes ErrorJSON send RFC 7807 application/problem+json documents instead of JSONResponse
+	ProblemJSON bool
+	// ProblemTypeBaseURI, if set, is used to build the problem type URI from the slugified title
+	ProblemTypeBaseURI string
+	// Encoders adds to or replaces the content encodings StreamJSON can negotiate, keyed by name (e.g. "br")
+	Encoders map[string]EncoderFunc
+	// FileStore is where UploadFiles saves files and DownloadStaticFile reads them. It defaults to the local disk
+	FileStore storage.FileStore
+	// MaxUploadSize caps the combined size of all files in one UploadFiles request. Zero means no total limit
+	MaxUploadSize int64
+	// UploadPolicies restricts the files UploadFiles accepts, keyed by form field name. Fields without a policy
+	// use AllowedFileTypes and MaxFileSize
+	UploadPolicies map[string]UploadPolicy
+	// ContentAddressed makes renamed uploads use the SHA-256 of their content as the file name instead of a
+	// random string, so a file that is uploaded again is detected and not stored twice
+	ContentAddressed bool
+	// UploadMD5 computes an MD5 digest of each uploaded file as well as the SHA-256
+	UploadMD5 bool
+	// Scanners check every uploaded file before the upload is committed. A file a scanner rejects fails the upload
+	// with a models.CodeUnsafe field error, and a scanner that cannot scan fails it with that error
+	Scanners []scan.Scanner
 }
 
 // RandomString returns a string of random characters of length n, using randomStringSource
@@ -43,11 +68,41 @@ func (t *Tools) RandomString(length int) string {
 	return string(s)
 }
 
+// RandomToken returns n bytes from crypto/rand encoded as unpadded base64url. Unlike RandomString, every character
+// is uniformly random, so it is suitable for secrets such as bearer tokens and signing keys.
+func (t *Tools) RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
 // UploadedFile is a struct used to save information about an uploaded file
 type UploadedFile struct {
 	NewFileName      string
 	OriginalFileName string
 	FileSize         int64
+	// FieldName is the form field the file was uploaded in
+	FieldName string
+	// Renditions lists the resized copies stored beside the file, if its UploadPolicy has an image pipeline
+	Renditions []*UploadedRendition
+	// SHA256 is the hex encoded SHA-256 digest of the stored file
+	SHA256 string
+	// MD5 is the hex encoded MD5 digest of the stored file, if Tools.UploadMD5 is set. It matches the ETag S3
+	// returns for a single part upload
+	MD5 string
+	// Duplicate is set when the file was already stored under its content addressed name, so it was not stored again
+	Duplicate bool
+}
+
+// UploadedRendition is a resized copy of an uploaded image
+type UploadedRendition struct {
+	Name        string
+	NewFileName string
+	Width       int
+	Height      int
+	FileSize    int64
 }
 
 // UploadOneFile uploads a single file from an HTTP request, saves it to the specified directory, and returns its information.
@@ -63,7 +118,18 @@ func (t *Tools) UploadOneFile(r *http.Request, uploadDir string, rename ...bool)
 	return files[0], nil
 }
 
-// UploadFiles processes and saves uploaded files from an HTTP request to the specified directory.
+// UploadFiles streams uploaded files from a multipart HTTP request into the specified directory of t.FileStore.
+// Parts are read one at a time with a multipart.Reader, so nothing is buffered to temporary files, and uploads
+// are rejected as soon as a file passes MaxFileSize or all files pass MaxUploadSize. The content type is sniffed
+// from the first 512 bytes of each file. Other form fields are kept in r.Form and r.PostForm.
+// Files in a field with an UploadPolicy that break it are skipped, and every violation is returned together
+// as models.ValidationErrors keyed by field name, except a file that is too large, which stops the upload.
+// Uploads are all or nothing: files are staged next to their destination and only moved into place once every
+// file has passed, so on any error, including the request being cancelled, no files are kept and none are returned.
+// Staged files are checked by t.Scanners before they are committed.
+// If the form was already parsed, e.g. by calling r.FormValue or r.ParseMultipartForm first, the request body has
+// been read, so the files are taken from r.MultipartForm instead. ParseMultipartForm holds them in memory or in
+// temporary files, so call UploadFiles before reading any form values to keep large uploads off the disk.
 // It optionally renames files with a random filename if `rename` is set to true.
 // Returns a slice of uploaded file information or an error if the operation fails.
 func (t *Tools) UploadFiles(r *http.Request, uploadDir string, rename ...bool) ([]*UploadedFile, error) {
@@ -71,105 +137,191 @@ func (t *Tools) UploadFiles(r *http.Request, uploadDir string, rename ...bool) (
 	if len(rename) > 0 {
 		renameFile = rename[0]
 	}
-	var uploadedFiles []*UploadedFile
 
 	if t.MaxFileSize == 0 {
 		t.MaxFileSize = 1024 * 1024 * 1024 // about a gig
 	}
 
-	err := t.CreateDirIfNotExist(uploadDir)
-	if err != nil {
-		return nil, err
+	tx := &uploadTx{store: t.fileStore(), id: t.RandomString(12)}
+
+	var parts partReader
+	parsed := r.MultipartForm != nil
+	if parsed {
+		parts = parsedParts(r.MultipartForm)
+	} else {
+		reader, err := r.MultipartReader()
+		if err != nil {
+			return nil, err
+		}
+		parts = streamedParts(reader)
 	}
 
-	err = r.ParseMultipartForm(int64(t.MaxFileSize))
+	uploadedFiles, err := t.stageUploads(r, parts, parsed, tx, uploadDir, renameFile)
+	if err == nil {
+		err = t.scanStaged(r.Context(), tx)
+	}
 	if err != nil {
-		return nil, errors.New("the uploaded file is too large")
-	}
-
-	for _, fHeaders := range r.MultipartForm.File {
-		for _, hdr := range fHeaders {
-			uploadedFiles, err = func(uploadedFiles []*UploadedFile) ([]*UploadedFile, error) {
-				var uploadedFile UploadedFile
-				// open the file
-				infile, err := hdr.Open()
-				// check for error
-				if err != nil {
-					return nil, err
-				}
-				// we have an infile we need to close to prevent resource leak
-				defer func(infile multipart.File) {
-					err := infile.Close()
-					if err != nil {
-
-					}
-				}(infile)
-
-				// check the first 512 bytes
-				buff := make([]byte, 512)
-				_, err = infile.Read(buff)
-				if err != nil {
-					return nil, err
-				}
+		tx.rollback()
+		return nil, err
+	}
+	if err := tx.commit(r.Context()); err != nil {
+		return nil, err
+	}
+	return uploadedFiles, nil
+}
 
-				// TODO: check to see if the file type is permitted
-				allowed := false
-				fileType := http.DetectContentType(buff)
-
-				if len(t.AllowedFileTypes) > 0 {
-					for _, allowedType := range t.AllowedFileTypes {
-						if strings.EqualFold(fileType, allowedType) {
-							allowed = true
-							break
-						}
-					}
-				} else {
-					// in the hands of the user to not allow all file types
-					allowed = true
-				}
+// stageUploads reads every part of an upload, staging the files in tx and keeping the other form fields, which a
+// parsed form already holds.
+func (t *Tools) stageUploads(r *http.Request, parts partReader, parsed bool, tx *uploadTx, uploadDir string, renameFile bool) ([]*UploadedFile, error) {
+	var uploadedFiles []*UploadedFile
 
-				if !allowed {
-					return nil, errors.New("file type not allowed")
-				}
+	values := make(url.Values)
+	upload := &uploadLimits{total: t.MaxUploadSize}
+	counts := make(map[string]int)
+	var violations models.ValidationErrors
+	for {
+		if err := r.Context().Err(); err != nil {
+			return nil, err
+		}
 
-				_, err = infile.Seek(0, 0)
-				if err != nil {
-					return nil, err
-				}
+		part, err := parts()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return uploadedFiles, fmt.Errorf("failed to read multipart upload: %w", err)
+		}
 
-				if renameFile {
-					uploadedFile.NewFileName = fmt.Sprintf("%s%s", t.RandomString(25), filepath.Ext(hdr.Filename))
-				} else {
-					uploadedFile.NewFileName = hdr.Filename
-				}
+		if part.FileName() == "" {
+			err = readFormValue(part, values, upload)
+			_ = part.Close()
+			if err != nil {
+				return uploadedFiles, err
+			}
+			continue
+		}
 
-				uploadedFile.OriginalFileName = hdr.Filename
-				var outfile *os.File
-				defer func(outfile *os.File) {
-					err := outfile.Close()
-					if err != nil {
-
-					}
-				}(outfile)
-
-				if outfile, err = os.Create(filepath.Join(uploadDir, uploadedFile.NewFileName)); err != nil {
-					return nil, err
-				} else {
-					fileSize, err := io.Copy(outfile, infile)
-					if err != nil {
-						return nil, err
-					}
-					uploadedFile.FileSize = fileSize
-				}
-				uploadedFiles = append(uploadedFiles, &uploadedFile)
-				return uploadedFiles, nil
-			}(uploadedFiles)
+		field := part.FormName()
+		policy, hasPolicy := t.uploadPolicy(field)
+		counts[field]++
+		if policy.MaxFiles > 0 && counts[field] > policy.MaxFiles {
+			violations.Add(field, models.CodeMax, fmt.Sprintf("must contain at most %d file(s)", policy.MaxFiles))
+			err = upload.skip(part)
+			_ = part.Close()
 			if err != nil {
 				return uploadedFiles, err
 			}
+			continue
+		}
+
+		uploadedFile, err := t.uploadPart(r.Context(), tx, part, uploadDir, renameFile, upload, policy)
+		if hasPolicy {
+			if fieldErr, ok := policyViolation(field, policy, err); ok {
+				violations = append(violations, fieldErr)
+				if errors.Is(err, ErrFileTooLarge) {
+					_ = part.Close()
+					return uploadedFiles, violations
+				}
+				err = upload.skip(part)
+			}
+		}
+		_ = part.Close()
+		if err != nil {
+			return uploadedFiles, err
+		}
+		if uploadedFile != nil {
+			uploadedFiles = append(uploadedFiles, uploadedFile)
 		}
 	}
-	return uploadedFiles, nil
+
+	if !parsed {
+		keepFormValues(r, values)
+	}
+	return uploadedFiles, violations.ErrOrNil()
+}
+
+// uploadPart checks the type and extension of a single file part against policy and streams it into tx.
+func (t *Tools) uploadPart(ctx context.Context, tx *uploadTx, part formPart, uploadDir string, renameFile bool, upload *uploadLimits, policy UploadPolicy) (*UploadedFile, error) {
+	var uploadedFile UploadedFile
+
+	// check the first 512 bytes
+	buff := make([]byte, 512)
+	n, err := io.ReadFull(part, buff)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	buff = buff[:n]
+
+	allowed := false
+	fileType := http.DetectContentType(buff)
+
+	if len(policy.AllowedTypes) > 0 {
+		for _, allowedType := range policy.AllowedTypes {
+			if strings.EqualFold(fileType, allowedType) {
+				allowed = true
+				break
+			}
+		}
+	} else {
+		// in the hands of the user to not allow all file types
+		allowed = true
+	}
+
+	if !allowed {
+		return nil, ErrFileTypeNotAllowed
+	}
+
+	if !policy.allowsExtension(part.FileName()) {
+		return nil, ErrFileExtensionNotAllowed
+	}
+
+	if renameFile {
+		// a content addressed name is only known once the file has been read, so it is renamed when staged
+		uploadedFile.NewFileName = fmt.Sprintf("%s%s", t.RandomString(25), filepath.Ext(part.FileName()))
+	} else {
+		uploadedFile.NewFileName = part.FileName()
+	}
+	uploadedFile.OriginalFileName = part.FileName()
+	uploadedFile.FieldName = part.FormName()
+
+	// put the sniffed bytes back in front of the rest of the part, and stop the copy once a limit is passed
+	body := upload.file(io.MultiReader(bytes.NewReader(buff), part), policy.MaxFileSize)
+	contentAddressed := renameFile && t.ContentAddressed
+	if policy.Images != nil && isProcessedImage(fileType) {
+		if err := storeImage(ctx, tx, policy.Images, uploadDir, &uploadedFile, body, contentAddressed, t.UploadMD5); err != nil {
+			return nil, err
+		}
+		return &uploadedFile, nil
+	}
+
+	hashes := newFileHashes(t.UploadMD5)
+	info, err := tx.put(ctx, path.Join(uploadDir, uploadedFile.NewFileName), io.TeeReader(body, hashes), fileType, &uploadedFile)
+	if err != nil {
+		if body.err != nil {
+			return nil, body.err
+		}
+		return nil, err
+	}
+	uploadedFile.FileSize = info.Size
+	uploadedFile.SHA256, uploadedFile.MD5 = hashes.sums()
+
+	if contentAddressed {
+		uploadedFile.NewFileName = uploadedFile.SHA256 + filepath.Ext(part.FileName())
+		uploadedFile.Duplicate, err = tx.relocate(ctx, path.Join(uploadDir, uploadedFile.NewFileName))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &uploadedFile, nil
+}
+
+// fileStore returns t.FileStore, or a store using paths on the local disk as given if none is configured.
+func (t *Tools) fileStore() storage.FileStore {
+	if t.FileStore == nil {
+		return storage.NewLocalStore("")
+	}
+	return t.FileStore
 }
 
 // CreateDirIfNotExist creates a directory at the specified path if it does not already exist, using permission mode 0755.
@@ -202,26 +354,26 @@ func (t *Tools) Slugify(s string) (string, error) {
 	return slug, nil
 }
 
-// DownloadStaticFile downloads a file, and tries to force the browser to avoid displaying it
+// DownloadStaticFile downloads a file from t.FileStore, and tries to force the browser to avoid displaying it
 // in the browser window by setting content disposition. It also allows specification of the
-// display name
+// display name. Use ServeFile to display files inline or set cache headers
 func (t *Tools) DownloadStaticFile(w http.ResponseWriter, r *http.Request, p, file, displayName string) {
-	fp := path.Join(p, file)
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", displayName))
-
-	http.ServeFile(w, r, fp)
+	t.ServeFile(w, r, path.Join(p, file), DownloadOptions{Name: displayName})
 }
 
 // JSONResponse represents a standard JSON response structure with error, message, and optional data fields.
+// Errors holds field level failures, so a front end can highlight the fields that need attention.
 type JSONResponse struct {
-	Error   bool        `json:"error"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data,omitempty"`
+	Error   bool                `json:"error"`
+	Message string              `json:"message"`
+	Data    interface{}         `json:"data,omitempty"`
+	Errors  []models.FieldError `json:"errors,omitempty"`
 }
 
 // ReadJSON reads JSON data from an HTTP request body into the provided data structure.
 // It ensures the body size does not exceed MaxJSONSize and validates for allowed fields.
 // Returns an error if the JSON format is invalid, too large, or contains unknown fields.
+// If data implements models.Validator it is validated after decoding, and any models.ValidationErrors are returned.
 func (t *Tools) ReadJSON(w http.ResponseWriter, r *http.Request, data interface{}) error {
 	maxBytes := 1024 * 1024 // about 1 meg
 	if t.MaxJSONSize != 0 {
@@ -246,15 +398,23 @@ func (t *Tools) ReadJSON(w http.ResponseWriter, r *http.Request, data interface{
 		case errors.Is(err, io.ErrUnexpectedEOF):
 			return errors.New("body contains badly-formed JSON")
 		case errors.As(err, &unmarshalTypeError):
-			if unmarshalTypeError.Value != "" {
-				return fmt.Errorf("body contains an incorrect JSON type for field %q ", unmarshalTypeError.Field)
+			if unmarshalTypeError.Field != "" {
+				return models.ValidationErrors{{
+					Field:   unmarshalTypeError.Field,
+					Code:    models.CodeType,
+					Message: fmt.Sprintf("body contains an incorrect JSON type for field %q, expected %s", unmarshalTypeError.Field, unmarshalTypeError.Type),
+				}}
 			}
 			return fmt.Errorf("body contains an incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
 		case errors.Is(err, io.EOF):
 			return errors.New("body must contain only one JSON object")
 		case strings.HasPrefix(err.Error(), "json: unknown field "):
 			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
-			return fmt.Errorf("body contains unknown key %s", fieldName)
+			return models.ValidationErrors{{
+				Field:   strings.Trim(fieldName, `"`),
+				Code:    models.CodeUnknown,
+				Message: fmt.Sprintf("body contains unknown key %s", fieldName),
+			}}
 		case err.Error() == "http: request body too large":
 			return fmt.Errorf("body must not be larger than %d bytes", maxBytes)
 		case errors.As(err, &invalidUnmarshalError):
@@ -269,6 +429,11 @@ func (t *Tools) ReadJSON(w http.ResponseWriter, r *http.Request, data interface{
 		return errors.New("body must contain only one JSON object")
 	}
 
+	// run model validation, if the target supports it
+	if v, ok := data.(models.Validator); ok {
+		return v.Validate()
+	}
+
 	return nil
 }
 
@@ -295,21 +460,41 @@ func (t *Tools) WriteJSON(w http.ResponseWriter, status int, data interface{}, h
 }
 
 // ErrorJSON sends a JSON error response with the specified status code or a default status of Bad Gateway (502).
+// If err is (or wraps) models.ValidationErrors, the field errors are included in the response and the
+// default status becomes Unprocessable Entity (422). When ProblemJSON is set, an RFC 7807 document is sent instead.
 func (t *Tools) ErrorJSON(w http.ResponseWriter, err error, status ...int) error {
 	statusCode := http.StatusBadGateway
-	if len(status) > 0 {
-		statusCode = status[0]
-	}
 
 	var payload JSONResponse
 	payload.Error = true
 	payload.Message = err.Error()
 
+	var validationErrors models.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		statusCode = http.StatusUnprocessableEntity
+		payload.Message = "one or more fields are invalid"
+		payload.Errors = validationErrors
+	}
+
+	var problem *ProblemDetails
+	if errors.As(err, &problem) && problem.Status != 0 {
+		statusCode = problem.Status
+	}
+
+	if len(status) > 0 {
+		statusCode = status[0]
+	}
+
+	if t.ProblemJSON {
+		return t.WriteProblem(w, t.NewProblem(err, statusCode))
+	}
+
 	return t.WriteJSON(w, statusCode, payload)
 }
 
 // PushJSONToRemote posts arbitrary data to some URL as JSON, and returns the response, status code, and error, if any.
-// The final parameter, client, is optional. If none is specified, we use the standard http.Client.
+// The final parameter, client, is optional. If none is specified, we use a client with a 30 second timeout.
+// The response body is closed; use PushJSON to read it, or to retry failed requests
 func (t *Tools) PushJSONToRemote(uri string, data interface{}, client ...*http.Client) (*http.Response, int, error) {
 	// create json
 	jsonData, err := json.Marshal(data)
@@ -318,7 +503,7 @@ func (t *Tools) PushJSONToRemote(uri string, data interface{}, client ...*http.C
 	}
 
 	// check for custom http client
-	httpClient := &http.Client{}
+	httpClient := defaultHTTPClient
 	if len(client) > 0 {
 		httpClient = client[0]
 	}
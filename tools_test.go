@@ -2,9 +2,20 @@ package toolkit
 
 import (
 	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/babykittenz/api-micro-util/imaging"
+	"github.com/babykittenz/api-micro-util/models"
+	"github.com/babykittenz/api-micro-util/scan"
+	"github.com/babykittenz/api-micro-util/storage"
 	"github.com/stretchr/testify/assert"
 	"image"
 	"image/png"
@@ -12,7 +23,9 @@ import (
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"strings"
 	"sync"
 	"testing"
 )
@@ -194,6 +207,638 @@ func TestTools_UploadOneFile(t *testing.T) {
 	}
 }
 
+// TestTools_FileStore tests that UploadFiles and DownloadStaticFile use the configured FileStore instead of the local disk.
+func TestTools_FileStore(t *testing.T) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "logo.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pic, err := os.ReadFile("./testdata/image.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = part.Write(pic)
+	_ = writer.Close()
+
+	request := httptest.NewRequest("POST", "/", &body)
+	request.Header.Add("Content-Type", writer.FormDataContentType())
+
+	testTools := Tools{FileStore: storage.NewMemoryStore()}
+	uploadedFile, err := testTools.UploadOneFile(request, "acme/logos", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := testTools.FileStore.Stat(request.Context(), "acme/logos/logo.png")
+	if err != nil {
+		t.Fatalf("expected the file in the store: %s", err)
+	}
+	if info.Size != uploadedFile.FileSize || info.ContentType != "image/png" {
+		t.Errorf("unexpected stored file %+v", info)
+	}
+
+	rr := httptest.NewRecorder()
+	testTools.DownloadStaticFile(rr, httptest.NewRequest("GET", "/", nil), "acme/logos", "logo.png", "acme.png")
+	if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), pic) {
+		t.Errorf("expected the stored file to be downloaded, recieved %d with %d bytes", rr.Code, rr.Body.Len())
+	}
+
+	rr = httptest.NewRecorder()
+	testTools.DownloadStaticFile(rr, httptest.NewRequest("GET", "/", nil), "acme/logos", "missing.png", "missing.png")
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing file, recieved %d", rr.Code)
+	}
+}
+
+// TestTools_UploadFilesParsedForm tests that UploadFiles takes the files from r.MultipartForm when the form was
+// already parsed, as it is once r.FormValue has been called.
+func TestTools_UploadFilesParsedForm(t *testing.T) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	_ = writer.WriteField("company_id", "acme")
+	for _, name := range []string{"b.txt", "a.txt"} {
+		part, _ := writer.CreateFormFile("file", name)
+		_, _ = part.Write([]byte("text " + name))
+	}
+	_ = writer.Close()
+
+	request := httptest.NewRequest("POST", "/", &body)
+	request.Header.Add("Content-Type", writer.FormDataContentType())
+	if request.FormValue("company_id") != "acme" {
+		t.Fatalf("expected the form to parse, recieved %q", request.FormValue("company_id"))
+	}
+
+	testTools := Tools{FileStore: storage.NewMemoryStore()}
+	uploadedFiles, err := testTools.UploadFiles(request, "uploads", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uploadedFiles) != 2 || uploadedFiles[0].OriginalFileName != "b.txt" || uploadedFiles[1].FieldName != "file" {
+		t.Errorf("expected both files in the order sent, recieved %d files", len(uploadedFiles))
+	}
+	if info, err := testTools.FileStore.Stat(request.Context(), "uploads/a.txt"); err != nil || info.Size != 10 {
+		t.Errorf("expected the parsed file in the store, recieved %+v %v", info, err)
+	}
+	if request.FormValue("company_id") != "acme" {
+		t.Errorf("expected form values to be kept, recieved %q", request.FormValue("company_id"))
+	}
+}
+
+// TestTools_UploadFilesS3 tests that a large upload is streamed into an S3Store as a multipart upload, from a
+// request body that cannot seek, without writing anything to disk.
+func TestTools_UploadFilesS3(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	video := bytes.Repeat([]byte("0123456789abcdef"), 768*1024)
+	go func() {
+		part, _ := writer.CreateFormFile("video", "intro.mp4")
+		_, _ = part.Write(video)
+		_ = writer.Close()
+		_ = pw.Close()
+	}()
+
+	request := httptest.NewRequest("POST", "/", pr)
+	request.Header.Add("Content-Type", writer.FormDataContentType())
+
+	client := newFakeS3Client()
+	testTools := Tools{FileStore: storage.NewS3Store(client, "videos")}
+	uploadedFile, err := testTools.UploadOneFile(request, "acme/videos", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uploadedFile.FileSize != int64(len(video)) {
+		t.Errorf("expected %d bytes uploaded, recieved %d", len(video), uploadedFile.FileSize)
+	}
+	if client.parts < 2 {
+		t.Errorf("expected a multipart upload, recieved %d parts", client.parts)
+	}
+	rc, _, err := testTools.FileStore.Get(request.Context(), "acme/videos/intro.mp4")
+	if err != nil {
+		t.Fatalf("expected the video in the bucket: %s", err)
+	}
+	stored, _ := io.ReadAll(rc)
+	_ = rc.Close()
+	if !bytes.Equal(stored, video) {
+		t.Errorf("expected the stored video to match, recieved %d bytes", len(stored))
+	}
+	if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+		t.Errorf("expected nothing written to disk, recieved %d files", len(entries))
+	}
+}
+
+// fakeS3Client is an in-memory storage.S3API, keeping objects in a memory store and parts of multipart uploads
+// in a map.
+type fakeS3Client struct {
+	mu      sync.Mutex
+	objects *storage.MemoryStore
+	uploads map[string]map[int32][]byte
+	parts   int
+}
+
+func newFakeS3Client() *fakeS3Client {
+	return &fakeS3Client{objects: storage.NewMemoryStore(), uploads: map[string]map[int32][]byte{}}
+}
+
+func (f *fakeS3Client) PutObject(ctx context.Context, in *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if _, err := f.objects.Put(ctx, aws.ToString(in.Key), in.Body, aws.ToString(in.ContentType)); err != nil {
+		return nil, err
+	}
+	return &s3.PutObjectOutput{ETag: aws.String(`"etag"`)}, nil
+}
+
+func (f *fakeS3Client) CreateMultipartUpload(_ context.Context, in *s3.CreateMultipartUploadInput, _ ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := fmt.Sprint(len(f.uploads) + 1)
+	f.uploads[id] = map[int32][]byte{}
+	return &s3.CreateMultipartUploadOutput{Bucket: in.Bucket, Key: in.Key, UploadId: aws.String(id)}, nil
+}
+
+func (f *fakeS3Client) UploadPart(_ context.Context, in *s3.UploadPartInput, _ ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	b, err := io.ReadAll(in.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.uploads[aws.ToString(in.UploadId)][aws.ToInt32(in.PartNumber)] = b
+	f.parts++
+	return &s3.UploadPartOutput{ETag: aws.String(fmt.Sprintf(`"part%d"`, aws.ToInt32(in.PartNumber)))}, nil
+}
+
+func (f *fakeS3Client) CompleteMultipartUpload(ctx context.Context, in *s3.CompleteMultipartUploadInput, _ ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	f.mu.Lock()
+	parts := f.uploads[aws.ToString(in.UploadId)]
+	delete(f.uploads, aws.ToString(in.UploadId))
+	f.mu.Unlock()
+
+	var b []byte
+	for _, part := range in.MultipartUpload.Parts {
+		b = append(b, parts[aws.ToInt32(part.PartNumber)]...)
+	}
+	if _, err := f.objects.Put(ctx, aws.ToString(in.Key), bytes.NewReader(b), ""); err != nil {
+		return nil, err
+	}
+	return &s3.CompleteMultipartUploadOutput{ETag: aws.String(`"multipart"`)}, nil
+}
+
+func (f *fakeS3Client) AbortMultipartUpload(_ context.Context, in *s3.AbortMultipartUploadInput, _ ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.uploads, aws.ToString(in.UploadId))
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func (f *fakeS3Client) GetObject(ctx context.Context, in *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	rc, info, err := f.objects.Get(ctx, aws.ToString(in.Key))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, &types.NoSuchKey{}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s3.GetObjectOutput{Body: rc, ContentLength: aws.Int64(info.Size), ContentType: aws.String(info.ContentType)}, nil
+}
+
+func (f *fakeS3Client) HeadObject(ctx context.Context, in *s3.HeadObjectInput, _ ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	info, err := f.objects.Stat(ctx, aws.ToString(in.Key))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, &types.NotFound{}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s3.HeadObjectOutput{ContentLength: aws.Int64(info.Size), ContentType: aws.String(info.ContentType)}, nil
+}
+
+func (f *fakeS3Client) DeleteObject(ctx context.Context, in *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	return &s3.DeleteObjectOutput{}, f.objects.Delete(ctx, aws.ToString(in.Key))
+}
+
+func (f *fakeS3Client) CopyObject(ctx context.Context, in *s3.CopyObjectInput, _ ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	source, err := url.PathUnescape(aws.ToString(in.CopySource))
+	if err != nil {
+		return nil, err
+	}
+	_, key, _ := strings.Cut(source, "/")
+	rc, info, err := f.objects.Get(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, &types.NoSuchKey{}
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	if _, err := f.objects.Put(ctx, aws.ToString(in.Key), rc, info.ContentType); err != nil {
+		return nil, err
+	}
+	return &s3.CopyObjectOutput{}, nil
+}
+
+func (f *fakeS3Client) ListObjectsV2(ctx context.Context, in *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	infos, err := f.objects.List(ctx, aws.ToString(in.Prefix))
+	if err != nil {
+		return nil, err
+	}
+	out := &s3.ListObjectsV2Output{}
+	for _, info := range infos {
+		out.Contents = append(out.Contents, types.Object{Key: aws.String(info.Key), Size: aws.Int64(info.Size)})
+	}
+	return out, nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read reads from the underlying reader and counts the bytes.
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// uploadLimitTests is a test table for the size limits UploadFiles enforces while streaming.
+var uploadLimitTests = []struct {
+	name          string
+	maxFileSize   int
+	maxUploadSize int64
+	expectedErr   error
+	expectedFiles int
+}{
+	{name: "within limits", maxFileSize: 2 << 20, maxUploadSize: 4 << 20, expectedFiles: 3},
+	{name: "file too large", maxFileSize: 1024, expectedErr: ErrFileTooLarge, expectedFiles: 0},
+	{name: "upload too large", maxFileSize: 4096, maxUploadSize: 3000, expectedErr: ErrUploadTooLarge, expectedFiles: 0},
+}
+
+// TestTools_UploadFilesLimits tests that UploadFiles rejects oversized uploads as the bytes arrive, without reading
+// the rest of the request, and keeps the other form fields.
+func TestTools_UploadFilesLimits(t *testing.T) {
+	for _, e := range uploadLimitTests {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		_ = writer.WriteField("company_id", "acme")
+		for _, name := range []string{"one.txt", "two.txt"} {
+			part, _ := writer.CreateFormFile("file", name)
+			_, _ = part.Write(bytes.Repeat([]byte("a"), 2048))
+		}
+		// a large trailing part, which should never be read when a limit is hit
+		part, _ := writer.CreateFormFile("video", "video.mp4")
+		_, _ = part.Write(bytes.Repeat([]byte("v"), 1<<20))
+		_ = writer.Close()
+
+		counter := &countingReader{r: &body}
+		request := httptest.NewRequest("POST", "/", counter)
+		request.Header.Add("Content-Type", writer.FormDataContentType())
+
+		store := storage.NewMemoryStore()
+		testTools := Tools{FileStore: store, MaxFileSize: e.maxFileSize, MaxUploadSize: e.maxUploadSize}
+
+		uploadedFiles, err := testTools.UploadFiles(request, "uploads", false)
+		if !errors.Is(err, e.expectedErr) {
+			t.Errorf("%s: expected error %v, recieved %v", e.name, e.expectedErr, err)
+		}
+		if len(uploadedFiles) != e.expectedFiles {
+			t.Errorf("%s: expected %d files, recieved %d", e.name, e.expectedFiles, len(uploadedFiles))
+		}
+		if e.expectedErr != nil {
+			if counter.n > 64*1024 {
+				t.Errorf("%s: expected the upload to stop early, but %d bytes were read", e.name, counter.n)
+			}
+			list, _ := store.List(request.Context(), "uploads/")
+			if len(list) != 0 {
+				t.Errorf("%s: expected no files to be left behind, recieved %d files", e.name, len(list))
+			}
+			continue
+		}
+
+		if request.FormValue("company_id") != "acme" {
+			t.Errorf("%s: expected form values to be kept, recieved %q", e.name, request.FormValue("company_id"))
+		}
+	}
+}
+
+// TestTools_UploadPolicies tests that per-field upload policies are enforced and every violation is reported by field.
+func TestTools_UploadPolicies(t *testing.T) {
+	pic, err := os.ReadFile("./testdata/image.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	parts := []struct {
+		field, name string
+		data        []byte
+	}{
+		{"logo", "logo.png", pic},
+		{"logo", "second.png", pic},
+		{"blank_pdf", "blank.pdf", []byte("not really a pdf")},
+		{"video", "intro.mov", []byte("\x00\x00\x00\x18ftypmp42")},
+		{"other", "notes.txt", []byte("anything goes")},
+	}
+	for _, p := range parts {
+		part, _ := writer.CreateFormFile(p.field, p.name)
+		_, _ = part.Write(p.data)
+	}
+	_ = writer.Close()
+
+	request := httptest.NewRequest("POST", "/", &body)
+	request.Header.Add("Content-Type", writer.FormDataContentType())
+
+	testTools := Tools{
+		FileStore: storage.NewMemoryStore(),
+		UploadPolicies: map[string]UploadPolicy{
+			"logo":      {AllowedTypes: []string{"image/png", "image/jpeg"}, MaxFileSize: 2 << 20, MaxFiles: 1},
+			"blank_pdf": {AllowedTypes: []string{"application/pdf"}, MaxFileSize: 20 << 20},
+			"video":     {AllowedExtensions: []string{".mp4"}, MaxFileSize: 2 << 30},
+		},
+	}
+
+	uploadedFiles, err := testTools.UploadFiles(request, "uploads", false)
+
+	var violations models.ValidationErrors
+	if !errors.As(err, &violations) {
+		t.Fatalf("expected validation errors, recieved %v", err)
+	}
+	expected := map[string]string{"logo": models.CodeMax, "blank_pdf": models.CodeOneOf, "video": models.CodeOneOf}
+	if len(violations) != len(expected) {
+		t.Errorf("expected %d violations, recieved %v", len(expected), violations)
+	}
+	for _, v := range violations {
+		if expected[v.Field] != v.Code {
+			t.Errorf("unexpected violation %+v", v)
+		}
+	}
+
+	if uploadedFiles != nil {
+		t.Errorf("expected no files to be returned, recieved %d", len(uploadedFiles))
+	}
+	if list, _ := testTools.FileStore.List(request.Context(), ""); len(list) != 0 {
+		t.Errorf("expected the valid files to be rolled back, recieved %d files", len(list))
+	}
+}
+
+// TestTools_UploadImageRenditions tests that images in a field with an image pipeline are stored with their renditions.
+func TestTools_UploadImageRenditions(t *testing.T) {
+	pic, err := os.ReadFile("./testdata/pic.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile("logo", "puppy.jpg")
+	_, _ = part.Write(pic)
+	part, _ = writer.CreateFormFile("map", "broken.png")
+	_, _ = part.Write([]byte("\x89PNG\r\n\x1a\n but not really"))
+	_ = writer.Close()
+
+	pipeline := &imaging.Pipeline{Renditions: []imaging.Rendition{
+		{Name: "thumbnail", MaxWidth: 64, MaxHeight: 64},
+		{Name: "kiosk", MaxWidth: 400, Format: imaging.FormatPNG},
+	}}
+	store := storage.NewMemoryStore()
+	testTools := Tools{
+		FileStore: store,
+		UploadPolicies: map[string]UploadPolicy{
+			"logo": {Images: pipeline},
+			"map":  {Images: pipeline},
+		},
+	}
+
+	request := httptest.NewRequest("POST", "/", &body)
+	request.Header.Add("Content-Type", writer.FormDataContentType())
+	_, err = testTools.UploadFiles(request, "logos", false)
+
+	var violations models.ValidationErrors
+	if !errors.As(err, &violations) || len(violations) != 1 || violations[0].Field != "map" || violations[0].Code != models.CodeFormat {
+		t.Fatalf("expected a format error for the broken map, recieved %v", err)
+	}
+
+	// upload the logo on its own
+	body.Reset()
+	writer = multipart.NewWriter(&body)
+	part, _ = writer.CreateFormFile("logo", "puppy.jpg")
+	_, _ = part.Write(pic)
+	_ = writer.Close()
+
+	request = httptest.NewRequest("POST", "/", &body)
+	request.Header.Add("Content-Type", writer.FormDataContentType())
+	uploadedFiles, err := testTools.UploadFiles(request, "logos", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renditions := uploadedFiles[0].Renditions
+	if len(renditions) != 2 || renditions[0].NewFileName != "puppy-thumbnail.jpg" || renditions[1].NewFileName != "puppy-kiosk.png" {
+		t.Fatalf("unexpected renditions %+v", renditions)
+	}
+	if renditions[0].Width > 64 || renditions[0].Height > 64 || renditions[1].Width > 400 {
+		t.Errorf("expected renditions within their bounds, recieved %+v %+v", renditions[0], renditions[1])
+	}
+	for _, key := range []string{"logos/puppy.jpg", "logos/puppy-thumbnail.jpg", "logos/puppy-kiosk.png"} {
+		if _, err := store.Stat(request.Context(), key); err != nil {
+			t.Errorf("expected %s to be stored, recieved %v", key, err)
+		}
+	}
+}
+
+// TestTools_UploadContentAddressed tests that uploads are hashed, named by content and not stored twice.
+func TestTools_UploadContentAddressed(t *testing.T) {
+	agreement := []byte("%PDF-1.4 signed agreement")
+	sha := sha256.Sum256(agreement)
+	md := md5.Sum(agreement)
+
+	store := storage.NewMemoryStore()
+	testTools := Tools{FileStore: store, ContentAddressed: true, UploadMD5: true}
+
+	upload := func(names ...string) []*UploadedFile {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		for _, name := range names {
+			part, _ := writer.CreateFormFile("agreement", name)
+			_, _ = part.Write(agreement)
+		}
+		_ = writer.Close()
+
+		request := httptest.NewRequest("POST", "/", &body)
+		request.Header.Add("Content-Type", writer.FormDataContentType())
+		uploadedFiles, err := testTools.UploadFiles(request, "agreements")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return uploadedFiles
+	}
+
+	first := upload("agreement.pdf", "copy.pdf")
+	if first[0].NewFileName != hex.EncodeToString(sha[:])+".pdf" || first[0].SHA256 != hex.EncodeToString(sha[:]) {
+		t.Errorf("expected the file to be named by its SHA-256, recieved %s", first[0].NewFileName)
+	}
+	if first[0].MD5 != hex.EncodeToString(md[:]) {
+		t.Errorf("expected the MD5 digest, recieved %s", first[0].MD5)
+	}
+	if first[0].Duplicate || !first[1].Duplicate {
+		t.Errorf("expected only the second copy in the same upload to be a duplicate, recieved %v and %v", first[0].Duplicate, first[1].Duplicate)
+	}
+
+	second := upload("again.pdf")
+	if !second[0].Duplicate || second[0].NewFileName != first[0].NewFileName {
+		t.Errorf("expected a re-upload to be detected as a duplicate, recieved %+v", second[0])
+	}
+
+	list, _ := store.List(context.Background(), "agreements/")
+	if len(list) != 1 {
+		t.Fatalf("expected the agreement to be stored once, recieved %d files", len(list))
+	}
+	if list[0].ETag != `"`+first[0].MD5+`"` {
+		t.Errorf("expected the MD5 to match the store ETag, recieved %s and %s", first[0].MD5, list[0].ETag)
+	}
+}
+
+// TestTools_UploadFilesCancelled tests that files staged before the request is cancelled are removed.
+func TestTools_UploadFilesCancelled(t *testing.T) {
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		part, _ := writer.CreateFormFile("file", "one.txt")
+		_, _ = part.Write([]byte("first file"))
+		part, _ = writer.CreateFormFile("file", "two.txt")
+		_, _ = part.Write([]byte("second file, sent after the client has gone"))
+		// the client goes away part way through the upload
+		cancel()
+		_ = pw.CloseWithError(context.Canceled)
+	}()
+
+	request := httptest.NewRequest("POST", "/", pr).WithContext(ctx)
+	request.Header.Add("Content-Type", writer.FormDataContentType())
+
+	store := storage.NewMemoryStore()
+	testTools := Tools{FileStore: store}
+	uploadedFiles, err := testTools.UploadFiles(request, "uploads", false)
+	if err == nil || uploadedFiles != nil {
+		t.Errorf("expected the upload to fail, recieved %d files and %v", len(uploadedFiles), err)
+	}
+	if list, _ := store.List(context.Background(), ""); len(list) != 0 {
+		t.Errorf("expected staged files to be removed, recieved %v", list)
+	}
+}
+
+// failingMoveStore is a MemoryStore whose moves to one key fail.
+type failingMoveStore struct {
+	*storage.MemoryStore
+	failTo string
+}
+
+// Move fails for the key failTo.
+func (s *failingMoveStore) Move(ctx context.Context, from, to string) error {
+	if to == s.failTo {
+		return errors.New("store unavailable")
+	}
+	return s.MemoryStore.Move(ctx, from, to)
+}
+
+// TestTools_UploadFilesReplace tests that an upload without renaming replaces existing files, and that a failed
+// upload puts back the files it replaced instead of deleting them.
+func TestTools_UploadFilesReplace(t *testing.T) {
+	for _, failTo := range []string{"uploads/b.txt", ""} {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		for _, name := range []string{"a.txt", "b.txt"} {
+			part, _ := writer.CreateFormFile("file", name)
+			_, _ = part.Write([]byte("new " + name))
+		}
+		_ = writer.Close()
+		request := httptest.NewRequest("POST", "/", &body)
+		request.Header.Add("Content-Type", writer.FormDataContentType())
+
+		store := &failingMoveStore{MemoryStore: storage.NewMemoryStore(), failTo: failTo}
+		_, _ = store.Put(context.Background(), "uploads/a.txt", strings.NewReader("original a.txt"), "text/plain")
+
+		testTools := Tools{FileStore: store}
+		_, err := testTools.UploadFiles(request, "uploads", false)
+		if failTo != "" && err == nil {
+			t.Errorf("%s: expected the upload to fail", failTo)
+		}
+		if failTo == "" && err != nil {
+			t.Fatal(err)
+		}
+
+		expected := "new a.txt"
+		if failTo != "" {
+			expected = "original a.txt"
+		}
+		rc, _, err := store.Get(context.Background(), "uploads/a.txt")
+		if err != nil {
+			t.Fatalf("%s: expected a.txt to be kept: %v", failTo, err)
+		}
+		content, _ := io.ReadAll(rc)
+		_ = rc.Close()
+		if string(content) != expected {
+			t.Errorf("%s: expected a.txt to hold %q, recieved %q", failTo, expected, content)
+		}
+
+		list, _ := store.List(context.Background(), "")
+		if (failTo != "" && len(list) != 1) || (failTo == "" && len(list) != 2) {
+			t.Errorf("%s: expected no staged or replaced files to be left, recieved %v", failTo, list)
+		}
+	}
+}
+
+// TestTools_UploadScanners tests that files rejected by a scanner, or that cannot be scanned, fail the upload.
+func TestTools_UploadScanners(t *testing.T) {
+	upload := func(testTools Tools) ([]*UploadedFile, error) {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, _ := writer.CreateFormFile("notes", "notes.txt")
+		_, _ = part.Write([]byte("meeting notes"))
+		part, _ = writer.CreateFormFile("contract", "contract.pdf")
+		_, _ = part.Write([]byte("%PDF-1.4\n1 0 obj << /OpenAction << /S /JavaScript /JS (app.alert(1)) >> >> endobj"))
+		_ = writer.Close()
+
+		request := httptest.NewRequest("POST", "/", &body)
+		request.Header.Add("Content-Type", writer.FormDataContentType())
+		return testTools.UploadFiles(request, "uploads")
+	}
+
+	store := storage.NewMemoryStore()
+	uploadedFiles, err := upload(Tools{FileStore: store, Scanners: []scan.Scanner{&scan.PDFScanner{}}})
+
+	var violations models.ValidationErrors
+	if !errors.As(err, &violations) {
+		t.Fatalf("expected validation errors, recieved %v", err)
+	}
+	if len(violations) != 1 || violations[0].Field != "contract" || violations[0].Code != models.CodeUnsafe {
+		t.Errorf("expected the contract to be rejected as unsafe, recieved %v", violations)
+	}
+	if uploadedFiles != nil {
+		t.Errorf("expected no files to be returned, recieved %d", len(uploadedFiles))
+	}
+	if list, _ := store.List(context.Background(), ""); len(list) != 0 {
+		t.Errorf("expected the clean file to be rolled back, recieved %d files", len(list))
+	}
+
+	unavailable := scan.ScannerFunc(func(ctx context.Context, name string, r io.Reader) (scan.Result, error) {
+		return scan.Result{}, errors.New("scanner unavailable")
+	})
+	if _, err := upload(Tools{FileStore: store, Scanners: []scan.Scanner{unavailable}}); err == nil || errors.As(err, &violations) {
+		t.Errorf("expected the upload to fail when files cannot be scanned, recieved %v", err)
+	}
+	if list, _ := store.List(context.Background(), ""); len(list) != 0 {
+		t.Errorf("expected no files to be kept when scanning fails, recieved %d files", len(list))
+	}
+}
+
 // TestTools_CreateDirIfNotExist tests the CreateDirIfNotExist method by creating and removing a directory to ensure proper functionality.
 func TestTools_CreateDirIfNotExist(t *testing.T) {
 	var testTools Tools
@@ -325,6 +970,26 @@ func TestTools_ReadJSON(t *testing.T) {
 	}
 }
 
+// TestTools_ReadJSONValidates verifies that ReadJSON runs model validation after decoding into a models.Validator.
+func TestTools_ReadJSONValidates(t *testing.T) {
+	var testTool Tools
+
+	req, _ := http.NewRequest("POST", "/", bytes.NewReader([]byte(`{"first_name": "Robert", "email": "bad"}`)))
+	rr := httptest.NewRecorder()
+
+	var trainee models.Trainee
+	err := testTool.ReadJSON(rr, req, &trainee)
+
+	var verrs models.ValidationErrors
+	if !errors.As(err, &verrs) {
+		t.Fatalf("expected validation errors but got %v", err)
+	}
+
+	if len(verrs) != 2 {
+		t.Errorf("expected 2 field errors but got %d: %v", len(verrs), verrs)
+	}
+}
+
 // TestTools_WriteJSON tests the WriteJSON function to ensure it correctly writes a JSON response with headers and status code.
 func TestTools_WriteJSON(t *testing.T) {
 	var testTool Tools
@@ -368,6 +1033,38 @@ func TestTools_ErrorJSON(t *testing.T) {
 	}
 }
 
+// TestTools_ErrorJSONFieldErrors verifies that field errors from ReadJSON are rendered by ErrorJSON with a 422 status.
+func TestTools_ErrorJSONFieldErrors(t *testing.T) {
+	var testTool Tools
+
+	req, _ := http.NewRequest("POST", "/", bytes.NewReader([]byte(`{"first_name": 1}`)))
+	var trainee models.Trainee
+	readErr := testTool.ReadJSON(httptest.NewRecorder(), req, &trainee)
+	if readErr == nil {
+		t.Fatal("expected an error reading json")
+	}
+
+	rr := httptest.NewRecorder()
+	err := testTool.ErrorJSON(rr, readErr)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("wrong status code recieved: %d", rr.Code)
+	}
+
+	var payload JSONResponse
+	err = json.NewDecoder(rr.Body).Decode(&payload)
+	if err != nil {
+		t.Error("received error while decoding json", err)
+	}
+
+	if len(payload.Errors) != 1 || payload.Errors[0].Field != "first_name" || payload.Errors[0].Code != models.CodeType {
+		t.Errorf("wrong field errors recieved: %v", payload.Errors)
+	}
+}
+
 // Test environment variables
 func TestEnvironmentVariables(t *testing.T) {
 	SetupTest(t)
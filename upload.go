@@ -0,0 +1,521 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/babykittenz/api-micro-util/imaging"
+	"github.com/babykittenz/api-micro-util/models"
+	"github.com/babykittenz/api-micro-util/scan"
+	"github.com/babykittenz/api-micro-util/storage"
+)
+
+// maxFormValueBytes caps the combined size of the non-file fields read by UploadFiles, as ParseMultipartForm does.
+const maxFormValueBytes = 10 << 20
+
+var (
+	// ErrFileTooLarge is returned by UploadFiles when a single file is larger than MaxFileSize.
+	ErrFileTooLarge = errors.New("the uploaded file is too large")
+	// ErrUploadTooLarge is returned by UploadFiles when the files together are larger than MaxUploadSize.
+	ErrUploadTooLarge = errors.New("the upload is too large")
+	// ErrFileTypeNotAllowed is returned by UploadFiles when a file's sniffed content type is not allowed.
+	ErrFileTypeNotAllowed = errors.New("file type not allowed")
+	// ErrFileExtensionNotAllowed is returned by UploadFiles when a file's extension is not in its policy.
+	ErrFileExtensionNotAllowed = errors.New("file extension not allowed")
+	// ErrImageInvalid is returned by UploadFiles when an image in a field with an image pipeline cannot be processed.
+	ErrImageInvalid = errors.New("the uploaded image could not be processed")
+)
+
+// UploadPolicy restricts the files accepted in one form field, e.g. a 2 MB PNG or JPEG logo, a 20 MB blank PDF
+// or a single 2 GB training video.
+type UploadPolicy struct {
+	// AllowedTypes lists the MIME types allowed, matched against the type sniffed from the file's content
+	AllowedTypes []string
+	// AllowedExtensions lists the file name extensions allowed, such as ".png", matched case insensitively
+	AllowedExtensions []string
+	// MaxFileSize is the largest size of each file in bytes. Zero uses Tools.MaxFileSize
+	MaxFileSize int64
+	// MaxFiles is the most files the field may contain. Zero means no limit
+	MaxFiles int
+	// Images, if set, processes PNG, JPEG and GIF files in the field: the file is stored upright and without
+	// EXIF metadata, and each rendition is stored beside it as <name>-<rendition><ext>
+	Images *imaging.Pipeline
+}
+
+// uploadPolicy returns the policy for a form field, filling in the Tools wide settings it leaves unset, and
+// whether the field has its own policy.
+func (t *Tools) uploadPolicy(field string) (UploadPolicy, bool) {
+	policy, ok := t.UploadPolicies[field]
+	if !ok {
+		policy.AllowedTypes = t.AllowedFileTypes
+	}
+	if policy.MaxFileSize == 0 {
+		policy.MaxFileSize = int64(t.MaxFileSize)
+	}
+	return policy, ok
+}
+
+// allowsExtension reports whether the extension of filename is allowed by the policy.
+func (p UploadPolicy) allowsExtension(filename string) bool {
+	if len(p.AllowedExtensions) == 0 {
+		return true
+	}
+	ext := filepath.Ext(filename)
+	for _, allowed := range p.AllowedExtensions {
+		if strings.EqualFold(ext, allowed) || strings.EqualFold(ext, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// policyViolation converts an error from uploading a file in field into a field error, if the error means the
+// file broke the field's policy.
+func policyViolation(field string, policy UploadPolicy, err error) (models.FieldError, bool) {
+	fieldErr := models.FieldError{Field: field}
+	switch {
+	case errors.Is(err, ErrFileTypeNotAllowed):
+		fieldErr.Code, fieldErr.Message = models.CodeOneOf, "must be one of "+strings.Join(policy.AllowedTypes, ", ")
+	case errors.Is(err, ErrFileExtensionNotAllowed):
+		fieldErr.Code, fieldErr.Message = models.CodeOneOf, "must have one of the extensions "+strings.Join(policy.AllowedExtensions, ", ")
+	case errors.Is(err, ErrImageInvalid):
+		fieldErr.Code, fieldErr.Message = models.CodeFormat, "must be a valid PNG, JPEG or GIF image"
+	case errors.Is(err, ErrFileTooLarge):
+		fieldErr.Code, fieldErr.Message = models.CodeMax, fmt.Sprintf("must be at most %d bytes", policy.MaxFileSize)
+	default:
+		return fieldErr, false
+	}
+	return fieldErr, true
+}
+
+// formPart is one part of a multipart upload: a *multipart.Part read from the request body, or a file of a form
+// that was already parsed.
+type formPart interface {
+	io.ReadCloser
+	FileName() string
+	FormName() string
+}
+
+// partReader returns the next part of an upload, or io.EOF once there are none left.
+type partReader func() (formPart, error)
+
+// streamedParts reads parts from the request body as they arrive.
+func streamedParts(reader *multipart.Reader) partReader {
+	return func() (formPart, error) {
+		part, err := reader.NextPart()
+		if err != nil {
+			return nil, err
+		}
+		return part, nil
+	}
+}
+
+// parsedParts returns the files of a form already read by ParseMultipartForm, in field name order. The other
+// fields of the form are already in r.Form, so only files are returned.
+func parsedParts(form *multipart.Form) partReader {
+	fields := make([]string, 0, len(form.File))
+	for field := range form.File {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var files []*parsedFile
+	for _, field := range fields {
+		for _, header := range form.File[field] {
+			files = append(files, &parsedFile{header: header, field: field})
+		}
+	}
+
+	return func() (formPart, error) {
+		if len(files) == 0 {
+			return nil, io.EOF
+		}
+		file := files[0]
+		files = files[1:]
+
+		f, err := file.header.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", file.header.Filename, err)
+		}
+		file.File = f
+		return file, nil
+	}
+}
+
+// parsedFile is a file of a parsed multipart form, held in memory or in a temporary file by ParseMultipartForm.
+type parsedFile struct {
+	multipart.File
+	header *multipart.FileHeader
+	field  string
+}
+
+// FileName returns the name of the uploaded file.
+func (f *parsedFile) FileName() string {
+	return f.header.Filename
+}
+
+// FormName returns the name of the form field the file was sent in.
+func (f *parsedFile) FormName() string {
+	return f.field
+}
+
+// uploadLimits tracks how much of an upload's total size limit remains. A total of zero means no limit.
+type uploadLimits struct {
+	total    int64
+	used     int64
+	formUsed int64
+}
+
+// file wraps r so reading fails once it passes maxFile bytes, or the upload passes its total limit.
+func (u *uploadLimits) file(r io.Reader, maxFile int64) *limitedReader {
+	return &limitedReader{r: r, left: maxFile, upload: u}
+}
+
+// skip discards the rest of a part that will not be stored, still counting it against the total limit.
+func (u *uploadLimits) skip(part formPart) error {
+	_, err := io.Copy(io.Discard, u.file(part, math.MaxInt64-1))
+	return err
+}
+
+// limitedReader is an io.Reader that fails with ErrFileTooLarge or ErrUploadTooLarge as soon as a limit is
+// passed, rather than silently stopping like io.LimitReader. The error is kept so it can be reported even if
+// the reader's consumer wraps or replaces it.
+type limitedReader struct {
+	r      io.Reader
+	left   int64
+	upload *uploadLimits
+	err    error
+}
+
+// Read reads from the underlying reader, counting bytes against both limits.
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.err != nil {
+		return 0, l.err
+	}
+
+	// read at most one byte past the nearest limit, which is enough to tell it was passed
+	max := l.left
+	if l.upload.total > 0 && l.upload.total-l.upload.used < max {
+		max = l.upload.total - l.upload.used
+	}
+	if int64(len(p)) > max+1 {
+		p = p[:max+1]
+	}
+
+	n, err := l.r.Read(p)
+	l.left -= int64(n)
+	l.upload.used += int64(n)
+
+	switch {
+	case l.left < 0:
+		l.err = ErrFileTooLarge
+	case l.upload.total > 0 && l.upload.used > l.upload.total:
+		l.err = ErrUploadTooLarge
+	}
+	if l.err != nil {
+		return 0, l.err
+	}
+	return n, err
+}
+
+// readFormValue reads a non-file part into values.
+func readFormValue(part formPart, values url.Values, upload *uploadLimits) error {
+	b, err := io.ReadAll(io.LimitReader(part, maxFormValueBytes-upload.formUsed+1))
+	if err != nil {
+		return err
+	}
+	upload.formUsed += int64(len(b))
+	if upload.formUsed > maxFormValueBytes {
+		return errors.New("the form fields are too large")
+	}
+	values.Add(part.FormName(), string(b))
+	return nil
+}
+
+// keepFormValues makes the non-file fields read by UploadFiles available through r.FormValue and r.PostFormValue.
+func keepFormValues(r *http.Request, values url.Values) {
+	if r.Form == nil {
+		r.Form = make(url.Values)
+		for k, v := range r.URL.Query() {
+			r.Form[k] = v
+		}
+	}
+	if r.PostForm == nil {
+		r.PostForm = make(url.Values)
+	}
+	for k, v := range values {
+		r.Form[k] = append(v, r.Form[k]...)
+		r.PostForm[k] = append(r.PostForm[k], v...)
+	}
+	r.MultipartForm = &multipart.Form{Value: values}
+}
+
+// isProcessedImage reports whether files of the sniffed content type go through an image pipeline.
+func isProcessedImage(contentType string) bool {
+	switch contentType {
+	case "image/png", "image/jpeg", "image/gif":
+		return true
+	}
+	return false
+}
+
+// storeImage reads an image, runs it through pipeline, and stages the cleaned original and its renditions.
+// The digests are of the cleaned original. With content addressing, an image whose cleaned original is already
+// stored is marked as a duplicate and nothing is staged, as its renditions are produced from it.
+func storeImage(ctx context.Context, tx *uploadTx, pipeline *imaging.Pipeline, uploadDir string, uploadedFile *UploadedFile, body *limitedReader, contentAddressed, withMD5 bool) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	original, renditions, err := pipeline.Process(data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrImageInvalid, err)
+	}
+
+	hashes := newFileHashes(withMD5)
+	_, _ = hashes.Write(original.Data)
+	uploadedFile.SHA256, uploadedFile.MD5 = hashes.sums()
+	uploadedFile.FileSize = int64(len(original.Data))
+	if contentAddressed {
+		uploadedFile.NewFileName = uploadedFile.SHA256 + filepath.Ext(uploadedFile.NewFileName)
+		if uploadedFile.Duplicate, err = tx.exists(ctx, path.Join(uploadDir, uploadedFile.NewFileName)); err != nil {
+			return err
+		}
+	}
+
+	if !uploadedFile.Duplicate {
+		if _, err := tx.put(ctx, path.Join(uploadDir, uploadedFile.NewFileName), bytes.NewReader(original.Data), original.ContentType(), uploadedFile); err != nil {
+			return err
+		}
+	}
+
+	base := strings.TrimSuffix(uploadedFile.NewFileName, filepath.Ext(uploadedFile.NewFileName))
+	for _, r := range renditions {
+		name := base + "-" + r.Name + r.Ext()
+		if !uploadedFile.Duplicate {
+			if _, err := tx.put(ctx, path.Join(uploadDir, name), bytes.NewReader(r.Data), r.ContentType(), nil); err != nil {
+				return err
+			}
+		}
+		uploadedFile.Renditions = append(uploadedFile.Renditions, &UploadedRendition{
+			Name:        r.Name,
+			NewFileName: name,
+			Width:       r.Width,
+			Height:      r.Height,
+			FileSize:    int64(len(r.Data)),
+		})
+	}
+	return nil
+}
+
+// fileHashes computes the digests of a file as it is copied.
+type fileHashes struct {
+	sha256 hash.Hash
+	md5    hash.Hash
+}
+
+// newFileHashes returns a fileHashes computing SHA-256, and MD5 if withMD5 is set.
+func newFileHashes(withMD5 bool) *fileHashes {
+	h := &fileHashes{sha256: sha256.New()}
+	if withMD5 {
+		h.md5 = md5.New()
+	}
+	return h
+}
+
+// Write adds p to each digest.
+func (h *fileHashes) Write(p []byte) (int, error) {
+	h.sha256.Write(p)
+	if h.md5 != nil {
+		h.md5.Write(p)
+	}
+	return len(p), nil
+}
+
+// sums returns the hex encoded SHA-256 and MD5 digests. The MD5 digest is empty if it was not computed.
+func (h *fileHashes) sums() (string, string) {
+	md5Sum := ""
+	if h.md5 != nil {
+		md5Sum = hex.EncodeToString(h.md5.Sum(nil))
+	}
+	return hex.EncodeToString(h.sha256.Sum(nil)), md5Sum
+}
+
+// scanStaged runs t.Scanners over every staged file that came from the request, reading each file once for all
+// of them, and reports the files they reject by form field.
+func (t *Tools) scanStaged(ctx context.Context, tx *uploadTx) error {
+	if len(t.Scanners) == 0 {
+		return nil
+	}
+
+	var violations models.ValidationErrors
+	for _, f := range tx.staged {
+		if f.source == nil {
+			continue
+		}
+		rc, _, err := tx.store.Get(ctx, f.staging)
+		if err != nil {
+			return err
+		}
+		result, err := scan.All(ctx, f.source.OriginalFileName, rc, t.Scanners...)
+		_ = rc.Close()
+		if err != nil {
+			return fmt.Errorf("failed to scan %s: %w", f.source.OriginalFileName, err)
+		}
+		if !result.Clean {
+			violations.Add(f.source.FieldName, models.CodeUnsafe, fmt.Sprintf("%s was rejected: %s", f.source.OriginalFileName, result.Threat))
+		}
+	}
+	return violations.ErrOrNil()
+}
+
+// uploadTx stages the files of one UploadFiles call so they can be committed or rolled back together.
+type uploadTx struct {
+	store  storage.FileStore
+	id     string
+	staged []stagedFile
+}
+
+// stagedFile is a file written to its staging key, waiting to be moved to its final key.
+type stagedFile struct {
+	staging, final string
+	// source is the uploaded file, or nil for a rendition produced from one, which is not scanned
+	source *UploadedFile
+}
+
+// put writes r to a hidden staging key beside final, in the same directory so a move is cheap. Source is the
+// uploaded file the content came from, if it came straight from the request.
+func (tx *uploadTx) put(ctx context.Context, final string, r io.Reader, contentType string, source *UploadedFile) (storage.ObjectInfo, error) {
+	staging := path.Join(path.Dir(final), ".staging-"+tx.id+"-"+path.Base(final))
+	info, err := tx.store.Put(ctx, staging, r, contentType)
+	if err != nil {
+		// don't leave a partial file behind
+		_ = tx.store.Delete(context.Background(), staging)
+		return info, err
+	}
+	tx.staged = append(tx.staged, stagedFile{staging: staging, final: final, source: source})
+	return info, nil
+}
+
+// commit moves every staged file to its final key. A file already stored under a final key is moved aside first,
+// so if a later move fails, the files already moved are removed, the files they replaced are put back and the rest
+// are rolled back. A failed upload never loses a file it did not write. The replaced files are deleted once every
+// move has succeeded.
+func (tx *uploadTx) commit(ctx context.Context) error {
+	// replaced holds each file moved aside, with its backup key as staging and the key it came from as final
+	var replaced []stagedFile
+	var err error
+	// moved counts the staged files now stored under their final keys
+	moved := 0
+	for i, f := range tx.staged {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		var backup string
+		if backup, err = tx.setAside(ctx, i, f.final); err != nil {
+			break
+		}
+		if backup != "" {
+			replaced = append(replaced, stagedFile{staging: backup, final: f.final})
+		}
+		if err = storage.Move(ctx, tx.store, f.staging, f.final); err != nil {
+			break
+		}
+		moved++
+	}
+
+	if err != nil {
+		// the request context may already be cancelled
+		bg := context.Background()
+		for _, done := range tx.staged[:moved] {
+			_ = tx.store.Delete(bg, done.final)
+		}
+		// in reverse, so a key written twice in this upload ends up with the file it had before
+		for i := len(replaced) - 1; i >= 0; i-- {
+			_ = storage.Move(bg, tx.store, replaced[i].staging, replaced[i].final)
+		}
+		tx.staged = tx.staged[moved:]
+		tx.rollback()
+		return fmt.Errorf("failed to commit uploaded files: %w", err)
+	}
+
+	for _, r := range replaced {
+		_ = tx.store.Delete(context.Background(), r.staging)
+	}
+	tx.staged = nil
+	return nil
+}
+
+// setAside moves the file stored under final, if there is one, to a backup key for the i-th staged file, and
+// returns the backup key, or "" if final is not stored.
+func (tx *uploadTx) setAside(ctx context.Context, i int, final string) (string, error) {
+	_, err := tx.store.Stat(ctx, final)
+	if errors.Is(err, storage.ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	backup := path.Join(path.Dir(final), ".replaced-"+tx.id+"-"+strconv.Itoa(i)+"-"+path.Base(final))
+	if err := storage.Move(ctx, tx.store, final, backup); err != nil {
+		return "", err
+	}
+	return backup, nil
+}
+
+// exists reports whether final is already stored, or is the final key of a file staged in this upload.
+func (tx *uploadTx) exists(ctx context.Context, final string) (bool, error) {
+	for _, f := range tx.staged {
+		if f.final == final {
+			return true, nil
+		}
+	}
+	_, err := tx.store.Stat(ctx, final)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// relocate changes the final key of the most recently staged file. If final already exists, the content is
+// already stored, so the staged copy is removed and true is returned.
+func (tx *uploadTx) relocate(ctx context.Context, final string) (bool, error) {
+	last := len(tx.staged) - 1
+	tx.staged[last].final = ""
+	duplicate, err := tx.exists(ctx, final)
+	if err != nil {
+		return false, err
+	}
+	if duplicate {
+		_ = tx.store.Delete(context.Background(), tx.staged[last].staging)
+		tx.staged = tx.staged[:last]
+		return true, nil
+	}
+	tx.staged[last].final = final
+	return false, nil
+}
+
+// rollback removes every staged file. It does not use the request context, which may already be cancelled.
+func (tx *uploadTx) rollback() {
+	for _, f := range tx.staged {
+		_ = tx.store.Delete(context.Background(), f.staging)
+	}
+	tx.staged = nil
+}
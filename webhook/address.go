@@ -0,0 +1,107 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrAddressNotAllowed is returned for an endpoint whose host is, or resolves to, an address inside the network the
+// dispatcher runs in, such as loopback, a private range or the cloud metadata service at 169.254.169.254.
+var ErrAddressNotAllowed = errors.New("webhook endpoint address is not allowed")
+
+// sharedAddressSpace is the carrier-grade NAT range, which is not public although net/netip does not call it private.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// publicAddress reports whether addr can be reached by a delivery: it must not be loopback, private, link-local
+// (which includes the metadata service), multicast or unspecified.
+func publicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() &&
+		!addr.IsLoopback() &&
+		!addr.IsPrivate() &&
+		!addr.IsLinkLocalUnicast() &&
+		!addr.IsLinkLocalMulticast() &&
+		!addr.IsInterfaceLocalMulticast() &&
+		!addr.IsMulticast() &&
+		!addr.IsUnspecified() &&
+		!sharedAddressSpace.Contains(addr) &&
+		!(addr.Is4() && addr.As4()[0] == 0)
+}
+
+// checkURL refuses an endpoint URL whose host is an address that is not public, and resolves host names to refuse
+// those that point inside the network. A name that does not resolve yet is accepted; the dialer checks the address
+// again for every delivery, so a name that is changed to point inside the network later is still refused.
+func (d *Dispatcher) checkURL(ctx context.Context, rawURL string) error {
+	if d.AllowPrivateNetworks {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("failed to parse webhook endpoint URL: %w", err)
+	}
+
+	host := u.Hostname()
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !publicAddress(addr) {
+			return fmt.Errorf("%w: %s", ErrAddressNotAllowed, host)
+		}
+		return nil
+	}
+	if strings.EqualFold(strings.TrimSuffix(host, "."), "localhost") {
+		return fmt.Errorf("%w: %s", ErrAddressNotAllowed, host)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if !publicAddress(addr) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrAddressNotAllowed, host, addr)
+		}
+	}
+	return nil
+}
+
+// newClient returns the default delivery client. Its dialer checks the address every connection is made to, after
+// DNS resolution, so an endpoint cannot reach inside the network by resolving to a private address. Proxies from
+// the environment are not used, as the proxy would make the connection the dialer cannot check.
+func (d *Dispatcher) newClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if d.AllowPrivateNetworks {
+				return nil
+			}
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil || !publicAddress(addr) {
+				return fmt.Errorf("%w: %s", ErrAddressNotAllowed, host)
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: transport,
+		// a redirect could point inside the network, and deliveries are not meant to follow them anyway
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+}
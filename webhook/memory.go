@@ -0,0 +1,216 @@
+package webhook
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/babykittenz/api-micro-util/models"
+	"github.com/babykittenz/api-micro-util/repository"
+)
+
+// memoryEndpointRepository is an in-memory repository.WebhookEndpointRepository for tests and local development.
+type memoryEndpointRepository struct {
+	mu        sync.RWMutex
+	endpoints map[string]models.WebhookEndpoint
+}
+
+// NewMemoryEndpointRepository returns an empty in-memory WebhookEndpointRepository.
+func NewMemoryEndpointRepository() repository.WebhookEndpointRepository {
+	return &memoryEndpointRepository{endpoints: make(map[string]models.WebhookEndpoint)}
+}
+
+// FindByID returns a copy of the endpoint with the given ID.
+func (m *memoryEndpointRepository) FindByID(id string) (*models.WebhookEndpoint, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	e, ok := m.endpoints[id]
+	if !ok {
+		return nil, fmt.Errorf("webhook endpoint with id %s not found", id)
+	}
+	return &e, nil
+}
+
+// FindAllByCompanyID returns copies of all endpoints for a company.
+func (m *memoryEndpointRepository) FindAllByCompanyID(id string) ([]*models.WebhookEndpoint, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	endpoints := []*models.WebhookEndpoint{}
+	for _, e := range m.endpoints {
+		if e.CompanyID == id {
+			e := e
+			endpoints = append(endpoints, &e)
+		}
+	}
+	return endpoints, nil
+}
+
+// Save stores a copy of the endpoint.
+func (m *memoryEndpointRepository) Save(e *models.WebhookEndpoint) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.endpoints[e.ID] = *e
+	return nil
+}
+
+// Update replaces a stored endpoint, failing if it does not exist.
+func (m *memoryEndpointRepository) Update(e *models.WebhookEndpoint) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.endpoints[e.ID]; !ok {
+		return fmt.Errorf("webhook endpoint with id %s not found", e.ID)
+	}
+	m.endpoints[e.ID] = *e
+	return nil
+}
+
+// Delete removes an endpoint.
+func (m *memoryEndpointRepository) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.endpoints, id)
+	return nil
+}
+
+// memoryDeliveryRepository is an in-memory repository.WebhookDeliveryRepository for tests and local development.
+type memoryDeliveryRepository struct {
+	mu         sync.RWMutex
+	deliveries map[string]models.WebhookDelivery
+	attempts   []models.WebhookAttempt
+}
+
+// NewMemoryDeliveryRepository returns an empty in-memory WebhookDeliveryRepository.
+func NewMemoryDeliveryRepository() repository.WebhookDeliveryRepository {
+	return &memoryDeliveryRepository{deliveries: make(map[string]models.WebhookDelivery)}
+}
+
+// FindByID returns a copy of the delivery with the given ID.
+func (m *memoryDeliveryRepository) FindByID(id string) (*models.WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	d, ok := m.deliveries[id]
+	if !ok {
+		return nil, fmt.Errorf("webhook delivery with id %s not found", id)
+	}
+	return &d, nil
+}
+
+// FindDue returns copies of up to limit pending deliveries due by now, oldest first.
+func (m *memoryDeliveryRepository) FindDue(now time.Time, limit int) ([]*models.WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	due := []*models.WebhookDelivery{}
+	for _, d := range m.deliveries {
+		if d.Status == models.WebhookStatusPending && !d.NextAttempt.After(now) {
+			d := d
+			due = append(due, &d)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttempt.Before(due[j].NextAttempt) })
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+// FindAllByEndpointID returns copies of the deliveries for an endpoint with the given status, or every status if
+// status is empty, newest first.
+func (m *memoryDeliveryRepository) FindAllByEndpointID(id string, status string) ([]*models.WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	deliveries := []*models.WebhookDelivery{}
+	for _, d := range m.deliveries {
+		if d.EndpointID == id && (status == "" || d.Status == status) {
+			d := d
+			deliveries = append(deliveries, &d)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].Created.After(deliveries[j].Created) })
+	return deliveries, nil
+}
+
+// Save stores a copy of the delivery.
+func (m *memoryDeliveryRepository) Save(d *models.WebhookDelivery) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.deliveries[d.ID] = *d
+	return nil
+}
+
+// Update replaces a stored delivery, failing if it does not exist.
+func (m *memoryDeliveryRepository) Update(d *models.WebhookDelivery) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.deliveries[d.ID]; !ok {
+		return fmt.Errorf("webhook delivery with id %s not found", d.ID)
+	}
+	m.deliveries[d.ID] = *d
+	return nil
+}
+
+// Claim moves the next attempt of a pending delivery to until, if it has not changed since d was read.
+func (m *memoryDeliveryRepository) Claim(d *models.WebhookDelivery, until time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.deliveries[d.ID]
+	if !ok || stored.Status != models.WebhookStatusPending || !stored.NextAttempt.Equal(d.NextAttempt) {
+		return false, nil
+	}
+	stored.NextAttempt = until
+	m.deliveries[d.ID] = stored
+	d.NextAttempt = until
+	return true, nil
+}
+
+// SaveAttempt appends an attempt to the delivery log.
+func (m *memoryDeliveryRepository) SaveAttempt(a *models.WebhookAttempt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.attempts = append(m.attempts, *a)
+	return nil
+}
+
+// FindAttemptsByEndpointID returns copies of the latest limit attempts for an endpoint, newest first. A limit of
+// zero returns every attempt.
+func (m *memoryDeliveryRepository) FindAttemptsByEndpointID(id string, limit int) ([]*models.WebhookAttempt, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	attempts := []*models.WebhookAttempt{}
+	for i := len(m.attempts) - 1; i >= 0 && (limit <= 0 || len(attempts) < limit); i-- {
+		if m.attempts[i].EndpointID == id {
+			a := m.attempts[i]
+			attempts = append(attempts, &a)
+		}
+	}
+	return attempts, nil
+}
@@ -0,0 +1,63 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers sent with every delivery.
+const (
+	HeaderID        = "Webhook-Id"
+	HeaderEvent     = "Webhook-Event"
+	HeaderTimestamp = "Webhook-Timestamp"
+	HeaderSignature = "Webhook-Signature"
+)
+
+// signatureVersion prefixes each signature, so the scheme can change without breaking receivers.
+const signatureVersion = "v1="
+
+// DefaultTolerance is how far a delivery's timestamp may be from the receiver's clock before Verify rejects it.
+const DefaultTolerance = 5 * time.Minute
+
+// Errors returned when a delivery cannot be verified.
+var (
+	ErrSignature = errors.New("webhook signature is invalid")
+	ErrTimestamp = errors.New("webhook timestamp is outside the tolerance")
+)
+
+// Sign returns the Webhook-Signature value for a body sent at timestamp. The signature is the hex encoded
+// HMAC-SHA256 of the timestamp, a dot and the body, so a captured delivery cannot be replayed later with a new
+// timestamp.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10) + "."))
+	mac.Write(body)
+	return signatureVersion + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature headers of a delivery received with body, for use by receivers and in tests. The
+// signature header may hold several space separated signatures, and any one matching secret is accepted.
+func Verify(secret string, header http.Header, body []byte, tolerance time.Duration, now time.Time) error {
+	unix, err := strconv.ParseInt(header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return ErrSignature
+	}
+	timestamp := time.Unix(unix, 0)
+	if d := now.Sub(timestamp); d > tolerance || d < -tolerance {
+		return ErrTimestamp
+	}
+
+	expected := Sign(secret, timestamp, body)
+	for _, signature := range strings.Fields(header.Get(HeaderSignature)) {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrSignature
+}
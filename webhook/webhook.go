@@ -0,0 +1,332 @@
+// Package webhook delivers events such as check-ins and completed trainings to the systems of the companies that
+// subscribe to them. Published events are queued as deliveries in a repository, so they survive restarts, and a
+// Dispatcher sends them with signed headers, retries failures with backoff and dead-letters deliveries that run out
+// of attempts. Every attempt is logged, so deliveries can be inspected per endpoint.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	toolkit "github.com/babykittenz/api-micro-util"
+	"github.com/babykittenz/api-micro-util/models"
+	"github.com/babykittenz/api-micro-util/repository"
+)
+
+// Event types published by the services.
+const (
+	EventTraineeCheckedIn  = "trainee.checked_in"
+	EventTraineeCheckedOut = "trainee.checked_out"
+	EventTrainingCompleted = "training.completed"
+)
+
+// AllEvents subscribes an endpoint to every event type.
+const AllEvents = "*"
+
+// secretPrefix marks webhook secrets, so they are easy to recognise in logs and secret scanners.
+const secretPrefix = "whsec_"
+
+// maxLoggedResponse is the most of a response body kept in the delivery log.
+const maxLoggedResponse = 1024
+
+// DefaultBackoff is the delay before each retry of a failed delivery. A delivery is dead-lettered when it fails
+// again after the last one, a little over a day after it was published.
+var DefaultBackoff = []time.Duration{time.Minute, 5 * time.Minute, 30 * time.Minute, 2 * time.Hour, 6 * time.Hour, 16 * time.Hour}
+
+// Event is the JSON body of every delivery.
+type Event struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CompanyID string      `json:"company_id"`
+	Created   time.Time   `json:"created"`
+	Data      interface{} `json:"data"`
+}
+
+// Dispatcher manages webhook endpoints, queues events for them and delivers the queue.
+type Dispatcher struct {
+	endpoints  repository.WebhookEndpointRepository
+	deliveries repository.WebhookDeliveryRepository
+	tools      *toolkit.Tools
+	// Client sends deliveries. Defaults to a client with a 10 second timeout.
+	Client *http.Client
+	// Backoff is the delay before each retry. Defaults to DefaultBackoff.
+	Backoff []time.Duration
+	// Lease is how long a claimed delivery is hidden from other workers. It must be longer than the client timeout.
+	// Defaults to two minutes.
+	Lease time.Duration
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+	// AllowPrivateNetworks lets endpoints use loopback, private and link-local addresses, which are refused by
+	// Subscribe and by the default Client. It is meant for testing receivers locally.
+	AllowPrivateNetworks bool
+}
+
+// NewDispatcher returns a dispatcher keeping endpoints and deliveries in the given repositories.
+func NewDispatcher(endpoints repository.WebhookEndpointRepository, deliveries repository.WebhookDeliveryRepository, tools *toolkit.Tools) *Dispatcher {
+	d := &Dispatcher{
+		endpoints:  endpoints,
+		deliveries: deliveries,
+		tools:      tools,
+		Backoff:    DefaultBackoff,
+		Lease:      2 * time.Minute,
+		Now:        time.Now,
+	}
+	d.Client = d.newClient()
+	return d
+}
+
+// Subscribe registers a new endpoint and returns its signing secret, which the customer needs to verify deliveries.
+// The endpoint must have a company, URL and at least one event type, and the URL must not point inside the
+// network, such as at a private address or the metadata service, unless AllowPrivateNetworks is set.
+func (d *Dispatcher) Subscribe(e *models.WebhookEndpoint) (string, error) {
+	if err := d.checkURL(context.Background(), e.URL); err != nil {
+		return "", err
+	}
+
+	var err error
+	if e.ID == "" {
+		if e.ID, err = d.tools.RandomToken(15); err != nil {
+			return "", err
+		}
+	}
+	if e.Secret, err = newSecret(d.tools); err != nil {
+		return "", err
+	}
+	e.Active = true
+	e.Created = d.Now().UTC()
+	e.Updated = e.Created
+
+	if err := d.endpoints.Save(e); err != nil {
+		return "", fmt.Errorf("failed to save webhook endpoint: %w", err)
+	}
+	return e.Secret, nil
+}
+
+// RotateSecret gives an endpoint a new signing secret and returns it. Deliveries sent from now on are signed with it.
+func (d *Dispatcher) RotateSecret(id string) (string, error) {
+	e, err := d.endpoints.FindByID(id)
+	if err != nil {
+		return "", err
+	}
+	if e.Secret, err = newSecret(d.tools); err != nil {
+		return "", err
+	}
+	e.Updated = d.Now().UTC()
+
+	if err := d.endpoints.Update(e); err != nil {
+		return "", fmt.Errorf("failed to update webhook endpoint: %w", err)
+	}
+	return e.Secret, nil
+}
+
+// Publish queues an event of eventType for every active endpoint of the company subscribed to it, and returns the
+// queued deliveries. The deliveries are sent by the next call to DeliverDue.
+func (d *Dispatcher) Publish(companyID, eventType string, data interface{}) ([]*models.WebhookDelivery, error) {
+	endpoints, err := d.endpoints.FindAllByCompanyID(companyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find webhook endpoints: %w", err)
+	}
+
+	now := d.Now().UTC()
+	var event Event
+	var payload []byte
+	var deliveries []*models.WebhookDelivery
+	for _, e := range endpoints {
+		if !e.Active || !subscribed(e, eventType) {
+			continue
+		}
+
+		// every endpoint gets the same body, so the event is only encoded once
+		if payload == nil {
+			event = Event{Type: eventType, CompanyID: companyID, Created: now, Data: data}
+			if event.ID, err = d.tools.RandomToken(15); err != nil {
+				return nil, err
+			}
+			if payload, err = json.Marshal(event); err != nil {
+				return nil, fmt.Errorf("failed to encode webhook event: %w", err)
+			}
+		}
+
+		id, err := d.tools.RandomToken(15)
+		if err != nil {
+			return deliveries, err
+		}
+		delivery := &models.WebhookDelivery{
+			ID:          id,
+			EndpointID:  e.ID,
+			CompanyID:   companyID,
+			EventID:     event.ID,
+			EventType:   eventType,
+			Payload:     string(payload),
+			Status:      models.WebhookStatusPending,
+			NextAttempt: now,
+			Created:     now,
+			Updated:     now,
+		}
+		if err := d.deliveries.Save(delivery); err != nil {
+			return deliveries, fmt.Errorf("failed to queue webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+// DeliverDue sends up to limit deliveries that are due, and returns how many were attempted. It is meant to be run
+// on a schedule, and several workers may run it at once; each delivery is claimed by a single worker. Failed
+// deliveries are not errors; they are logged and rescheduled or dead-lettered. An error is returned only if the
+// queue itself could not be read or updated.
+func (d *Dispatcher) DeliverDue(ctx context.Context, limit int) (int, error) {
+	now := d.Now().UTC()
+	due, err := d.deliveries.FindDue(now, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find due webhook deliveries: %w", err)
+	}
+
+	attempted := 0
+	var errs []error
+	for _, delivery := range due {
+		if err := ctx.Err(); err != nil {
+			return attempted, err
+		}
+
+		claimed, err := d.deliveries.Claim(delivery, now.Add(d.Lease))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to claim webhook delivery %s: %w", delivery.ID, err))
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		attempted++
+		if err := d.deliver(ctx, delivery); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return attempted, errors.Join(errs...)
+}
+
+// Redeliver puts a delivery back in the queue to be sent straight away with a fresh set of attempts, such as a
+// dead-lettered delivery after the customer has fixed their endpoint.
+func (d *Dispatcher) Redeliver(id string) error {
+	delivery, err := d.deliveries.FindByID(id)
+	if err != nil {
+		return err
+	}
+	delivery.Status = models.WebhookStatusPending
+	delivery.Attempts = 0
+	delivery.NextAttempt = d.Now().UTC()
+	delivery.Updated = delivery.NextAttempt
+
+	if err := d.deliveries.Update(delivery); err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// deliver makes one attempt to send a claimed delivery, logs it and records the outcome on the delivery.
+func (d *Dispatcher) deliver(ctx context.Context, delivery *models.WebhookDelivery) error {
+	id, err := d.tools.RandomToken(15)
+	if err != nil {
+		return err
+	}
+	start := d.Now().UTC()
+	attempt := &models.WebhookAttempt{
+		ID:         id,
+		DeliveryID: delivery.ID,
+		EndpointID: delivery.EndpointID,
+		EventType:  delivery.EventType,
+		Attempt:    delivery.Attempts + 1,
+		Created:    start,
+	}
+
+	// a disabled endpoint, or one the receiver says is gone, is not retried
+	retry := true
+	endpoint, err := d.endpoints.FindByID(delivery.EndpointID)
+	switch {
+	case err != nil:
+		attempt.Error = err.Error()
+	case !endpoint.Active:
+		attempt.Error = "webhook endpoint is disabled"
+		retry = false
+	default:
+		attempt.StatusCode, attempt.ResponseBody, err = d.send(ctx, endpoint, delivery, start)
+		if err != nil {
+			attempt.Error = err.Error()
+		} else if attempt.StatusCode < 200 || attempt.StatusCode > 299 {
+			attempt.Error = fmt.Sprintf("endpoint responded with %d %s", attempt.StatusCode, http.StatusText(attempt.StatusCode))
+			retry = attempt.StatusCode != http.StatusGone
+		}
+	}
+	end := d.Now().UTC()
+	attempt.DurationMS = end.Sub(start).Milliseconds()
+
+	delivery.Attempts = attempt.Attempt
+	delivery.LastStatusCode = attempt.StatusCode
+	delivery.LastError = attempt.Error
+	delivery.Updated = end
+	switch {
+	case attempt.Error == "":
+		delivery.Status = models.WebhookStatusSucceeded
+	case retry && delivery.Attempts <= len(d.Backoff):
+		delivery.NextAttempt = end.Add(d.Backoff[delivery.Attempts-1])
+	default:
+		delivery.Status = models.WebhookStatusDead
+	}
+
+	var errs []error
+	if err := d.deliveries.SaveAttempt(attempt); err != nil {
+		errs = append(errs, fmt.Errorf("failed to log webhook attempt for %s: %w", delivery.ID, err))
+	}
+	if err := d.deliveries.Update(delivery); err != nil {
+		errs = append(errs, fmt.Errorf("failed to update webhook delivery %s: %w", delivery.ID, err))
+	}
+	return errors.Join(errs...)
+}
+
+// send posts the delivery payload with its signature headers, and returns the status and the start of the body.
+func (d *Dispatcher) send(ctx context.Context, endpoint *models.WebhookEndpoint, delivery *models.WebhookDelivery, now time.Time) (int, string, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderID, delivery.ID)
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(HeaderSignature, Sign(endpoint.Secret, now, body))
+
+	res, err := d.Client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer res.Body.Close()
+
+	logged, _ := io.ReadAll(io.LimitReader(res.Body, maxLoggedResponse))
+	// drain a little more so the connection can be reused
+	_, _ = io.CopyN(io.Discard, res.Body, 64*1024)
+	return res.StatusCode, string(logged), nil
+}
+
+// newSecret returns a signing secret of 32 bytes from crypto/rand.
+func newSecret(tools *toolkit.Tools) (string, error) {
+	token, err := tools.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	return secretPrefix + token, nil
+}
+
+// subscribed reports whether the endpoint receives events of eventType.
+func subscribed(e *models.WebhookEndpoint, eventType string) bool {
+	return slices.Contains(e.EventTypes, eventType) || slices.Contains(e.EventTypes, AllEvents)
+}
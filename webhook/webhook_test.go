@@ -0,0 +1,249 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	toolkit "github.com/babykittenz/api-micro-util"
+	"github.com/babykittenz/api-micro-util/models"
+)
+
+// TestSignature tests that signed deliveries verify, and that tampered or stale ones do not.
+func TestSignature(t *testing.T) {
+	now := time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)
+	body := []byte(`{"id":"evt-1"}`)
+	header := http.Header{}
+	header.Set(HeaderTimestamp, "1735718400")
+	header.Set(HeaderSignature, Sign("whsec_test", now, body))
+
+	if err := Verify("whsec_test", header, body, DefaultTolerance, now.Add(time.Minute)); err != nil {
+		t.Errorf("expected the signature to verify, recieved %v", err)
+	}
+	if err := Verify("whsec_test", header, []byte(`{"id":"evt-2"}`), DefaultTolerance, now); err != ErrSignature {
+		t.Errorf("expected ErrSignature for a changed body, recieved %v", err)
+	}
+	if err := Verify("whsec_other", header, body, DefaultTolerance, now); err != ErrSignature {
+		t.Errorf("expected ErrSignature for the wrong secret, recieved %v", err)
+	}
+	if err := Verify("whsec_test", header, body, DefaultTolerance, now.Add(time.Hour)); err != ErrTimestamp {
+		t.Errorf("expected ErrTimestamp for a replayed delivery, recieved %v", err)
+	}
+}
+
+// TestDispatcher tests publishing to subscribed endpoints, retrying failures and dead-lettering.
+func TestDispatcher(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	statuses := map[string][]int{"/crm": {http.StatusInternalServerError, http.StatusOK}, "/gone": {http.StatusGone}}
+	var secrets = map[string]string{}
+	now := time.Now().UTC()
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		body, _ := io.ReadAll(r.Body)
+		if err := Verify(secrets[r.URL.Path], r.Header, body, DefaultTolerance, now); err != nil {
+			t.Errorf("%s: delivery did not verify: %v", r.URL.Path, err)
+		}
+		received = append(received, r.URL.Path+" "+r.Header.Get(HeaderEvent))
+
+		status := http.StatusServiceUnavailable
+		if s := statuses[r.URL.Path]; len(s) > 0 {
+			status, statuses[r.URL.Path] = s[0], s[1:]
+		}
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, "ack")
+	}))
+	defer srv.Close()
+
+	var tools toolkit.Tools
+	deliveries := NewMemoryDeliveryRepository()
+	d := NewDispatcher(NewMemoryEndpointRepository(), deliveries, &tools)
+	d.Backoff = []time.Duration{time.Minute, time.Hour}
+	d.AllowPrivateNetworks = true
+	trust(d, srv)
+
+	d.Now = func() time.Time { return now }
+
+	subscribe := func(path string, events ...string) *models.WebhookEndpoint {
+		e := &models.WebhookEndpoint{CompanyID: "comp-001", URL: srv.URL + path, EventTypes: events}
+		secret, err := d.Subscribe(e)
+		if err != nil || !strings.HasPrefix(secret, "whsec_") {
+			t.Fatalf("subscribe failed: %q %v", secret, err)
+		}
+		secrets[path] = secret
+		return e
+	}
+	crm := subscribe("/crm", EventTraineeCheckedIn)
+	subscribe("/gone", AllEvents)
+	down := subscribe("/down", EventTraineeCheckedIn)
+	subscribe("/training", EventTrainingCompleted)
+
+	if _, err := (&Dispatcher{endpoints: d.endpoints, tools: &tools, Now: d.Now}).Subscribe(&models.WebhookEndpoint{CompanyID: "comp-001", URL: "http://example.com", EventTypes: []string{AllEvents}}); err == nil {
+		t.Error("expected a plain http endpoint to be refused")
+	}
+
+	queued, err := d.Publish("comp-001", EventTraineeCheckedIn, map[string]string{"trainee_id": "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queued) != 3 || queued[0].EventID == "" || queued[0].EventID != queued[1].EventID {
+		t.Fatalf("expected one event queued for 3 endpoints, recieved %d", len(queued))
+	}
+
+	if n, err := d.DeliverDue(context.Background(), 10); n != 3 || err != nil {
+		t.Fatalf("expected 3 attempts, recieved %d %v", n, err)
+	}
+	if n, _ := d.DeliverDue(context.Background(), 10); n != 0 {
+		t.Errorf("expected nothing due before the backoff, recieved %d", n)
+	}
+
+	now = now.Add(time.Minute)
+	if n, _ := d.DeliverDue(context.Background(), 10); n != 2 {
+		t.Errorf("expected the 2 failed deliveries to be retried, recieved %d", n)
+	}
+	now = now.Add(time.Hour)
+	if n, _ := d.DeliverDue(context.Background(), 10); n != 1 {
+		t.Errorf("expected the failing delivery to be retried once more, recieved %d", n)
+	}
+
+	succeeded, _ := deliveries.FindAllByEndpointID(crm.ID, models.WebhookStatusSucceeded)
+	if len(succeeded) != 1 || succeeded[0].Attempts != 2 {
+		t.Errorf("expected the crm delivery to succeed on the second attempt, recieved %+v", succeeded)
+	}
+	dead, _ := deliveries.FindAllByEndpointID(down.ID, models.WebhookStatusDead)
+	if len(dead) != 1 || dead[0].Attempts != 3 || dead[0].LastStatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected the delivery to a failing endpoint to be dead-lettered after 3 attempts, recieved %+v", dead)
+	}
+
+	attempts, _ := deliveries.FindAttemptsByEndpointID(down.ID, 2)
+	if len(attempts) != 2 || attempts[0].Attempt != 3 || attempts[0].ResponseBody != "ack" || attempts[0].Error == "" {
+		t.Errorf("expected the latest attempts to be logged newest first, recieved %+v", attempts)
+	}
+
+	mu.Lock()
+	if len(received) != 6 {
+		t.Errorf("expected 6 requests, recieved %v", received)
+	}
+	mu.Unlock()
+
+	// a dead-lettered delivery can be sent again once the endpoint is fixed
+	statuses["/down"] = []int{http.StatusNoContent}
+	if err := d.Redeliver(dead[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := d.DeliverDue(context.Background(), 10); n != 1 {
+		t.Errorf("expected the redelivery to be attempted, recieved %d", n)
+	}
+	if redelivered, _ := deliveries.FindByID(dead[0].ID); redelivered.Status != models.WebhookStatusSucceeded {
+		t.Errorf("expected the redelivery to succeed, recieved %+v", redelivered)
+	}
+}
+
+// trust makes d's client trust the certificate of the TLS test server srv, keeping its dialer.
+func trust(d *Dispatcher, srv *httptest.Server) {
+	d.Client.Transport.(*http.Transport).TLSClientConfig = srv.Client().Transport.(*http.Transport).TLSClientConfig
+}
+
+// TestDispatcherClaim tests that a delivery is only sent by one of several workers.
+func TestDispatcherClaim(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	var tools toolkit.Tools
+	endpoints, deliveries := NewMemoryEndpointRepository(), NewMemoryDeliveryRepository()
+	d := NewDispatcher(endpoints, deliveries, &tools)
+	d.AllowPrivateNetworks = true
+	trust(d, srv)
+	if _, err := d.Subscribe(&models.WebhookEndpoint{CompanyID: "comp-001", URL: srv.URL, EventTypes: []string{AllEvents}}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		_, _ = d.Publish("comp-001", EventTrainingCompleted, i)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			worker := NewDispatcher(endpoints, deliveries, &tools)
+			worker.AllowPrivateNetworks = true
+			trust(worker, srv)
+			_, _ = worker.DeliverDue(context.Background(), 10)
+		}()
+	}
+	wg.Wait()
+
+	if requests != 5 {
+		t.Errorf("expected each delivery to be sent once, recieved %d requests", requests)
+	}
+}
+
+// addressTests is a test table for the endpoint URLs Subscribe refuses.
+var addressTests = []struct {
+	name    string
+	url     string
+	allowed bool
+}{
+	{name: "public address", url: "https://93.184.215.14/hooks", allowed: true},
+	{name: "loopback", url: "https://127.0.0.1/hooks"},
+	{name: "localhost", url: "http://localhost:8080/hooks"},
+	{name: "private", url: "https://10.1.2.3/hooks"},
+	{name: "metadata service", url: "https://169.254.169.254/latest/meta-data/"},
+	{name: "mapped loopback", url: "https://[::ffff:127.0.0.1]/hooks"},
+	{name: "unique local ipv6", url: "https://[fd00:ec2::254]/hooks"},
+	{name: "unspecified", url: "https://0.0.0.0/hooks"},
+}
+
+// TestDispatcherAddresses tests that endpoints inside the network are refused when subscribing, and that a
+// delivery to a name resolving inside the network is refused when connecting.
+func TestDispatcherAddresses(t *testing.T) {
+	var tools toolkit.Tools
+	endpoints, deliveries := NewMemoryEndpointRepository(), NewMemoryDeliveryRepository()
+	d := NewDispatcher(endpoints, deliveries, &tools)
+
+	for _, e := range addressTests {
+		_, err := d.Subscribe(&models.WebhookEndpoint{CompanyID: "comp-001", URL: e.url, EventTypes: []string{AllEvents}})
+		if e.allowed && err != nil {
+			t.Errorf("%s: expected the endpoint to be allowed, recieved %v", e.name, err)
+		}
+		if !e.allowed && !errors.Is(err, ErrAddressNotAllowed) {
+			t.Errorf("%s: expected ErrAddressNotAllowed, recieved %v", e.name, err)
+		}
+	}
+
+	requests := 0
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { requests++ }))
+	defer srv.Close()
+
+	// an endpoint saved before the check, by a name that resolves to loopback
+	target := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+	if err := endpoints.Save(&models.WebhookEndpoint{ID: "internal", CompanyID: "comp-002", URL: target, EventTypes: []string{AllEvents}, Active: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Publish("comp-002", EventTraineeCheckedIn, nil); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := d.DeliverDue(context.Background(), 10); n != 1 || err != nil {
+		t.Fatalf("expected one attempt, recieved %d %v", n, err)
+	}
+	attempts, _ := deliveries.FindAttemptsByEndpointID("internal", 0)
+	if requests != 0 || len(attempts) != 1 || !strings.Contains(attempts[0].Error, ErrAddressNotAllowed.Error()) {
+		t.Errorf("expected the connection to be refused, recieved %d requests and %+v", requests, attempts)
+	}
+}